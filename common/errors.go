@@ -0,0 +1,9 @@
+package common
+
+import "errors"
+
+// ErrBufferLimit is reported when the events or the output that a stage holds
+// back exceed its buffer limit, like the mappings that the parser holds back
+// for duplicate keys or that the JSON renderer sorts. A single setting often
+// limits both, so they share this error.
+var ErrBufferLimit = errors.New("mapping too large to hold back within the buffer limit")
@@ -1,5 +1,7 @@
 package common
 
+import "strings"
+
 type EventType int
 
 const (
@@ -10,12 +12,69 @@ const (
 	START_ARRAY
 	EMIT_ELEMENT
 	END_ARRAY
+	// The following events are only produced if a parser is asked for
+	// detailed events. Consumers that only care about the JSON data model can
+	// ignore the stream and document events.
+	STREAM_START
+	STREAM_END
+	DOCUMENT_START
+	DOCUMENT_END
+	// ALIAS refers to an anchored node. It takes the place of a value or a
+	// key, see AliasEvent.
+	ALIAS
+	// COMMENT and BLANK_LINE are only produced if a parser is asked for
+	// comments. They keep the comments and the empty lines of the source for
+	// formatters, and may appear between any other events. All other
+	// consumers can ignore them.
+	COMMENT
+	BLANK_LINE
 )
 
 type Event interface {
 	GetKind() EventType
 }
 
+// ScalarStyle is the way a scalar is written in YAML.
+type ScalarStyle int
+
+const (
+	PLAIN ScalarStyle = iota
+	SINGLE_QUOTED
+	DOUBLE_QUOTED
+	LITERAL
+	FOLDED
+)
+
+// CollectionStyle is the way a mapping or a sequence is written in YAML.
+type CollectionStyle int
+
+const (
+	BLOCK CollectionStyle = iota
+	FLOW
+)
+
+// HasNodeProperties is implemented by the events that start a node, which may
+// have a tag and an anchor in YAML. The tag is the full tag, e.g.
+// "tag:yaml.org,2002:str" for "!!str". Both are empty if the node has none.
+type HasNodeProperties interface {
+	GetTag() string
+	GetAnchor() string
+}
+
+// Position locates the content of a node in the YAML source, after its tag
+// and anchor. Line and Column start at 1, both are zero if the position is
+// unknown.
+type Position struct {
+	Line   int
+	Column int
+}
+
+// HasPosition is implemented by the events that start a node. The position is
+// only known for detailed events.
+type HasPosition interface {
+	GetPosition() Position
+}
+
 type PayLoadType int
 
 const (
@@ -34,6 +93,15 @@ type EventWithPayload struct {
 	Kind        EventType
 	PayloadType PayLoadType
 	Payload     string
+	// Style, Tag and Anchor describe the scalar in the YAML source,
+	// Source is its content before it was resolved, e.g. "0x1F" for the
+	// number 31 or "" for an empty value, and Position is where it starts.
+	// They are only set for detailed events.
+	Style    ScalarStyle
+	Tag      string
+	Anchor   string
+	Source   string
+	Position Position
 }
 
 type eventWithoutPayload struct {
@@ -60,6 +128,12 @@ func (e *eventWithoutPayload) String() string {
 		return "<EMIT_ELEMENT>"
 	case END_ARRAY:
 		return "<END_ARRAY>"
+	case STREAM_START:
+		return "<STREAM_START>"
+	case STREAM_END:
+		return "<STREAM_END>"
+	case BLANK_LINE:
+		return "<BLANK_LINE>"
 	default:
 		return "<UNKNOWN>"
 	}
@@ -77,7 +151,31 @@ func (e *EventWithPayload) GetPayLoadType() PayLoadType {
 	return e.PayloadType
 }
 
+func (e *EventWithPayload) GetScalarStyle() ScalarStyle {
+	return e.Style
+}
+
+func (e *EventWithPayload) GetTag() string {
+	return e.Tag
+}
+
+func (e *EventWithPayload) GetAnchor() string {
+	return e.Anchor
+}
+
+func (e *EventWithPayload) GetPosition() Position {
+	return e.Position
+}
+
 func (e *EventWithPayload) String() string {
+	s := e.string()
+	if e.Style != PLAIN || e.Tag != "" || e.Anchor != "" {
+		s = strings.TrimSuffix(s, ">") + " " + scalarStyleToString(e.Style) + propertiesToString(e.Anchor, e.Tag) + ">"
+	}
+	return s
+}
+
+func (e *EventWithPayload) string() string {
 	switch e.Kind {
 	case START_MAPPING:
 		return "<START_MAPPING '" + e.Payload + "'>"
@@ -113,6 +211,139 @@ func payloadTypeToString(pt PayLoadType) string {
 	}
 }
 
+func scalarStyleToString(style ScalarStyle) string {
+	switch style {
+	case PLAIN:
+		return "PLAIN"
+	case SINGLE_QUOTED:
+		return "SINGLE_QUOTED"
+	case DOUBLE_QUOTED:
+		return "DOUBLE_QUOTED"
+	case LITERAL:
+		return "LITERAL"
+	case FOLDED:
+		return "FOLDED"
+	default:
+		return "UNKNOWN"
+	}
+}
+
+func propertiesToString(anchor, tag string) string {
+	s := ""
+	if anchor != "" {
+		s += " &" + anchor
+	}
+	if tag != "" {
+		s += " <" + tag + ">"
+	}
+	return s
+}
+
+// CollectionEvent is a detailed START_MAPPING or START_ARRAY event.
+type CollectionEvent struct {
+	Kind     EventType
+	Style    CollectionStyle
+	Tag      string
+	Anchor   string
+	Position Position
+}
+
+func (e *CollectionEvent) GetKind() EventType {
+	return e.Kind
+}
+
+func (e *CollectionEvent) GetCollectionStyle() CollectionStyle {
+	return e.Style
+}
+
+func (e *CollectionEvent) GetTag() string {
+	return e.Tag
+}
+
+func (e *CollectionEvent) GetAnchor() string {
+	return e.Anchor
+}
+
+func (e *CollectionEvent) GetPosition() Position {
+	return e.Position
+}
+
+func (e *CollectionEvent) String() string {
+	style := "BLOCK"
+	if e.Style == FLOW {
+		style = "FLOW"
+	}
+	kind := "<START_MAPPING"
+	if e.Kind == START_ARRAY {
+		kind = "<START_ARRAY"
+	}
+	return kind + " " + style + propertiesToString(e.Anchor, e.Tag) + ">"
+}
+
+// DocumentEvent is a DOCUMENT_START or DOCUMENT_END event. Explicit is set if
+// the document starts with "---" or ends with "...".
+type DocumentEvent struct {
+	Kind     EventType
+	Explicit bool
+}
+
+func (e *DocumentEvent) GetKind() EventType {
+	return e.Kind
+}
+
+func (e *DocumentEvent) String() string {
+	kind := "<DOCUMENT_START"
+	if e.Kind == DOCUMENT_END {
+		kind = "<DOCUMENT_END"
+	}
+	if e.Explicit {
+		return kind + " explicit>"
+	}
+	return kind + ">"
+}
+
+// AliasEvent refers to the node with the anchor Anchor. Parsers that expand
+// aliases, which is necessary for JSON, replace it with the events of that
+// node. Otherwise, it takes the place of an EMIT_VALUE or an EMIT_KEY event.
+type AliasEvent struct {
+	Anchor   string
+	Position Position
+}
+
+func (e *AliasEvent) GetKind() EventType {
+	return ALIAS
+}
+
+func (e *AliasEvent) GetPosition() Position {
+	return e.Position
+}
+
+func (e *AliasEvent) String() string {
+	return "<ALIAS *" + e.Anchor + ">"
+}
+
+// CommentEvent is a comment in the YAML source. Text is the comment without
+// the "#". An inline comment ends a line with content, and belongs to the
+// node or key on that line. Other comments take up lines of their own and
+// belong to what follows.
+type CommentEvent struct {
+	Text     string
+	Inline   bool
+	Position Position
+}
+
+func (e *CommentEvent) GetKind() EventType {
+	return COMMENT
+}
+
+func (e *CommentEvent) GetPosition() Position {
+	return e.Position
+}
+
+func (e *CommentEvent) String() string {
+	return "<COMMENT #" + e.Text + ">"
+}
+
 func NewStringEvent(payload string) Event {
 	return &EventWithPayload{
 		Kind:        EMIT_VALUE,
@@ -182,3 +413,48 @@ func NewEmitElementEvent() Event {
 		Kind: EMIT_ELEMENT,
 	}
 }
+
+func NewStreamStartEvent() Event {
+	return &eventWithoutPayload{
+		Kind: STREAM_START,
+	}
+}
+
+func NewStreamEndEvent() Event {
+	return &eventWithoutPayload{
+		Kind: STREAM_END,
+	}
+}
+
+func NewDocumentStartEvent(explicit bool) Event {
+	return &DocumentEvent{
+		Kind:     DOCUMENT_START,
+		Explicit: explicit,
+	}
+}
+
+func NewDocumentEndEvent(explicit bool) Event {
+	return &DocumentEvent{
+		Kind:     DOCUMENT_END,
+		Explicit: explicit,
+	}
+}
+
+func NewCommentEvent(text string, inline bool) Event {
+	return &CommentEvent{
+		Text:   text,
+		Inline: inline,
+	}
+}
+
+func NewBlankLineEvent() Event {
+	return &eventWithoutPayload{
+		Kind: BLANK_LINE,
+	}
+}
+
+func NewAliasEvent(anchor string) Event {
+	return &AliasEvent{
+		Anchor: anchor,
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"hbibel/yaml-to-json/yaml"
+	"io"
+	"os"
+)
+
+// The tokens and events subcommands show the intermediate results of the
+// pipeline, which helps to find out whether the tokenizer or the parser is at
+// fault when a conversion goes wrong.
+
+// runDebugCommand runs the subcommand name with the remaining command line
+// arguments, which may name the input file.
+func runDebugCommand(name string, args []string) error {
+	var input io.Reader = os.Stdin
+	switch len(args) {
+	case 0:
+	case 1:
+		f, err := os.Open(args[0])
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		input = f
+	default:
+		return fmt.Errorf("usage: %s %s [FILE]", os.Args[0], name)
+	}
+
+	output := bufio.NewWriter(os.Stdout)
+	var err error
+	if name == "tokens" {
+		err = printTokens(input, output)
+	} else {
+		err = printEvents(input, output)
+	}
+	// print what was found before an error, which is where to look
+	if flushErr := output.Flush(); err == nil {
+		err = flushErr
+	}
+	return err
+}
+
+// printTokens writes one token per line with its line number and kind.
+func printTokens(r io.Reader, w io.Writer) error {
+	scanner := yaml.NewScanner(yaml.NewUTF8Reader(r))
+	for scanner.Scan() {
+		if _, err := fmt.Fprintf(w, "%d %s %q\n", scanner.Line(), scanner.Kind(), scanner.Bytes()); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+// printEvents writes the detailed events of the parser in the event text
+// notation of the yaml-test-suite.
+func printEvents(r io.Reader, w io.Writer) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	tokens, tokenizeErrs := yaml.TokenizeBatches(ctx, yaml.NewUTF8Reader(r), yaml.TokenizeOptions{})
+	events, parseErrs := yaml.TokenBatchesToEvents(ctx, tokens, yaml.ParseOptions{Detailed: true})
+
+	writer := yaml.NewEventTextWriter(w)
+	var writeErr error
+	for batch := range events {
+		for _, event := range batch {
+			if writeErr == nil {
+				writeErr = writer.Write(event)
+			}
+		}
+		if writeErr != nil {
+			cancel()
+		}
+	}
+
+	// a tokenizer error makes the parser fail as well, report the cause
+	for _, err := range []error{<-tokenizeErrs, <-parseErrs, writeErr} {
+		if err != nil && err != context.Canceled {
+			return err
+		}
+	}
+	return nil
+}
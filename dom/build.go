@@ -0,0 +1,285 @@
+package dom
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hbibel/yaml-to-json/common"
+	"hbibel/yaml-to-json/yaml"
+	"io"
+)
+
+// Parse reads all documents of a YAML stream into trees. It parses the
+// stream with detailed events, so that the trees keep the styles, the
+// properties, the positions and the aliases of the source.
+func Parse(ctx context.Context, r io.Reader, opts yaml.ParseOptions) ([]*Document, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	opts.Detailed = true
+	tokens, tokenizeErrs := yaml.TokenizeBatches(ctx, yaml.NewUTF8Reader(r), yaml.TokenizeOptions{BatchSize: opts.BatchSize})
+	batches, parseErrs := yaml.TokenBatchesToEvents(ctx, tokens, opts)
+	events := make(chan common.Event)
+	go func() {
+		defer close(events)
+		for batch := range batches {
+			for _, event := range batch {
+				select {
+				case events <- event:
+				case <-ctx.Done():
+					// drain the parser so that it notices the cancellation
+					for range batches {
+					}
+					return
+				}
+			}
+		}
+	}()
+
+	docs, err := Build(ctx, events)
+	if err != nil {
+		cancel()
+	}
+	for range events {
+	}
+	// the parser and tokenizer errors explain a truncated event stream
+	if parseErr := <-parseErrs; parseErr != nil && parseErr != context.Canceled {
+		err = parseErr
+	}
+	if tokenizeErr := <-tokenizeErrs; tokenizeErr != nil && tokenizeErr != context.Canceled {
+		err = tokenizeErr
+	}
+	if err != nil {
+		return nil, err
+	}
+	return docs, nil
+}
+
+// Build reads events until the channel is closed and returns a tree for each
+// document. Detailed events are needed to keep the properties and the aliases
+// of nodes. Without document events, each top level node becomes a document.
+func Build(ctx context.Context, events <-chan common.Event) ([]*Document, error) {
+	b := &builder{anchors: map[string]Node{}}
+	for {
+		var event common.Event
+		var ok bool
+		select {
+		case event, ok = <-events:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		if !ok {
+			break
+		}
+		if err := b.add(event); err != nil {
+			return nil, err
+		}
+	}
+	if len(b.stack) > 0 || b.document != nil {
+		return nil, errors.New("unexpected end of the events")
+	}
+	return b.documents, nil
+}
+
+// builder assembles the nodes of an event stream.
+type builder struct {
+	documents []*Document
+	// the document between DOCUMENT_START and DOCUMENT_END, if any
+	document *Document
+	// the open collections
+	stack []*openCollection
+	// the nodes by anchor, an anchor refers to the last node that defined it
+	anchors map[string]Node
+}
+
+type openCollection struct {
+	node Node
+	// the key of a mapping entry whose value hasn't been seen yet
+	key Node
+}
+
+func (b *builder) add(event common.Event) error {
+	switch event.GetKind() {
+	case common.STREAM_START, common.STREAM_END, common.EMIT_ELEMENT, common.COMMENT, common.BLANK_LINE:
+		return nil
+	case common.DOCUMENT_START:
+		if b.document != nil || len(b.stack) > 0 {
+			return errors.New("a document starts within a document")
+		}
+		b.document = &Document{ExplicitStart: isExplicit(event)}
+		return nil
+	case common.DOCUMENT_END:
+		if b.document == nil || b.document.Root == nil || len(b.stack) > 0 {
+			return errors.New("a document ends before its root node")
+		}
+		b.document.ExplicitEnd = isExplicit(event)
+		b.documents = append(b.documents, b.document)
+		b.document = nil
+		return nil
+	case common.START_MAPPING:
+		mapping := &Mapping{}
+		if e, ok := event.(*common.CollectionEvent); ok {
+			mapping.Properties = Properties{Tag: e.Tag, Anchor: e.Anchor, Position: e.Position}
+			mapping.Style = e.Style
+		}
+		return b.startCollection(mapping)
+	case common.START_ARRAY:
+		sequence := &Sequence{}
+		if e, ok := event.(*common.CollectionEvent); ok {
+			sequence.Properties = Properties{Tag: e.Tag, Anchor: e.Anchor, Position: e.Position}
+			sequence.Style = e.Style
+		}
+		return b.startCollection(sequence)
+	case common.END_MAPPING, common.END_ARRAY:
+		return b.endCollection(event.GetKind())
+	case common.EMIT_KEY:
+		scalar, err := newScalar(event)
+		if err != nil {
+			return err
+		}
+		return b.addKey(scalar)
+	case common.EMIT_VALUE:
+		scalar, err := newScalar(event)
+		if err != nil {
+			return err
+		}
+		return b.addValue(scalar)
+	case common.ALIAS:
+		e := event.(*common.AliasEvent)
+		target, ok := b.anchors[e.Anchor]
+		if !ok {
+			return positionError(e.Position, "the alias *%s refers to an unknown anchor", e.Anchor)
+		}
+		alias := &Alias{Anchor: e.Anchor, Target: target, Position: e.Position}
+		if top := b.top(); top != nil && isMapping(top.node) && top.key == nil {
+			return b.addKey(alias)
+		}
+		return b.addValue(alias)
+	}
+	return fmt.Errorf("unexpected event %v", event)
+}
+
+func isExplicit(event common.Event) bool {
+	e, ok := event.(*common.DocumentEvent)
+	return ok && e.Explicit
+}
+
+func isMapping(node Node) bool {
+	_, ok := node.(*Mapping)
+	return ok
+}
+
+func newScalar(event common.Event) (*Scalar, error) {
+	e, ok := event.(*common.EventWithPayload)
+	if !ok {
+		return nil, fmt.Errorf("the event %v has no payload", event)
+	}
+	return &Scalar{
+		Properties: Properties{Tag: e.Tag, Anchor: e.Anchor, Position: e.Position},
+		Type:       e.PayloadType,
+		Value:      e.Payload,
+		Source:     e.Source,
+		Style:      e.Style,
+	}, nil
+}
+
+func (b *builder) top() *openCollection {
+	if len(b.stack) == 0 {
+		return nil
+	}
+	return b.stack[len(b.stack)-1]
+}
+
+func (b *builder) addKey(key Node) error {
+	top := b.top()
+	if top == nil || !isMapping(top.node) || top.key != nil {
+		return positionError(key.GetPosition(), "a key outside of a mapping key position")
+	}
+	if _, ok := KeyString(key); !ok {
+		return positionError(key.GetPosition(), "a mapping key must be a scalar")
+	}
+	top.key = key
+	b.define(key)
+	return nil
+}
+
+// addValue adds a complete node to the innermost collection, or makes it the
+// root of a document.
+func (b *builder) addValue(node Node) error {
+	b.define(node)
+	top := b.top()
+	if top == nil {
+		if b.document == nil {
+			// events without document events
+			b.documents = append(b.documents, &Document{Root: node})
+			return nil
+		}
+		if b.document.Root != nil {
+			return positionError(node.GetPosition(), "a document with more than one root node")
+		}
+		b.document.Root = node
+		return nil
+	}
+	switch parent := top.node.(type) {
+	case *Mapping:
+		if top.key == nil {
+			return positionError(node.GetPosition(), "a mapping value without a key")
+		}
+		parent.Entries = append(parent.Entries, &Entry{Key: top.key, Value: node})
+		top.key = nil
+	case *Sequence:
+		parent.Items = append(parent.Items, node)
+	}
+	return nil
+}
+
+func (b *builder) startCollection(node Node) error {
+	if top := b.top(); top != nil && isMapping(top.node) && top.key == nil {
+		return positionError(node.GetPosition(), "a mapping key must be a scalar")
+	}
+	b.stack = append(b.stack, &openCollection{node: node})
+	return nil
+}
+
+func (b *builder) endCollection(kind common.EventType) error {
+	top := b.top()
+	if top == nil {
+		return errors.New("the end of a collection that wasn't started")
+	}
+	_, isSequence := top.node.(*Sequence)
+	if isSequence != (kind == common.END_ARRAY) {
+		return errors.New("the end of a collection doesn't match its start")
+	}
+	if top.key != nil {
+		return positionError(top.key.GetPosition(), "a mapping key without a value")
+	}
+	b.stack = b.stack[:len(b.stack)-1]
+	// an anchor is only defined once its node is complete, so a collection
+	// cannot contain an alias of itself
+	return b.addValue(top.node)
+}
+
+// define records the anchor of a node.
+func (b *builder) define(node Node) {
+	var anchor string
+	switch n := node.(type) {
+	case *Mapping:
+		anchor = n.Anchor
+	case *Sequence:
+		anchor = n.Anchor
+	case *Scalar:
+		anchor = n.Anchor
+	}
+	if anchor != "" {
+		b.anchors[anchor] = node
+	}
+}
+
+// positionError prefixes an error with a position if it is known.
+func positionError(position common.Position, format string, args ...any) error {
+	if position.Line == 0 {
+		return fmt.Errorf(format, args...)
+	}
+	args = append([]any{position.Line, position.Column}, args...)
+	return fmt.Errorf("line %d, column %d: "+format, args...)
+}
@@ -0,0 +1,145 @@
+package dom
+
+import (
+	"context"
+	"hbibel/yaml-to-json/common"
+	"hbibel/yaml-to-json/yaml"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func parse(t *testing.T, input string) []*Document {
+	t.Helper()
+	documents, err := Parse(context.Background(), strings.NewReader(input), yaml.ParseOptions{})
+	if err != nil {
+		t.Fatalf("%q: unexpected error: %v", input, err)
+	}
+	return documents
+}
+
+func TestParse(t *testing.T) {
+	documents := parse(t, "--- !e\nb: &x 'one'\na:\n- 0x1F\n- *x\n...\n")
+	x := &Scalar{
+		Properties: Properties{Anchor: "x", Position: common.Position{Line: 2, Column: 7}},
+		Type:       common.STRING,
+		Value:      "one",
+		Source:     "one",
+		Style:      common.SINGLE_QUOTED,
+	}
+	expected := []*Document{{
+		ExplicitStart: true,
+		ExplicitEnd:   true,
+		Root: &Mapping{
+			Properties: Properties{Tag: "!e", Position: common.Position{Line: 2, Column: 1}},
+			Entries: []*Entry{
+				{
+					Key:   &Scalar{Properties: Properties{Position: common.Position{Line: 2, Column: 1}}, Type: common.STRING, Value: "b", Source: "b"},
+					Value: x,
+				},
+				{
+					Key: &Scalar{Properties: Properties{Position: common.Position{Line: 3, Column: 1}}, Type: common.STRING, Value: "a", Source: "a"},
+					Value: &Sequence{
+						Properties: Properties{Position: common.Position{Line: 4, Column: 1}},
+						Items: []Node{
+							&Scalar{Properties: Properties{Position: common.Position{Line: 4, Column: 3}}, Type: common.NUMBER, Value: "31", Source: "0x1F"},
+							&Alias{Anchor: "x", Target: x, Position: common.Position{Line: 5, Column: 3}},
+						},
+					},
+				},
+			},
+		},
+	}}
+	if !reflect.DeepEqual(documents, expected) {
+		t.Errorf("expected %#v, got %#v", expected[0].Root, documents[0].Root)
+	}
+	alias := documents[0].Root.(*Mapping).Entries[1].Value.(*Sequence).Items[1].(*Alias)
+	if alias.Target != documents[0].Root.(*Mapping).Entries[0].Value {
+		t.Error("the alias doesn't refer to the anchored node")
+	}
+}
+
+func TestParseMultipleDocuments(t *testing.T) {
+	documents := parse(t, "--- 1\n---\n- a\n")
+	if len(documents) != 2 {
+		t.Fatalf("expected 2 documents, got %d", len(documents))
+	}
+	if s, ok := documents[0].Root.(*Scalar); !ok || s.Value != "1" {
+		t.Errorf("unexpected first document %#v", documents[0].Root)
+	}
+	if s, ok := documents[1].Root.(*Sequence); !ok || len(s.Items) != 1 {
+		t.Errorf("unexpected second document %#v", documents[1].Root)
+	}
+}
+
+func TestParseEmptyStream(t *testing.T) {
+	if documents := parse(t, ""); len(documents) != 0 {
+		t.Errorf("expected no documents, got %v", documents)
+	}
+}
+
+func TestParseError(t *testing.T) {
+	_, err := Parse(context.Background(), strings.NewReader("a: *x\n"), yaml.ParseOptions{})
+	if err == nil || !strings.Contains(err.Error(), "line 1, column 4") {
+		t.Errorf("expected an error at line 1, column 4, got %v", err)
+	}
+}
+
+func TestParseAliasKey(t *testing.T) {
+	documents := parse(t, "&k a: 1\n*k : 2\n")
+	mapping := documents[0].Root.(*Mapping)
+	if key, ok := KeyString(mapping.Entries[1].Key); !ok || key != "a" {
+		t.Errorf("expected the alias key to resolve to \"a\", got %q", key)
+	}
+	if _, ok := mapping.Entries[1].Key.(*Alias); !ok {
+		t.Errorf("expected an alias key, got %#v", mapping.Entries[1].Key)
+	}
+}
+
+func TestBuildPlainEvents(t *testing.T) {
+	events := make(chan common.Event, 10)
+	for _, event := range []common.Event{
+		common.NewStartMappingEvent(),
+		common.NewKeyEvent("a"),
+		common.NewNullEvent(),
+		common.NewEndMappingEvent(),
+		common.NewBooleanEvent("true"),
+	} {
+		events <- event
+	}
+	close(events)
+	documents, err := Build(context.Background(), events)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []*Document{
+		{Root: &Mapping{Entries: []*Entry{{Key: &Scalar{Type: common.STRING, Value: "a"}, Value: &Scalar{Type: common.NULL, Value: "null"}}}}},
+		{Root: &Scalar{Type: common.BOOLEAN, Value: "true"}},
+	}
+	if !reflect.DeepEqual(documents, expected) {
+		t.Errorf("expected %v, got %v", expected, documents)
+	}
+}
+
+func TestBuildMalformedEvents(t *testing.T) {
+	streams := [][]common.Event{
+		{common.NewStartMappingEvent(), common.NewKeyEvent("a")},
+		{common.NewStartMappingEvent(), common.NewStringEvent("a"), common.NewEndMappingEvent()},
+		{common.NewStartArrayEvent(), common.NewEndMappingEvent()},
+		{common.NewEndArrayEvent()},
+		{common.NewDocumentStartEvent(false), common.NewNullEvent(), common.NewNullEvent()},
+		{common.NewDocumentStartEvent(false), common.NewDocumentEndEvent(false)},
+		{common.NewStartMappingEvent(), common.NewStartMappingEvent()},
+		{common.NewAliasEvent("unknown")},
+	}
+	for _, stream := range streams {
+		events := make(chan common.Event, len(stream))
+		for _, event := range stream {
+			events <- event
+		}
+		close(events)
+		if _, err := Build(context.Background(), events); err == nil {
+			t.Errorf("%v: expected an error", stream)
+		}
+	}
+}
@@ -0,0 +1,199 @@
+// Package dom holds YAML documents in memory as trees of nodes. Trees are
+// built from the events of the parser, can be navigated and changed with
+// paths like "spec.containers[0].image", and are turned back into events for
+// any renderer.
+package dom
+
+import (
+	"hbibel/yaml-to-json/common"
+	"strconv"
+)
+
+// Node is a *Mapping, a *Sequence, a *Scalar or an *Alias.
+type Node interface {
+	// GetPosition returns where the node starts in the YAML source, or the
+	// zero Position if the node was not parsed.
+	GetPosition() common.Position
+	isNode()
+}
+
+// Properties are the parts of a node that don't depend on its kind.
+type Properties struct {
+	// Tag is the full tag of the node, e.g. "tag:yaml.org,2002:str", and
+	// Anchor is its anchor. Both are empty if the node has none.
+	Tag      string
+	Anchor   string
+	Position common.Position
+}
+
+func (p *Properties) GetTag() string {
+	return p.Tag
+}
+
+func (p *Properties) GetAnchor() string {
+	return p.Anchor
+}
+
+func (p *Properties) GetPosition() common.Position {
+	return p.Position
+}
+
+// Mapping is a mapping node. Its entries are in the order of the source.
+type Mapping struct {
+	Properties
+	Style   common.CollectionStyle
+	Entries []*Entry
+}
+
+// Entry is a key and a value of a mapping. The key is a *Scalar, or an *Alias
+// that refers to one.
+type Entry struct {
+	Key   Node
+	Value Node
+}
+
+// Sequence is a sequence node.
+type Sequence struct {
+	Properties
+	Style common.CollectionStyle
+	Items []Node
+}
+
+// Scalar is a scalar node.
+type Scalar struct {
+	Properties
+	// Type and Value are the resolved scalar, like the payload of an
+	// EMIT_VALUE event. Mapping keys are always strings.
+	Type  common.PayLoadType
+	Value string
+	// Source is the content of the scalar as it was written, e.g. "0x1F" for
+	// the number 31, and Style is the way it was written.
+	Source string
+	Style  common.ScalarStyle
+}
+
+// Alias is an alias node. Target is the node with the anchor Anchor, which
+// Build resolves to the closest preceding node with that anchor.
+type Alias struct {
+	Anchor   string
+	Target   Node
+	Position common.Position
+}
+
+func (a *Alias) GetPosition() common.Position {
+	return a.Position
+}
+
+func (*Mapping) isNode()  {}
+func (*Sequence) isNode() {}
+func (*Scalar) isNode()   {}
+func (*Alias) isNode()    {}
+
+// Document is a YAML document. ExplicitStart and ExplicitEnd are set if the
+// document starts with "---" or ends with "...".
+type Document struct {
+	Root          Node
+	ExplicitStart bool
+	ExplicitEnd   bool
+}
+
+func NewMapping() *Mapping {
+	return &Mapping{}
+}
+
+func NewSequence(items ...Node) *Sequence {
+	return &Sequence{Items: items}
+}
+
+func NewString(value string) *Scalar {
+	return &Scalar{Type: common.STRING, Value: value, Source: value}
+}
+
+// NewNumber creates a number from its JSON representation, e.g. "1.5e3".
+func NewNumber(value string) *Scalar {
+	return &Scalar{Type: common.NUMBER, Value: value, Source: value}
+}
+
+func NewBool(value bool) *Scalar {
+	s := strconv.FormatBool(value)
+	return &Scalar{Type: common.BOOLEAN, Value: s, Source: s}
+}
+
+func NewNull() *Scalar {
+	return &Scalar{Type: common.NULL, Value: "null", Source: "null"}
+}
+
+// Get returns the value of the last entry with the given key, or nil if there
+// is none.
+func (m *Mapping) Get(key string) Node {
+	if i := m.index(key); i >= 0 {
+		return m.Entries[i].Value
+	}
+	return nil
+}
+
+// Set replaces the value of the last entry with the given key, or adds an
+// entry at the end if there is none.
+func (m *Mapping) Set(key string, value Node) {
+	if i := m.index(key); i >= 0 {
+		m.Entries[i].Value = value
+		return
+	}
+	m.Entries = append(m.Entries, &Entry{Key: NewString(key), Value: value})
+}
+
+// Delete removes all entries with the given key and reports whether there
+// were any.
+func (m *Mapping) Delete(key string) bool {
+	entries := m.Entries[:0]
+	for _, entry := range m.Entries {
+		if k, ok := KeyString(entry.Key); !ok || k != key {
+			entries = append(entries, entry)
+		}
+	}
+	deleted := len(entries) < len(m.Entries)
+	for i := len(entries); i < len(m.Entries); i++ {
+		m.Entries[i] = nil
+	}
+	m.Entries = entries
+	return deleted
+}
+
+// index returns the index of the last entry with the given key, or -1. The
+// last one wins like in the JSON output of duplicate keys.
+func (m *Mapping) index(key string) int {
+	for i := len(m.Entries) - 1; i >= 0; i-- {
+		if k, ok := KeyString(m.Entries[i].Key); ok && k == key {
+			return i
+		}
+	}
+	return -1
+}
+
+// KeyString returns the text of a mapping key. It reports false if the key is
+// neither a scalar nor an alias of one.
+func KeyString(key Node) (string, bool) {
+	scalar, ok := Resolve(key).(*Scalar)
+	if !ok {
+		return "", false
+	}
+	return scalar.Value, true
+}
+
+// Resolve returns the node that an alias refers to, following chains of
+// aliases, and any other node unchanged. It returns nil for an alias without
+// a target or a cycle of aliases.
+func Resolve(node Node) Node {
+	seen := map[*Alias]bool{}
+	for {
+		alias, ok := node.(*Alias)
+		if !ok {
+			return node
+		}
+		if seen[alias] || alias.Target == nil {
+			return nil
+		}
+		seen[alias] = true
+		node = alias.Target
+	}
+}
@@ -0,0 +1,242 @@
+package dom
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// A path selects a node in a tree, e.g. "spec.containers[0].image". Keys are
+// separated by dots and sequence indices are written in brackets. Keys that
+// contain dots or brackets are written as quoted strings in brackets, like
+// `metadata.labels["app.kubernetes.io/name"]`. The empty path selects the
+// root. Aliases along the path are followed to the nodes they refer to.
+
+// ErrNotFound is returned, possibly wrapped, if a path doesn't select a node.
+var ErrNotFound = errors.New("not found")
+
+// PathSegment is a mapping key or a sequence index of a path.
+type PathSegment struct {
+	Key     string
+	Index   int
+	IsIndex bool
+}
+
+func (s PathSegment) String() string {
+	if s.IsIndex {
+		return "[" + strconv.Itoa(s.Index) + "]"
+	}
+	return "[" + strconv.Quote(s.Key) + "]"
+}
+
+// ParsePath splits a path into its segments.
+func ParsePath(path string) ([]PathSegment, error) {
+	segments := []PathSegment{}
+	rest := path
+	for rest != "" {
+		if rest[0] == '[' {
+			end := strings.IndexByte(rest, ']')
+			if strings.HasPrefix(rest, "[\"") {
+				end = closingQuote(rest[2:]) + 3
+			}
+			if end < 2 || end >= len(rest) || rest[end] != ']' {
+				return nil, fmt.Errorf("%q: unterminated bracket", path)
+			}
+			segment, err := parseBracket(rest[1:end])
+			if err != nil {
+				return nil, fmt.Errorf("%q: %w", path, err)
+			}
+			segments = append(segments, segment)
+			rest = rest[end+1:]
+		} else {
+			if len(segments) > 0 {
+				if rest[0] != '.' {
+					return nil, fmt.Errorf("%q: expected \".\" or \"[\" after %s", path, segments[len(segments)-1])
+				}
+				rest = rest[1:]
+			}
+			end := strings.IndexAny(rest, ".[")
+			if end < 0 {
+				end = len(rest)
+			}
+			if end == 0 {
+				return nil, fmt.Errorf("%q: empty key", path)
+			}
+			segments = append(segments, PathSegment{Key: rest[:end]})
+			rest = rest[end:]
+		}
+	}
+	return segments, nil
+}
+
+// closingQuote returns the index of the quote that ends a double quoted string
+// without its opening quote, or -1.
+func closingQuote(s string) int {
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '"':
+			return i
+		}
+	}
+	return -1
+}
+
+func parseBracket(s string) (PathSegment, error) {
+	if strings.HasPrefix(s, "\"") {
+		key, err := strconv.Unquote(s)
+		if err != nil {
+			return PathSegment{}, fmt.Errorf("malformed key %s", s)
+		}
+		return PathSegment{Key: key}, nil
+	}
+	index, err := strconv.Atoi(s)
+	if err != nil || index < 0 || strings.HasPrefix(s, "+") {
+		return PathSegment{}, fmt.Errorf("malformed index [%s]", s)
+	}
+	return PathSegment{Index: index, IsIndex: true}, nil
+}
+
+// Lookup returns the node that path selects in the tree of root.
+func Lookup(root Node, path string) (Node, error) {
+	segments, err := ParsePath(path)
+	if err != nil {
+		return nil, err
+	}
+	node := root
+	for i, segment := range segments {
+		node, err = child(node, segment)
+		if err != nil {
+			return nil, fmt.Errorf("%q: %s: %w", path, formatPath(segments[:i+1]), err)
+		}
+	}
+	return node, nil
+}
+
+// Set replaces the node that path selects with value. If the last segment of
+// the path is a key that the mapping doesn't have, or the index right after
+// the last item of a sequence, value is added. All other segments must
+// exist. Setting the node of a path through an alias changes the anchored
+// node, and with it all of its aliases.
+func Set(root Node, path string, value Node) error {
+	parent, last, err := lookupParent(root, path)
+	if err != nil {
+		return err
+	}
+	switch parent := parent.(type) {
+	case *Mapping:
+		if !last.IsIndex {
+			parent.Set(last.Key, value)
+			return nil
+		}
+	case *Sequence:
+		if last.IsIndex && last.Index < len(parent.Items) {
+			parent.Items[last.Index] = value
+			return nil
+		}
+		if last.IsIndex && last.Index == len(parent.Items) {
+			parent.Items = append(parent.Items, value)
+			return nil
+		}
+		if last.IsIndex {
+			return fmt.Errorf("%q: index %d is out of range: %w", path, last.Index, ErrNotFound)
+		}
+	}
+	return fmt.Errorf("%q: the parent is not a %s", path, kindOf(last))
+}
+
+// Delete removes the node that path selects from its mapping or sequence.
+func Delete(root Node, path string) error {
+	parent, last, err := lookupParent(root, path)
+	if err != nil {
+		return err
+	}
+	switch parent := parent.(type) {
+	case *Mapping:
+		if !last.IsIndex {
+			if !parent.Delete(last.Key) {
+				return fmt.Errorf("%q: %w", path, ErrNotFound)
+			}
+			return nil
+		}
+	case *Sequence:
+		if last.IsIndex {
+			if last.Index >= len(parent.Items) {
+				return fmt.Errorf("%q: %w", path, ErrNotFound)
+			}
+			parent.Items = append(parent.Items[:last.Index], parent.Items[last.Index+1:]...)
+			return nil
+		}
+	}
+	return fmt.Errorf("%q: the parent is not a %s", path, kindOf(last))
+}
+
+// lookupParent returns the collection that contains the node of a path, and
+// the last segment of the path.
+func lookupParent(root Node, path string) (Node, PathSegment, error) {
+	segments, err := ParsePath(path)
+	if err != nil {
+		return nil, PathSegment{}, err
+	}
+	if len(segments) == 0 {
+		return nil, PathSegment{}, fmt.Errorf("%q: the root has no parent", path)
+	}
+	node := Resolve(root)
+	for i, segment := range segments[:len(segments)-1] {
+		node, err = child(node, segment)
+		if err != nil {
+			return nil, PathSegment{}, fmt.Errorf("%q: %s: %w", path, formatPath(segments[:i+1]), err)
+		}
+	}
+	return Resolve(node), segments[len(segments)-1], nil
+}
+
+// child returns the entry of a collection that a segment selects.
+func child(node Node, segment PathSegment) (Node, error) {
+	switch node := Resolve(node).(type) {
+	case *Mapping:
+		if !segment.IsIndex {
+			if value := node.Get(segment.Key); value != nil {
+				return value, nil
+			}
+			return nil, ErrNotFound
+		}
+	case *Sequence:
+		if segment.IsIndex {
+			if segment.Index < len(node.Items) {
+				return node.Items[segment.Index], nil
+			}
+			return nil, ErrNotFound
+		}
+	}
+	return nil, fmt.Errorf("the parent is not a %s: %w", kindOf(segment), ErrNotFound)
+}
+
+func kindOf(segment PathSegment) string {
+	if segment.IsIndex {
+		return "sequence"
+	}
+	return "mapping"
+}
+
+// formatPath writes segments in the path syntax, quoting keys only where
+// necessary.
+func formatPath(segments []PathSegment) string {
+	var b strings.Builder
+	for i, segment := range segments {
+		switch {
+		case segment.IsIndex:
+			b.WriteString(segment.String())
+		case segment.Key != "" && !strings.ContainsAny(segment.Key, ".[]\""):
+			if i > 0 {
+				b.WriteByte('.')
+			}
+			b.WriteString(segment.Key)
+		default:
+			b.WriteString(segment.String())
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,143 @@
+package dom
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+const manifest = `spec:
+  template:
+    containers:
+    - name: app
+      image: app:1.0
+    - name: sidecar
+      image: proxy:2.1
+  labels:
+    app.kubernetes.io/name: app
+shared: &s
+  x: 1
+alias: *s
+`
+
+func TestParsePath(t *testing.T) {
+	tests := []struct {
+		path     string
+		expected []PathSegment
+	}{
+		{"", []PathSegment{}},
+		{"a", []PathSegment{{Key: "a"}}},
+		{"a.b[0].c", []PathSegment{{Key: "a"}, {Key: "b"}, {Index: 0, IsIndex: true}, {Key: "c"}}},
+		{"[12][3]", []PathSegment{{Index: 12, IsIndex: true}, {Index: 3, IsIndex: true}}},
+		{`a["b.c"]["[\"]"].d`, []PathSegment{{Key: "a"}, {Key: "b.c"}, {Key: `["]`}, {Key: "d"}}},
+		{`[""]`, []PathSegment{{Key: ""}}},
+	}
+	for _, test := range tests {
+		segments, err := ParsePath(test.path)
+		if err != nil {
+			t.Errorf("%q: unexpected error: %v", test.path, err)
+			continue
+		}
+		if !reflect.DeepEqual(segments, test.expected) {
+			t.Errorf("%q: expected %v, got %v", test.path, test.expected, segments)
+		}
+	}
+}
+
+func TestParsePathErrors(t *testing.T) {
+	for _, path := range []string{".a", "a.", "a..b", "a[", "a[]", "a[-1]", "a[+1]", "a[x]", `a["b]`, "a[0]b", `a["b"`} {
+		if segments, err := ParsePath(path); err == nil {
+			t.Errorf("%q: expected an error, got %v", path, segments)
+		}
+	}
+}
+
+func TestLookup(t *testing.T) {
+	root := parse(t, manifest)[0].Root
+	tests := map[string]string{
+		"spec.template.containers[0].image":     "app:1.0",
+		"spec.template.containers[1].name":      "sidecar",
+		`spec.labels["app.kubernetes.io/name"]`: "app",
+		"alias.x":                               "1",
+	}
+	for path, expected := range tests {
+		node, err := Lookup(root, path)
+		if err != nil {
+			t.Errorf("%q: unexpected error: %v", path, err)
+			continue
+		}
+		if s, ok := node.(*Scalar); !ok || s.Value != expected {
+			t.Errorf("%q: expected %q, got %#v", path, expected, node)
+		}
+	}
+	if node, err := Lookup(root, ""); err != nil || node != root {
+		t.Errorf("the empty path doesn't select the root: %v, %v", node, err)
+	}
+}
+
+func TestLookupNotFound(t *testing.T) {
+	root := parse(t, manifest)[0].Root
+	for _, path := range []string{"missing", "spec.template.containers[2]", "spec[0]", "spec.template.containers.name", "spec.labels.app.x"} {
+		if _, err := Lookup(root, path); !errors.Is(err, ErrNotFound) {
+			t.Errorf("%q: expected ErrNotFound, got %v", path, err)
+		}
+	}
+}
+
+func TestSet(t *testing.T) {
+	root := parse(t, manifest)[0].Root
+	sets := map[string]Node{
+		"spec.template.containers[0].image": NewString("app:1.1"),
+		"spec.template.containers[2]":       NewString("appended"),
+		"spec.replicas":                     NewNumber("3"),
+		"alias.y":                           NewBool(true),
+	}
+	for path, value := range sets {
+		if err := Set(root, path, value); err != nil {
+			t.Fatalf("%q: unexpected error: %v", path, err)
+		}
+	}
+	for path, value := range sets {
+		if node, err := Lookup(root, path); err != nil || node != value {
+			t.Errorf("%q: expected %v, got %v, %v", path, value, node, err)
+		}
+	}
+	// the new key comes last, and the anchored node changed with its alias
+	spec := root.(*Mapping).Get("spec").(*Mapping)
+	if key, _ := KeyString(spec.Entries[len(spec.Entries)-1].Key); key != "replicas" {
+		t.Errorf("expected replicas to be the last key, got %q", key)
+	}
+	if _, err := Lookup(root, "shared.y"); err != nil {
+		t.Errorf("the anchored node wasn't changed: %v", err)
+	}
+}
+
+func TestSetErrors(t *testing.T) {
+	root := parse(t, manifest)[0].Root
+	for _, path := range []string{"", "missing.key", "spec.template.containers[3]", "spec.template.containers.x", "spec[0]"} {
+		if err := Set(root, path, NewNull()); err == nil {
+			t.Errorf("%q: expected an error", path)
+		}
+	}
+}
+
+func TestDelete(t *testing.T) {
+	root := parse(t, manifest)[0].Root
+	if err := Delete(root, "spec.template.containers[0]"); err != nil {
+		t.Fatal(err)
+	}
+	if err := Delete(root, `spec.labels["app.kubernetes.io/name"]`); err != nil {
+		t.Fatal(err)
+	}
+	if node, err := Lookup(root, "spec.template.containers[0].name"); err != nil || node.(*Scalar).Value != "sidecar" {
+		t.Errorf("expected the sidecar to be first, got %v, %v", node, err)
+	}
+	if labels, _ := Lookup(root, "spec.labels"); len(labels.(*Mapping).Entries) != 0 {
+		t.Errorf("expected no labels, got %v", labels)
+	}
+	for _, path := range []string{"", "missing", "spec.template.containers[1]", "spec.labels[0]"} {
+		if err := Delete(root, path); err == nil {
+			t.Errorf("%q: expected an error", path)
+		}
+	}
+}
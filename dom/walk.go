@@ -0,0 +1,215 @@
+package dom
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hbibel/yaml-to-json/common"
+	"hbibel/yaml-to-json/yaml"
+)
+
+// WalkOptions configure Walk and Events. The zero value produces the events
+// of the parser without Detailed, which the JSON renderer accepts.
+type WalkOptions struct {
+	// Detailed produces stream and document events, and events that carry
+	// the styles, the properties and the positions of the nodes, like the
+	// detailed events of the parser.
+	Detailed bool
+	// KeepAliases produces ALIAS events for aliases instead of the events of
+	// the nodes they refer to. Renderers that cannot handle ALIAS events need
+	// the aliases expanded.
+	KeepAliases bool
+	// MaxAliasExpansions is the maximum number of aliases that are
+	// expanded, including those within expanded nodes. It protects against
+	// alias bombs like the limit of the parser. Zero means unlimited.
+	MaxAliasExpansions int
+}
+
+// Walk calls visit with the events of a node and its descendants, in the
+// order of the parser. It stops at the first error of visit.
+func Walk(node Node, opts WalkOptions, visit func(common.Event) error) error {
+	w := &walker{opts: opts, visit: visit, expanding: map[*Alias]bool{}}
+	return w.node(node, false)
+}
+
+// WalkDocuments is like Walk, but produces the events of a whole stream.
+// Stream and document events are only produced if events are detailed.
+func WalkDocuments(documents []*Document, opts WalkOptions, visit func(common.Event) error) error {
+	w := &walker{opts: opts, visit: visit, expanding: map[*Alias]bool{}}
+	if opts.Detailed {
+		if err := visit(common.NewStreamStartEvent()); err != nil {
+			return err
+		}
+	}
+	for _, document := range documents {
+		if opts.Detailed {
+			if err := visit(common.NewDocumentStartEvent(document.ExplicitStart)); err != nil {
+				return err
+			}
+		}
+		if err := w.node(document.Root, false); err != nil {
+			return err
+		}
+		if opts.Detailed {
+			if err := visit(common.NewDocumentEndEvent(document.ExplicitEnd)); err != nil {
+				return err
+			}
+		}
+	}
+	if opts.Detailed {
+		return visit(common.NewStreamEndEvent())
+	}
+	return nil
+}
+
+// Events sends the events of documents to the returned channel, which is
+// closed afterwards. Like the stages of the conversion pipeline, it stops as
+// soon as ctx is cancelled, and the error channel yields at most one error.
+func Events(ctx context.Context, documents []*Document, opts WalkOptions) (<-chan common.Event, <-chan error) {
+	events := make(chan common.Event)
+	errc := make(chan error, 1)
+	go func() {
+		defer close(errc)
+		defer close(events)
+		err := WalkDocuments(documents, opts, func(event common.Event) error {
+			select {
+			case events <- event:
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		})
+		if err != nil {
+			errc <- err
+		}
+	}()
+	return events, errc
+}
+
+type walker struct {
+	opts  WalkOptions
+	visit func(common.Event) error
+	// the aliases that are being expanded, to detect cycles
+	expanding  map[*Alias]bool
+	expansions int
+}
+
+func (w *walker) node(node Node, isKey bool) error {
+	switch node := node.(type) {
+	case *Mapping:
+		if isKey {
+			return positionError(node.Position, "a mapping cannot be a mapping key")
+		}
+		if err := w.visit(w.startEvent(common.START_MAPPING, node.Properties, node.Style)); err != nil {
+			return err
+		}
+		for _, entry := range node.Entries {
+			if err := w.node(entry.Key, true); err != nil {
+				return err
+			}
+			if err := w.node(entry.Value, false); err != nil {
+				return err
+			}
+		}
+		return w.visit(common.NewEndMappingEvent())
+	case *Sequence:
+		if isKey {
+			return positionError(node.Position, "a sequence cannot be a mapping key")
+		}
+		if err := w.visit(w.startEvent(common.START_ARRAY, node.Properties, node.Style)); err != nil {
+			return err
+		}
+		for _, item := range node.Items {
+			if err := w.visit(common.NewEmitElementEvent()); err != nil {
+				return err
+			}
+			if err := w.node(item, false); err != nil {
+				return err
+			}
+		}
+		return w.visit(common.NewEndArrayEvent())
+	case *Scalar:
+		return w.visit(w.scalarEvent(node, isKey))
+	case *Alias:
+		return w.alias(node, isKey)
+	case nil:
+		return errors.New("a nil node")
+	}
+	return fmt.Errorf("unknown node %T", node)
+}
+
+func (w *walker) startEvent(kind common.EventType, props Properties, style common.CollectionStyle) common.Event {
+	if !w.opts.Detailed {
+		if kind == common.START_ARRAY {
+			return common.NewStartArrayEvent()
+		}
+		return common.NewStartMappingEvent()
+	}
+	return &common.CollectionEvent{
+		Kind:     kind,
+		Style:    style,
+		Tag:      props.Tag,
+		Anchor:   props.Anchor,
+		Position: props.Position,
+	}
+}
+
+func (w *walker) scalarEvent(s *Scalar, isKey bool) common.Event {
+	event := &common.EventWithPayload{
+		Kind:        common.EMIT_VALUE,
+		PayloadType: s.Type,
+		Payload:     s.Value,
+	}
+	if isKey {
+		event.Kind = common.EMIT_KEY
+		event.PayloadType = common.STRING
+	}
+	if w.opts.Detailed {
+		event.Style = s.Style
+		event.Tag = s.Tag
+		event.Anchor = s.Anchor
+		event.Source = s.Source
+		event.Position = s.Position
+	}
+	return event
+}
+
+// alias produces an ALIAS event or the events of the node that the alias
+// refers to. Expanded aliases lose their anchors, because an anchor must not
+// be defined twice in the same place of the output.
+func (w *walker) alias(alias *Alias, isKey bool) error {
+	if w.opts.KeepAliases {
+		return w.visit(&common.AliasEvent{Anchor: alias.Anchor, Position: alias.Position})
+	}
+	if alias.Target == nil {
+		return positionError(alias.Position, "the alias *%s has no target", alias.Anchor)
+	}
+	if w.expanding[alias] {
+		return positionError(alias.Position, "the alias *%s refers to a node that contains it", alias.Anchor)
+	}
+	w.expansions++
+	if w.opts.MaxAliasExpansions > 0 && w.expansions > w.opts.MaxAliasExpansions {
+		return positionError(alias.Position, "%w", yaml.ErrTooManyAliasExpansions)
+	}
+
+	w.expanding[alias] = true
+	defer delete(w.expanding, alias)
+	visit := w.visit
+	defer func() { w.visit = visit }()
+	w.visit = func(event common.Event) error {
+		if w.opts.Detailed {
+			clearAnchor(event)
+		}
+		return visit(event)
+	}
+	return w.node(alias.Target, isKey)
+}
+
+func clearAnchor(event common.Event) {
+	switch e := event.(type) {
+	case *common.EventWithPayload:
+		e.Anchor = ""
+	case *common.CollectionEvent:
+		e.Anchor = ""
+	}
+}
@@ -0,0 +1,130 @@
+package dom
+
+import (
+	"context"
+	"errors"
+	"hbibel/yaml-to-json/common"
+	"hbibel/yaml-to-json/json"
+	"hbibel/yaml-to-json/yaml"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// parseEvents returns the detailed events of the parser for the input.
+func parseEvents(t *testing.T, input string) []common.Event {
+	t.Helper()
+	ctx := context.Background()
+	tokens := make(chan yaml.Token)
+	tokenizeErrs := yaml.TokenizeReader(ctx, strings.NewReader(input), tokens)
+	eventChannel, parseErrs := yaml.TokensToEventsWithOptions(ctx, tokens, yaml.ParseOptions{Detailed: true})
+	events := []common.Event{}
+	for event := range eventChannel {
+		events = append(events, event)
+	}
+	if err := <-parseErrs; err != nil {
+		t.Fatal(err)
+	}
+	if err := <-tokenizeErrs; err != nil {
+		t.Fatal(err)
+	}
+	return events
+}
+
+func walkDocuments(t *testing.T, documents []*Document, opts WalkOptions) []common.Event {
+	t.Helper()
+	events := []common.Event{}
+	err := WalkDocuments(documents, opts, func(event common.Event) error {
+		events = append(events, event)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return events
+}
+
+func TestWalkDocumentsRoundTrip(t *testing.T) {
+	inputs := []string{
+		manifest,
+		"%TAG !e! tag:example.com,2000:\n--- !e!root\n\"k\": &a 'v'\nl: &s !!seq\n- *a\n&k m: !!int 1\n*k : x\n...\n--- 2\n",
+		"- - 1\n  - ~\n- k:\n",
+	}
+	for _, input := range inputs {
+		expected := parseEvents(t, input)
+		events := walkDocuments(t, parse(t, input), WalkOptions{Detailed: true, KeepAliases: true})
+		if !reflect.DeepEqual(events, expected) {
+			t.Errorf("%q: expected %v, got %v", input, expected, events)
+		}
+	}
+}
+
+func renderJSON(t *testing.T, documents []*Document, opts WalkOptions) (string, error) {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	events, walkErrs := Events(ctx, documents, opts)
+	chunks, renderErrs := json.RenderEventsContext(ctx, events)
+	var output strings.Builder
+	for chunk := range chunks {
+		output.WriteString(chunk)
+	}
+	if err := <-renderErrs; err != nil {
+		cancel()
+		for range events {
+		}
+		return "", err
+	}
+	return output.String(), <-walkErrs
+}
+
+func TestEventsRenderJSON(t *testing.T) {
+	documents := parse(t, manifest)
+	if err := Set(documents[0].Root, "spec.template.containers[0].image", NewString("app:1.1")); err != nil {
+		t.Fatal(err)
+	}
+	if err := Delete(documents[0].Root, "spec.labels"); err != nil {
+		t.Fatal(err)
+	}
+	output, err := renderJSON(t, documents, WalkOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `{"spec":{"template":{"containers":[{"name":"app","image":"app:1.1"},{"name":"sidecar","image":"proxy:2.1"}]}},"shared":{"x":1},"alias":{"x":1}}`
+	if output != expected {
+		t.Errorf("expected %s, got %s", expected, output)
+	}
+}
+
+func TestEventsKeepAliases(t *testing.T) {
+	_, err := renderJSON(t, parse(t, manifest), WalkOptions{KeepAliases: true})
+	if err == nil {
+		t.Error("expected the JSON renderer to reject aliases")
+	}
+}
+
+func TestWalkExpandedAliasKey(t *testing.T) {
+	documents := parse(t, "&k a: 1\n*k : 2\n")
+	events := walkDocuments(t, documents, WalkOptions{Detailed: true})
+	key := events[5].(*common.EventWithPayload)
+	if key.Kind != common.EMIT_KEY || key.Payload != "a" || key.Anchor != "" {
+		t.Errorf("expected the expanded key \"a\" without an anchor, got %v", key)
+	}
+}
+
+func TestWalkAliasCycle(t *testing.T) {
+	sequence := NewSequence()
+	sequence.Items = append(sequence.Items, &Alias{Anchor: "s", Target: sequence})
+	err := Walk(sequence, WalkOptions{}, func(common.Event) error { return nil })
+	if err == nil {
+		t.Error("expected an error for a cycle of aliases")
+	}
+}
+
+func TestWalkMaxAliasExpansions(t *testing.T) {
+	documents := parse(t, "a: &a x\nb: &b\n- *a\n- *a\n- *a\nc:\n- *b\n- *b\n")
+	_, err := renderJSON(t, documents, WalkOptions{MaxAliasExpansions: 5})
+	if !errors.Is(err, yaml.ErrTooManyAliasExpansions) {
+		t.Errorf("expected ErrTooManyAliasExpansions, got %v", err)
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"hbibel/yaml-to-json/yamltojson"
+	"os"
+)
+
+// The fmt subcommand rewrites YAML files with a consistent layout, for use in
+// a pre-commit hook. Files that are already formatted are left untouched.
+
+// runFmtCommand formats the files named by args in place, or stdin to stdout
+// if there are none.
+func runFmtCommand(args []string) error {
+	flags := flag.NewFlagSet("fmt", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s fmt [flags] [FILE...]\n\n", os.Args[0])
+		fmt.Fprintln(flags.Output(), "Rewrites the YAML FILEs in place with a consistent layout, keeping their comments.")
+		fmt.Fprintln(flags.Output(), "Without FILEs, it formats stdin to stdout.")
+		fmt.Fprintln(flags.Output())
+		flags.PrintDefaults()
+	}
+	indent := flags.Int("indent", 2, "indent nested collections by this many spaces")
+	sequenceIndent := flags.String("sequence-indent", "indented", "how to place a sequence that is a mapping value: indented or indentless")
+	sortKeys := flags.Bool("sort-keys", false, "sort the entries of every mapping by key")
+	flags.Parse(args)
+
+	opts := yamltojson.FormatOptions{Indent: *indent, SortKeys: *sortKeys}
+	switch *sequenceIndent {
+	case "indented":
+	case "indentless":
+		opts.IndentlessSequences = true
+	default:
+		return fmt.Errorf("unknown sequence indentation '%s'", *sequenceIndent)
+	}
+
+	ctx := context.Background()
+	if flags.NArg() == 0 {
+		return yamltojson.Format(ctx, os.Stdin, os.Stdout, opts)
+	}
+	for _, path := range flags.Args() {
+		if err := formatFile(ctx, path, opts); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// formatFile rewrites a file if formatting changes it.
+func formatFile(ctx context.Context, path string, opts yamltojson.FormatOptions) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	formatted, err := yamltojson.FormatBytes(ctx, data, opts)
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	if bytes.Equal(data, formatted) {
+		return nil
+	}
+	return os.WriteFile(path, formatted, info.Mode().Perm())
+}
@@ -0,0 +1,34 @@
+// Package leaktest helps tests to verify that pipeline stages do not leave
+// goroutines behind.
+package leaktest
+
+import (
+	"runtime"
+	"testing"
+	"time"
+)
+
+// Check records the number of running goroutines and returns a function that
+// fails the test if that number has not dropped back to the recorded value
+// within a second. Typical usage:
+//
+//	defer leaktest.Check(t)()
+func Check(t testing.TB) func() {
+	before := runtime.NumGoroutine()
+	return func() {
+		t.Helper()
+		deadline := time.Now().Add(time.Second)
+		var after int
+		for time.Now().Before(deadline) {
+			after = runtime.NumGoroutine()
+			if after <= before {
+				return
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+
+		buf := make([]byte, 1<<16)
+		buf = buf[:runtime.Stack(buf, true)]
+		t.Errorf("%d goroutine(s) leaked:\n%s", after-before, buf)
+	}
+}
@@ -0,0 +1,23 @@
+// Package pipeline has helpers for the stages of the conversion pipeline,
+// which run in goroutines connected by channels.
+package pipeline
+
+import "context"
+
+// Drain receives and discards the values of a stage's input until the channel
+// is closed or ctx is cancelled. A stage that stops early because of an error
+// drains its input, so that the stage before it isn't blocked on a send
+// forever, even if the caller doesn't cancel ctx. On success, the input is
+// already closed and Drain returns at once.
+func Drain[T any](ctx context.Context, input <-chan T) {
+	for {
+		select {
+		case _, ok := <-input:
+			if !ok {
+				return
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,300 @@
+// Package yamltestsuite runs the parser against cases in the layout of the data
+// branch of the yaml-test-suite, see https://github.com/yaml/yaml-test-suite.
+// Every case is a directory with these files:
+//
+//	===         the name of the case
+//	in.yaml     the input
+//	test.event  the expected events in the event text notation
+//	in.json     the expected JSON, if the input is valid and representable
+//	error       an empty file that marks invalid input
+//
+// Cases with several variants have a subdirectory per variant instead. The
+// directory tags/<feature>/ contains a symlink to each case that exercises
+// the feature.
+package yamltestsuite
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hbibel/yaml-to-json/yaml"
+	"hbibel/yaml-to-json/yamltojson"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Case is a single test case.
+type Case struct {
+	// ID is the name of the case directory, e.g. "229Q" or "SM9W/01" for a
+	// variant.
+	ID       string
+	Name     string
+	Features []string
+	YAML     []byte
+	// Events is the content of test.event.
+	Events string
+	// JSON is the content of in.json, or nil if there is none.
+	JSON []byte
+	// Error is set if the input is invalid.
+	Error bool
+}
+
+// Load reads all cases below dir.
+func Load(dir string) ([]Case, error) {
+	features, err := loadFeatures(filepath.Join(dir, "tags"))
+	if err != nil {
+		return nil, err
+	}
+
+	var cases []Case
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() || entry.Name() == "tags" || entry.Name() == "name" || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		id := entry.Name()
+		caseDir := filepath.Join(dir, id)
+		if _, err := os.Stat(filepath.Join(caseDir, "in.yaml")); err == nil {
+			c, err := loadCase(caseDir, id, features[id])
+			if err != nil {
+				return nil, err
+			}
+			cases = append(cases, c)
+			continue
+		}
+
+		variants, err := os.ReadDir(caseDir)
+		if err != nil {
+			return nil, err
+		}
+		for _, variant := range variants {
+			if !variant.IsDir() {
+				continue
+			}
+			c, err := loadCase(filepath.Join(caseDir, variant.Name()), id+"/"+variant.Name(), features[id])
+			if err != nil {
+				return nil, err
+			}
+			cases = append(cases, c)
+		}
+	}
+	return cases, nil
+}
+
+// loadFeatures maps case IDs to the features in the tags directory, which
+// may be missing.
+func loadFeatures(dir string) (map[string][]string, error) {
+	features := map[string][]string{}
+	tags, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return features, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	for _, tag := range tags {
+		ids, err := os.ReadDir(filepath.Join(dir, tag.Name()))
+		if err != nil {
+			return nil, err
+		}
+		for _, id := range ids {
+			features[id.Name()] = append(features[id.Name()], tag.Name())
+		}
+	}
+	return features, nil
+}
+
+func loadCase(dir, id string, features []string) (Case, error) {
+	c := Case{ID: id, Features: features}
+	name, err := os.ReadFile(filepath.Join(dir, "==="))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return c, err
+	}
+	c.Name = strings.TrimSpace(string(name))
+	if c.YAML, err = os.ReadFile(filepath.Join(dir, "in.yaml")); err != nil {
+		return c, err
+	}
+	events, err := os.ReadFile(filepath.Join(dir, "test.event"))
+	if err != nil {
+		return c, err
+	}
+	c.Events = string(events)
+	if c.JSON, err = os.ReadFile(filepath.Join(dir, "in.json")); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return c, err
+	}
+	if _, err := os.Stat(filepath.Join(dir, "error")); err == nil {
+		c.Error = true
+	}
+	return c, nil
+}
+
+// timeout limits the time per case, so that a parser that hangs on one case
+// doesn't stop the whole run.
+const timeout = 5 * time.Second
+
+// Run checks a case and returns nil if it passes. Invalid input must be
+// rejected, valid input must produce the expected events and, if there is an
+// in.json, the expected JSON.
+func Run(c Case) error {
+	events, err := parse(c.YAML)
+	if c.Error {
+		if err == nil {
+			return errors.New("expected an error")
+		}
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if events != c.Events {
+		return fmt.Errorf("expected the events\n%s\ngot\n%s", c.Events, events)
+	}
+
+	if c.JSON == nil {
+		return nil
+	}
+	return checkJSON(c)
+}
+
+// parse runs the input through the tokenizer and the parser and returns the
+// events in the event text notation.
+func parse(input []byte) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	tokens := make(chan yaml.Token)
+	tokenizeErrs := yaml.TokenizeReader(ctx, yaml.NewUTF8Reader(bytes.NewReader(input)), tokens)
+	events, parseErrs := yaml.TokensToEventsWithOptions(ctx, tokens, yaml.ParseOptions{Detailed: true})
+
+	var out strings.Builder
+	writer := yaml.NewEventTextWriter(&out)
+	var writeErr error
+	for event := range events {
+		if writeErr == nil {
+			writeErr = writer.Write(event)
+		}
+	}
+	// the tokenizer may still wait for the parser that has failed
+	cancel()
+	for range tokens {
+	}
+
+	for _, err := range []error{<-tokenizeErrs, <-parseErrs, writeErr} {
+		if err != nil && !errors.Is(err, context.Canceled) {
+			return "", err
+		}
+	}
+	return out.String(), nil
+}
+
+// checkJSON compares the converted input with in.json, which holds one JSON
+// value per document.
+func checkJSON(c Case) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	output, err := yamltojson.ConvertBytes(ctx, c.YAML, yamltojson.Options{MultiDocument: yaml.DocumentArray})
+	if err != nil {
+		return err
+	}
+	var got []any
+	if err := json.Unmarshal(output, &got); err != nil {
+		return fmt.Errorf("invalid JSON output %s: %w", output, err)
+	}
+
+	want := []any{}
+	decoder := json.NewDecoder(bytes.NewReader(c.JSON))
+	for {
+		var value any
+		err := decoder.Decode(&value)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("invalid in.json: %w", err)
+		}
+		want = append(want, value)
+	}
+	if !reflect.DeepEqual(got, want) {
+		return fmt.Errorf("expected the JSON\n%s\ngot\n%s", c.JSON, output)
+	}
+	return nil
+}
+
+// Result is the outcome of a case.
+type Result struct {
+	Case Case
+	Err  error
+}
+
+// Report summarizes the results per feature.
+type Report struct {
+	Results []Result
+}
+
+// RunAll runs all cases.
+func RunAll(cases []Case) Report {
+	report := Report{}
+	for _, c := range cases {
+		report.Results = append(report.Results, Result{Case: c, Err: Run(c)})
+	}
+	return report
+}
+
+// Passed returns the number of cases that passed.
+func (r Report) Passed() int {
+	passed := 0
+	for _, result := range r.Results {
+		if result.Err == nil {
+			passed++
+		}
+	}
+	return passed
+}
+
+// Percentage returns the share of the cases that passed, from 0 to 100.
+func (r Report) Percentage() float64 {
+	if len(r.Results) == 0 {
+		return 0
+	}
+	return 100 * float64(r.Passed()) / float64(len(r.Results))
+}
+
+// WriteTo writes the number of passed cases per feature and in total.
+func (r Report) WriteTo(w io.Writer) (int64, error) {
+	passed := map[string]int{}
+	total := map[string]int{}
+	for _, result := range r.Results {
+		features := result.Case.Features
+		if len(features) == 0 {
+			features = []string{"(none)"}
+		}
+		for _, feature := range features {
+			total[feature]++
+			if result.Err == nil {
+				passed[feature]++
+			}
+		}
+	}
+	features := make([]string, 0, len(total))
+	for feature := range total {
+		features = append(features, feature)
+	}
+	sort.Strings(features)
+
+	var out bytes.Buffer
+	for _, feature := range features {
+		fmt.Fprintf(&out, "%-16s %4d/%-4d %5.1f%%\n", feature, passed[feature], total[feature], 100*float64(passed[feature])/float64(total[feature]))
+	}
+	fmt.Fprintf(&out, "%-16s %4d/%-4d %5.1f%%\n", "total", r.Passed(), len(r.Results), r.Percentage())
+	return out.WriteTo(w)
+}
@@ -0,0 +1,64 @@
+package yamltestsuite
+
+import (
+	"flag"
+	"strings"
+	"testing"
+)
+
+// The snapshot in testdata is a subset of the yaml-test-suite: the examples
+// of chapter 2 of the spec except 2.19 to 2.23, an overview of the language,
+// whether the parser supports them or not, and the cases that were added along
+// with features and fixes. To run a full checkout of its data branch, pass its
+// directory:
+//
+//	go test ./internal/yamltestsuite -v -suite /path/to/yaml-test-suite
+var suiteDir = flag.String("suite", "testdata", "the directory with the yaml-test-suite cases")
+
+// minimumPassed is the number of snapshot cases that pass. Raise it when the
+// parser supports more of the spec, so that the conformance doesn't regress.
+const minimumPassed = 56
+
+func TestYAMLTestSuite(t *testing.T) {
+	cases, err := Load(*suiteDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cases) == 0 {
+		t.Fatalf("no cases in %s", *suiteDir)
+	}
+
+	report := RunAll(cases)
+	for _, result := range report.Results {
+		if result.Err != nil {
+			t.Logf("%s %s: %v", result.Case.ID, result.Case.Name, result.Err)
+		}
+	}
+	var summary strings.Builder
+	report.WriteTo(&summary)
+	t.Log("passed cases per feature:\n" + summary.String())
+
+	if *suiteDir == "testdata" && report.Passed() < minimumPassed {
+		t.Errorf("only %d cases passed, expected at least %d", report.Passed(), minimumPassed)
+	}
+}
+
+func TestLoad(t *testing.T) {
+	cases, err := Load("testdata")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range cases {
+		if c.ID != "D9TU" {
+			continue
+		}
+		if c.Name != "Single Pair Block Mapping" || string(c.YAML) != "foo: bar\n" || c.Error || c.JSON == nil {
+			t.Errorf("unexpected case %+v", c)
+		}
+		if len(c.Features) != 2 || c.Features[0] != "mapping" || c.Features[1] != "simple" {
+			t.Errorf("unexpected features %v", c.Features)
+		}
+		return
+	}
+	t.Error("the case D9TU is missing")
+}
@@ -0,0 +1,237 @@
+package json
+
+import (
+	"fmt"
+	"hbibel/yaml-to-json/common"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+)
+
+// Canonical JSON follows RFC 8785, https://www.rfc-editor.org/rfc/rfc8785.
+// The entries of a mapping can only be written once all of them are known, so
+// the JSON of each mapping is collected until the mapping ends, within the
+// mapping that encloses it, if any.
+
+// ErrBufferLimit is reported when the mappings that are held back for sorting
+// exceed RenderOptions.MaxBufferBytes. It is the same error as
+// yaml.ErrBufferLimit.
+var ErrBufferLimit = common.ErrBufferLimit
+
+type canonicalMapping struct {
+	entries []*canonicalEntry
+	// the number of bytes of the keys and the values
+	size int
+}
+
+type canonicalEntry struct {
+	key string
+	// the key as UTF-16 code units, which determine the order
+	units []uint16
+	value strings.Builder
+}
+
+// buffer returns a write function that adds to the value of the last entry of
+// the innermost held back mapping, or passes on to write if there is none.
+func (r *renderer) buffer(write func(string)) func(string) {
+	return func(s string) {
+		if len(r.mappings) == 0 {
+			write(s)
+			return
+		}
+		m := r.mappings[len(r.mappings)-1]
+		m.entries[len(m.entries)-1].value.WriteString(s)
+		m.size += len(s)
+		r.buffered += len(s)
+	}
+}
+
+func (r *renderer) renderCanonical(op common.Event) error {
+	if n := len(r.mappings); n > 0 && len(r.mappings[n-1].entries) == 0 &&
+		op.GetKind() != common.EMIT_KEY && op.GetKind() != common.END_MAPPING {
+		return fmt.Errorf("unexpected event %v in place of a key", op)
+	}
+
+	switch op.GetKind() {
+	case common.START_MAPPING:
+		r.depth++
+		r.mappings = append(r.mappings, &canonicalMapping{})
+	case common.EMIT_KEY:
+		if len(r.mappings) == 0 {
+			return fmt.Errorf("unexpected event %v", op)
+		}
+		m := r.mappings[len(r.mappings)-1]
+		key := op.(common.HasPayload).GetPayload()
+		m.entries = append(m.entries, &canonicalEntry{key: key, units: utf16.Encode([]rune(key))})
+		m.size += len(key)
+		r.buffered += len(key)
+	case common.END_MAPPING:
+		if len(r.mappings) == 0 {
+			return fmt.Errorf("unexpected event %v", op)
+		}
+		m := r.mappings[len(r.mappings)-1]
+		r.mappings = r.mappings[:len(r.mappings)-1]
+		r.buffered -= m.size
+		r.depth--
+		r.firstElement = false
+		mapping, err := m.render()
+		if err != nil {
+			return err
+		}
+		r.write(mapping)
+	case common.EMIT_VALUE:
+		value, err := canonicalValue(op)
+		if err != nil {
+			return err
+		}
+		r.write(value)
+	default:
+		if err := r.renderEvent(op); err != nil {
+			return err
+		}
+	}
+
+	if r.opts.MaxBufferBytes > 0 && r.buffered > r.opts.MaxBufferBytes {
+		return ErrBufferLimit
+	}
+	return nil
+}
+
+// render writes the entries of the mapping sorted by key.
+func (m *canonicalMapping) render() (string, error) {
+	sort.Slice(m.entries, func(i, j int) bool {
+		return compareUnits(m.entries[i].units, m.entries[j].units) < 0
+	})
+	var b strings.Builder
+	b.Grow(m.size + 4*len(m.entries) + 2)
+	b.WriteByte('{')
+	for i, entry := range m.entries {
+		if i > 0 {
+			if compareUnits(m.entries[i-1].units, entry.units) == 0 {
+				return "", fmt.Errorf("duplicate key %s in canonical JSON", canonicalQuote(entry.key))
+			}
+			b.WriteByte(',')
+		}
+		b.WriteString(canonicalQuote(entry.key))
+		b.WriteByte(':')
+		b.WriteString(entry.value.String())
+	}
+	b.WriteByte('}')
+	return b.String(), nil
+}
+
+func compareUnits(a, b []uint16) int {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if a[i] != b[i] {
+			return int(a[i]) - int(b[i])
+		}
+	}
+	return len(a) - len(b)
+}
+
+func canonicalValue(op common.Event) (string, error) {
+	withPayload := op.(common.HasPayload)
+	switch withPayload.GetPayLoadType() {
+	case common.STRING:
+		return canonicalQuote(withPayload.GetPayload()), nil
+	case common.NUMBER:
+		return canonicalNumber(withPayload.GetPayload())
+	case common.BOOLEAN:
+		return withPayload.GetPayload(), nil
+	case common.NULL:
+		return "null", nil
+	}
+	return "", fmt.Errorf("unknown payload type %d", withPayload.GetPayLoadType())
+}
+
+// canonicalNumber writes a number as an IEEE 754 double in the format of
+// ECMAScript's Number.prototype.toString, see
+// https://tc39.es/ecma262/#sec-numeric-types-number-tostring
+func canonicalNumber(s string) (string, error) {
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil || math.IsInf(v, 0) || math.IsNaN(v) {
+		return "", fmt.Errorf("number %s cannot be represented in canonical JSON", s)
+	}
+	if v == 0 {
+		// including -0
+		return "0", nil
+	}
+	sign := ""
+	if v < 0 {
+		sign = "-"
+		v = -v
+	}
+
+	// the shortest digits that identify v, and the position n of the
+	// decimal point relative to them
+	mantissa, exponent, _ := strings.Cut(strconv.FormatFloat(v, 'e', -1, 64), "e")
+	digits := strings.Replace(mantissa, ".", "", 1)
+	e, _ := strconv.Atoi(exponent)
+	n := e + 1
+	k := len(digits)
+
+	switch {
+	case k <= n && n <= 21:
+		return sign + digits + strings.Repeat("0", n-k), nil
+	case 0 < n && n <= 21:
+		return sign + digits[:n] + "." + digits[n:], nil
+	case -6 < n && n <= 0:
+		return sign + "0." + strings.Repeat("0", -n) + digits, nil
+	}
+	exponentSign := "+"
+	if n-1 < 0 {
+		exponentSign = "-"
+	}
+	exponent = exponentSign + strconv.Itoa(abs(n-1))
+	if k == 1 {
+		return sign + digits + "e" + exponent, nil
+	}
+	return sign + digits[:1] + "." + digits[1:] + "e" + exponent, nil
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+// canonicalQuote escapes only what JSON requires: quotes, backslashes and
+// control characters, with the short forms where there are some. Invalid
+// UTF-8 is replaced by U+FFFD.
+func canonicalQuote(s string) string {
+	var b strings.Builder
+	b.Grow(len(s) + 2)
+	b.WriteByte('"')
+	for _, c := range s {
+		switch c {
+		case '"':
+			b.WriteString(`\"`)
+		case '\\':
+			b.WriteString(`\\`)
+		case '\b':
+			b.WriteString(`\b`)
+		case '\f':
+			b.WriteString(`\f`)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\r':
+			b.WriteString(`\r`)
+		case '\t':
+			b.WriteString(`\t`)
+		default:
+			if c < 0x20 {
+				b.WriteString(`\u00`)
+				b.WriteByte(hexDigits[c>>4])
+				b.WriteByte(hexDigits[c&0xF])
+			} else {
+				// range yields utf8.RuneError for invalid bytes
+				b.WriteRune(c)
+			}
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
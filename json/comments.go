@@ -0,0 +1,87 @@
+package json
+
+import (
+	"hbibel/yaml-to-json/common"
+	"regexp"
+	"strings"
+)
+
+// JSONC and JSON5 allow the comments of JavaScript. A comment on the line of
+// a value stays there, after the comma that follows the value, and other
+// comments go on lines of their own before the next key or element.
+
+// identifier matches the keys that JSON5 allows without quotes. It is limited
+// to ASCII, which all JSON5 readers handle the same way.
+var identifier = regexp.MustCompile(`^[A-Za-z_$][A-Za-z0-9_$]*$`)
+
+// comment writes a comment or keeps it until its place is known.
+func (r *renderer) comment(e *common.CommentEvent) {
+	if !r.opts.Comments {
+		return
+	}
+	text := r.commentText(e.Text)
+	pretty := r.opts.Indent != ""
+	switch {
+	case r.depth == 0 && r.started:
+		// after the root value
+		if pretty && !e.Inline {
+			r.write("\n" + text)
+		} else {
+			r.write(" " + text)
+		}
+	case e.Inline && !pretty && r.started:
+		r.write(text)
+	case e.Inline && r.started && r.lineComment == "":
+		r.lineComment = text
+	default:
+		r.notes = append(r.notes, text)
+	}
+}
+
+func (r *renderer) commentText(text string) string {
+	if r.opts.Indent != "" {
+		return "//" + text
+	}
+	// a block comment ends at the first "*/"
+	return "/*" + strings.ReplaceAll(text, "*/", "* /") + " */"
+}
+
+// endLine adds the comment of the current line.
+func (r *renderer) endLine() {
+	if r.lineComment != "" {
+		r.write(" " + r.lineComment)
+		r.lineComment = ""
+	}
+}
+
+// writeNotes writes the comments and empty lines before an entry.
+func (r *renderer) writeNotes() {
+	for _, note := range r.notes {
+		if note == "" {
+			r.endLine()
+			r.write("\n")
+		} else {
+			r.newline()
+			r.write(note)
+		}
+	}
+	r.notes = r.notes[:0]
+}
+
+// startRoot writes the comments before the root value.
+func (r *renderer) startRoot() {
+	if r.depth > 0 || r.started {
+		return
+	}
+	r.started = true
+	for _, note := range r.notes {
+		if note == "" {
+			continue
+		}
+		r.write(note)
+		if r.opts.Indent != "" {
+			r.write("\n")
+		}
+	}
+	r.notes = r.notes[:0]
+}
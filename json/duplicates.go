@@ -0,0 +1,118 @@
+package json
+
+import (
+	"fmt"
+	"hash/maphash"
+	"hbibel/yaml-to-json/common"
+	"hbibel/yaml-to-json/yaml"
+)
+
+// The reader applies ReadOptions.DuplicateKeys like the YAML parser applies
+// yaml.ParseOptions.DuplicateKeys, so that both inputs convert the same way.
+// Writing all entries of a duplicate key would give YAML that the parser
+// rejects.
+
+// objectKeys remembers the keys of an object by a 64 bit hash, like the keys
+// of a YAML mapping.
+type objectKeys struct {
+	entries map[uint64]int
+	// the offsets of the entries in held, only for DuplicateKeyLastWins
+	starts []int
+}
+
+// openCollection starts tracking the keys of an array or object that was just
+// pushed to the stack. Its START event must be emitted next.
+func (r *reader) openCollection(c byte) {
+	var keys *objectKeys
+	if c == '{' {
+		keys = &objectKeys{entries: map[uint64]int{}}
+		if r.opts.DuplicateKeys == yaml.DuplicateKeyLastWins && r.holdDepth == 0 {
+			// earlier entries of a duplicate key can only be removed until
+			// they are passed on, so the outermost object is held back
+			r.holdDepth = len(r.stack)
+		}
+	}
+	r.keys = append(r.keys, keys)
+}
+
+// closeCollection stops tracking the innermost array or object, whose END
+// event has been emitted, and passes on the events that were held back for it.
+func (r *reader) closeCollection() {
+	depth := len(r.keys)
+	r.keys = r.keys[:depth-1]
+	if r.holdDepth == depth {
+		r.holdDepth = 0
+		for _, event := range r.held {
+			if event != nil {
+				r.queue = append(r.queue, event)
+			}
+		}
+		clear(r.held)
+		r.held = r.held[:0]
+		r.heldBytes = 0
+	}
+}
+
+// addKey records a key of the innermost object, which starts at line and
+// column, and applies the duplicate key policy. It must be called before the
+// key event is emitted.
+func (r *reader) addKey(key string, line, column int) error {
+	depth := len(r.keys)
+	if r.skipDepth == depth {
+		// the entry that was skipped is complete
+		r.skipDepth = 0
+	}
+
+	keys := r.keys[depth-1]
+	hash := maphash.String(r.seed, key)
+	index, duplicate := keys.entries[hash]
+	if r.opts.DuplicateKeys == yaml.DuplicateKeyLastWins {
+		keys.entries[hash] = len(keys.starts)
+		keys.starts = append(keys.starts, len(r.held))
+	} else if !duplicate {
+		keys.entries[hash] = 0
+	}
+	if !duplicate {
+		return nil
+	}
+
+	switch r.opts.DuplicateKeys {
+	case yaml.DuplicateKeyLastWins:
+		// the entry ends where the next one starts
+		removed := r.held[keys.starts[index]:keys.starts[index+1]]
+		for i, event := range removed {
+			if event != nil {
+				r.heldBytes -= eventSize(event)
+			}
+			removed[i] = nil
+		}
+	case yaml.DuplicateKeyFirstWins, yaml.DuplicateKeyWarn:
+		if r.opts.DuplicateKeys == yaml.DuplicateKeyWarn && r.opts.Warn != nil {
+			r.opts.Warn(errorAt(line, column, "duplicate key %q, keeping the first entry", key))
+		}
+		if r.skipDepth == 0 {
+			r.skipDepth = depth
+		}
+	default:
+		return errorAt(line, column, "duplicate key %q", key)
+	}
+	return nil
+}
+
+// checkHeldBytes fails if the object that is held back exceeds
+// MaxBufferBytes.
+func (r *reader) checkHeldBytes() error {
+	if r.opts.MaxBufferBytes > 0 && r.heldBytes > r.opts.MaxBufferBytes {
+		return fmt.Errorf("line %d: %w", r.line, common.ErrBufferLimit)
+	}
+	return nil
+}
+
+// eventSize estimates the memory of an event by the size of its JSON, like
+// the YAML parser does.
+func eventSize(event common.Event) int {
+	if e, ok := event.(common.HasPayload); ok {
+		return len(e.GetPayload()) + 1
+	}
+	return 1
+}
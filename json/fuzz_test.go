@@ -0,0 +1,137 @@
+package json
+
+import (
+	"context"
+	"encoding/json"
+	"hbibel/yaml-to-json/common"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+// Run the fuzz target with
+//
+//	go test ./json -run '^$' -fuzz FuzzRenderEvents
+//
+// Inputs that fail are written to testdata/fuzz, where they become part of
+// the seed corpus that every go test run checks.
+
+// FuzzRenderEvents renders a well-formed stream of events that is derived
+// from shape, with key and value as the content of the keys and strings. The
+// output must be valid JSON and decode to the value that the events describe.
+func FuzzRenderEvents(f *testing.F) {
+	f.Add([]byte{0}, "key", "value", false)
+	f.Add([]byte{4 + 6*2, 0, 1, 2}, "", "\"quoted\"\n", true)
+	f.Add([]byte{5 + 6*3, 4 + 6*1, 3, 5, 2, 4}, "\\", "\x00\x1f ", false)
+	f.Add([]byte{5 + 6*1, 5 + 6*1, 5 + 6*1, 5}, "k", "\xff", true)
+	f.Fuzz(func(t *testing.T, shape []byte, key string, value string, pretty bool) {
+		g := &eventGenerator{shape: shape, key: key, value: value}
+		expected := g.node(0)
+
+		opts := RenderOptions{}
+		if pretty {
+			opts.Indent = "\t"
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		events := make(chan common.Event)
+		go func() {
+			defer close(events)
+			for _, event := range g.events {
+				select {
+				case events <- event:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+		chunks, errc := RenderEventsWithOptions(ctx, events, opts)
+		var output strings.Builder
+		for chunk := range chunks {
+			output.WriteString(chunk)
+		}
+		if err := <-errc; err != nil {
+			t.Fatalf("the renderer failed or did not terminate: %v", err)
+		}
+
+		if !json.Valid([]byte(output.String())) {
+			t.Fatalf("invalid JSON %q for the events %v", output.String(), g.events)
+		}
+		if !utf8.ValidString(key) || !utf8.ValidString(value) {
+			// encoding/json replaces invalid UTF-8
+			return
+		}
+		var actual any
+		if err := json.Unmarshal([]byte(output.String()), &actual); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(actual, expected) {
+			t.Fatalf("expected %#v, got %#v from %q", expected, actual, output.String())
+		}
+	})
+}
+
+// eventGenerator turns bytes into the events of a single node, such that
+// mutations of the bytes lead to similar events.
+type eventGenerator struct {
+	shape      []byte
+	key, value string
+	events     []common.Event
+}
+
+const maxGeneratedDepth = 32
+
+var generatedNumbers = []string{"0", "42", "-7", "0.278", "-1.5e3", "1E-9"}
+
+// node appends the events of a node and returns the value that encoding/json
+// decodes its JSON to.
+func (g *eventGenerator) node(depth int) any {
+	b := byte(0)
+	if len(g.shape) > 0 {
+		b, g.shape = g.shape[0], g.shape[1:]
+	}
+	kind, size := b%6, int(b/6)%8
+	if depth == maxGeneratedDepth && kind >= 4 {
+		kind = 0
+	}
+
+	switch kind {
+	case 0:
+		g.events = append(g.events, common.NewStringEvent(g.value))
+		return g.value
+	case 1:
+		number := generatedNumbers[size%len(generatedNumbers)]
+		g.events = append(g.events, common.NewNumberEvent(number))
+		f, _ := strconv.ParseFloat(number, 64)
+		return f
+	case 2:
+		g.events = append(g.events, common.NewBooleanEvent(strconv.FormatBool(size%2 == 0)))
+		return size%2 == 0
+	case 3:
+		g.events = append(g.events, common.NewNullEvent())
+		return nil
+	case 4:
+		mapping := map[string]any{}
+		g.events = append(g.events, common.NewStartMappingEvent())
+		for i := 0; i < size; i++ {
+			// distinct keys, since encoding/json keeps only one of each
+			key := g.key + strconv.Itoa(i)
+			g.events = append(g.events, common.NewKeyEvent(key))
+			mapping[key] = g.node(depth + 1)
+		}
+		g.events = append(g.events, common.NewEndMappingEvent())
+		return mapping
+	default:
+		array := []any{}
+		g.events = append(g.events, common.NewStartArrayEvent())
+		for i := 0; i < size; i++ {
+			g.events = append(g.events, common.NewEmitElementEvent())
+			array = append(array, g.node(depth+1))
+		}
+		g.events = append(g.events, common.NewEndArrayEvent())
+		return array
+	}
+}
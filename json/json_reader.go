@@ -0,0 +1,676 @@
+package json
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"hash/maphash"
+	"hbibel/yaml-to-json/common"
+	"hbibel/yaml-to-json/yaml"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// ReadOptions configure ReadEventsWithOptions and ReadEventBatches. The zero
+// value reads a single JSON value without limits.
+type ReadOptions struct {
+	// MultiDocument determines what happens if the input contains more than
+	// one value, separated by whitespace like in JSON Lines. Each value is
+	// read like a YAML document.
+	MultiDocument yaml.MultiDocumentMode
+	// BatchSize is the maximum number of events that ReadEventBatches sends
+	// at once. If it is zero, yaml.DefaultBatchSize is used.
+	BatchSize int
+	// MaxInputBytes is the maximum size of the input, MaxDepth the maximum
+	// nesting depth of arrays and objects, and MaxScalarLength the maximum
+	// length of strings and numbers in bytes. Zero means unlimited in all
+	// cases.
+	MaxInputBytes   int
+	MaxDepth        int
+	MaxScalarLength int
+	// DuplicateKeys determines how objects with duplicate keys are read,
+	// like yaml.ParseOptions.DuplicateKeys. By default, they are an error.
+	// MaxBufferBytes limits the size of the object that
+	// yaml.DuplicateKeyLastWins holds back, and Warn receives the warnings
+	// of yaml.DuplicateKeyWarn.
+	DuplicateKeys  yaml.DuplicateKeyPolicy
+	MaxBufferBytes int
+	Warn           func(error)
+}
+
+// ReadEvents reads JSON from r and sends the same events to the returned
+// channel that the YAML parser produces for the equivalent YAML, so that they
+// can be rendered as YAML or reformatted as JSON. The input is read as a
+// stream: only the current string or number is held in memory, no matter how
+// large the arrays and objects are. Like the stages of the conversion
+// pipeline, it stops as soon as ctx is cancelled, and the error channel
+// yields at most one error.
+func ReadEvents(ctx context.Context, r io.Reader) (<-chan common.Event, <-chan error) {
+	return ReadEventsWithOptions(ctx, r, ReadOptions{})
+}
+
+// ReadEventsWithOptions is like ReadEvents, but allows to configure how
+// several values are read and to limit the input.
+func ReadEventsWithOptions(ctx context.Context, r io.Reader, opts ReadOptions) (<-chan common.Event, <-chan error) {
+	events := make(chan common.Event)
+	errc := make(chan error, 1)
+	go func() {
+		defer close(errc)
+		defer close(events)
+
+		jr := newReader(r, opts)
+		for {
+			event, err := jr.next()
+			if err == io.EOF {
+				return
+			}
+			if err != nil {
+				errc <- err
+				return
+			}
+			select {
+			case events <- event:
+			case <-ctx.Done():
+				errc <- ctx.Err()
+				return
+			}
+		}
+	}()
+	return events, errc
+}
+
+// ReadEventBatches is like ReadEventsWithOptions, but sends slices of events
+// instead of single events. The receiver owns the slices that are sent to it.
+// A batch is sent when it is full, or before reading more input would block,
+// so that slowly arriving input isn't held back.
+func ReadEventBatches(ctx context.Context, r io.Reader, opts ReadOptions) (<-chan []common.Event, <-chan error) {
+	batchSize := opts.BatchSize
+	if batchSize <= 0 {
+		batchSize = yaml.DefaultBatchSize
+	}
+	events := make(chan []common.Event)
+	errc := make(chan error, 1)
+	go func() {
+		defer close(errc)
+		defer close(events)
+
+		batch := make([]common.Event, 0, batchSize)
+		send := func() bool {
+			select {
+			case events <- batch:
+				batch = make([]common.Event, 0, batchSize)
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		}
+
+		jr := newReader(r, opts)
+		for {
+			event, err := jr.next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				errc <- err
+				return
+			}
+			batch = append(batch, event)
+			if (len(batch) == batchSize || jr.drained()) && !send() {
+				errc <- ctx.Err()
+				return
+			}
+		}
+		if len(batch) > 0 && !send() {
+			errc <- ctx.Err()
+		}
+	}()
+	return events, errc
+}
+
+// expectation is what the reader expects next, apart from whitespace.
+type expectation int
+
+const (
+	// a top-level value or the end of the input
+	expectRoot expectation = iota
+	// the first value of an array or "]"
+	expectFirstElement
+	// a value after "," in an array
+	expectElement
+	// the first key of an object or "}"
+	expectFirstKey
+	// a key after "," in an object
+	expectKey
+	expectColon
+	// a value after ":" in an object
+	expectValue
+	// "," or the end of the innermost array or object
+	expectCommaOrEnd
+	expectNothing
+)
+
+// reader is a pull parser for JSON. Each call of next returns the next event.
+type reader struct {
+	opts ReadOptions
+	r    *bufio.Reader
+	// the position of the next byte, counted in characters
+	line, column int
+	bytesRead    int
+
+	// the open arrays and objects as '[' and '{', innermost last
+	stack  []byte
+	expect expectation
+	roots  int
+	// events that have been read, but not returned yet
+	queue []common.Event
+
+	// the keys of the open objects, or nil for arrays, innermost last
+	keys []*objectKeys
+	seed maphash.Seed
+	// the depth of the object whose events are held back for
+	// DuplicateKeyLastWins, or 0, and the events and their estimated size
+	holdDepth int
+	held      []common.Event
+	heldBytes int
+	// the depth of the object whose current entry is dropped for a
+	// duplicate key, or 0
+	skipDepth int
+}
+
+func newReader(r io.Reader, opts ReadOptions) *reader {
+	return &reader{
+		opts:   opts,
+		r:      bufio.NewReader(r),
+		line:   1,
+		column: 1,
+		seed:   maphash.MakeSeed(),
+	}
+}
+
+// SyntaxError reports input that is not valid JSON, or that exceeds one of
+// the limits of ReadOptions.
+type SyntaxError struct {
+	// Line and Column locate the error in the input, both starting at 1.
+	Line   int
+	Column int
+	Msg    string
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("line %d, column %d: %s", e.Line, e.Column, e.Msg)
+}
+
+const endOfInput = "unexpected end of input"
+
+// errorf creates a SyntaxError at the position of the next byte.
+func (r *reader) errorf(format string, args ...any) error {
+	return errorAt(r.line, r.column, format, args...)
+}
+
+func errorAt(line, column int, format string, args ...any) error {
+	return &SyntaxError{Line: line, Column: column, Msg: fmt.Sprintf(format, args...)}
+}
+
+// peek returns the next byte without consuming it, or io.EOF. Once peek has
+// returned a byte, skip consumes it without errors.
+func (r *reader) peek() (byte, error) {
+	b, err := r.r.Peek(1)
+	if err != nil {
+		return 0, err
+	}
+	if err := r.checkInputLength(r.bytesRead + 1); err != nil {
+		return 0, err
+	}
+	return b[0], nil
+}
+
+func (r *reader) skip() {
+	r.readByte()
+}
+
+func (r *reader) checkInputLength(length int) error {
+	if r.opts.MaxInputBytes > 0 && length > r.opts.MaxInputBytes {
+		return r.errorf("the input is longer than %d bytes", r.opts.MaxInputBytes)
+	}
+	return nil
+}
+
+func (r *reader) readByte() (byte, error) {
+	b, err := r.r.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+	if err := r.checkInputLength(r.bytesRead + 1); err != nil {
+		return 0, err
+	}
+	r.bytesRead++
+	switch {
+	case b == '\n':
+		r.line++
+		r.column = 1
+	case b&0xc0 != 0x80:
+		// continuation bytes of UTF-8 are part of the previous character
+		r.column++
+	}
+	return b, nil
+}
+
+// skipWhitespace consumes whitespace and returns the next byte without
+// consuming it.
+func (r *reader) skipWhitespace() (byte, error) {
+	for {
+		b, err := r.peek()
+		if err != nil {
+			return 0, err
+		}
+		if b != ' ' && b != '\t' && b != '\n' && b != '\r' {
+			return b, nil
+		}
+		r.skip()
+	}
+}
+
+func (r *reader) next() (common.Event, error) {
+	for len(r.queue) == 0 {
+		if err := r.step(); err != nil {
+			return nil, err
+		}
+	}
+	event := r.queue[0]
+	r.queue = r.queue[1:]
+	return event, nil
+}
+
+// drained reports whether all events that were read have been returned and
+// no more input is buffered apart from whitespace, so that the next call of
+// next may block in a Read.
+func (r *reader) drained() bool {
+	if len(r.queue) > 0 {
+		return false
+	}
+	buffered, _ := r.r.Peek(r.r.Buffered())
+	return len(bytes.TrimLeft(buffered, " \t\r\n")) == 0
+}
+
+func (r *reader) emit(events ...common.Event) {
+	switch {
+	case r.skipDepth > 0:
+	case r.holdDepth > 0:
+		r.held = append(r.held, events...)
+		for _, event := range events {
+			r.heldBytes += eventSize(event)
+		}
+	default:
+		r.queue = append(r.queue, events...)
+	}
+}
+
+// step reads the next token and queues its events. It returns io.EOF after
+// the last event of the input.
+func (r *reader) step() error {
+	c, err := r.skipWhitespace()
+	if err == io.EOF {
+		return r.end()
+	}
+	if err != nil {
+		return err
+	}
+
+	switch r.expect {
+	case expectRoot:
+		if r.roots > 0 {
+			switch r.opts.MultiDocument {
+			case yaml.SingleDocument:
+				return r.errorf("the input contains more than one value")
+			case yaml.FirstDocument:
+				r.expect = expectNothing
+				return r.end()
+			}
+		}
+		if r.opts.MultiDocument == yaml.DocumentArray {
+			if r.roots == 0 {
+				r.emit(common.NewStartArrayEvent())
+			}
+			r.emit(common.NewEmitElementEvent())
+		}
+		r.roots++
+		return r.value(c)
+	case expectFirstElement, expectElement:
+		if c == ']' && r.expect == expectFirstElement {
+			return r.close(c)
+		}
+		r.emit(common.NewEmitElementEvent())
+		return r.value(c)
+	case expectFirstKey, expectKey:
+		if c == '}' && r.expect == expectFirstKey {
+			return r.close(c)
+		}
+		if c != '"' {
+			return r.unexpected(c, "a string as key")
+		}
+		line, column := r.line, r.column
+		key, err := r.string()
+		if err != nil {
+			return err
+		}
+		if err := r.addKey(key, line, column); err != nil {
+			return err
+		}
+		r.emit(common.NewKeyEvent(key))
+		r.expect = expectColon
+		return r.checkHeldBytes()
+	case expectColon:
+		if c != ':' {
+			return r.unexpected(c, `":"`)
+		}
+		r.skip()
+		r.expect = expectValue
+	case expectValue:
+		return r.value(c)
+	case expectCommaOrEnd:
+		top := r.stack[len(r.stack)-1]
+		switch {
+		case c == ',' && top == '[':
+			r.skip()
+			r.expect = expectElement
+		case c == ',':
+			r.skip()
+			r.expect = expectKey
+		case c == ']' && top == '[', c == '}' && top == '{':
+			return r.close(c)
+		case top == '[':
+			return r.unexpected(c, `"," or "]"`)
+		default:
+			return r.unexpected(c, `"," or "}"`)
+		}
+	case expectNothing:
+		return io.EOF
+	}
+	return nil
+}
+
+// end handles the end of the input.
+func (r *reader) end() error {
+	switch r.expect {
+	case expectRoot:
+		if r.roots == 0 && r.opts.MultiDocument != yaml.DocumentArray {
+			return r.errorf("the input contains no JSON value")
+		}
+		if r.opts.MultiDocument == yaml.DocumentArray {
+			if r.roots == 0 {
+				r.emit(common.NewStartArrayEvent())
+			}
+			r.emit(common.NewEndArrayEvent())
+			r.expect = expectNothing
+			return nil
+		}
+		return io.EOF
+	case expectNothing:
+		return io.EOF
+	}
+	return r.errorf(endOfInput)
+}
+
+func (r *reader) unexpected(c byte, expected string) error {
+	return r.errorf("unexpected %s, expected %s", describe(c), expected)
+}
+
+func describe(c byte) string {
+	if c >= ' ' && c < utf8.RuneSelf {
+		return strconv.QuoteRune(rune(c))
+	}
+	return fmt.Sprintf("byte 0x%02x", c)
+}
+
+// value reads a value that starts with c and queues its events.
+func (r *reader) value(c byte) error {
+	switch {
+	case c == '{' || c == '[':
+		if r.opts.MaxDepth > 0 && len(r.stack) >= r.opts.MaxDepth {
+			return r.errorf("the input is nested deeper than %d levels", r.opts.MaxDepth)
+		}
+		r.skip()
+		r.stack = append(r.stack, c)
+		r.openCollection(c)
+		if c == '{' {
+			r.emit(common.NewStartMappingEvent())
+			r.expect = expectFirstKey
+		} else {
+			r.emit(common.NewStartArrayEvent())
+			r.expect = expectFirstElement
+		}
+		return nil
+	case c == '"':
+		s, err := r.string()
+		if err != nil {
+			return err
+		}
+		r.emit(common.NewStringEvent(s))
+	case c == '-' || c >= '0' && c <= '9':
+		number, err := r.number()
+		if err != nil {
+			return err
+		}
+		r.emit(common.NewNumberEvent(number))
+	case c >= 'a' && c <= 'z':
+		line, column := r.line, r.column
+		word, err := r.word()
+		if err != nil {
+			return err
+		}
+		switch word {
+		case "true", "false":
+			r.emit(common.NewBooleanEvent(word))
+		case "null":
+			r.emit(common.NewNullEvent())
+		default:
+			return errorAt(line, column, "unexpected %q, expected a value", word)
+		}
+	default:
+		return r.unexpected(c, "a value")
+	}
+	r.valueDone()
+	return r.checkHeldBytes()
+}
+
+// close reads the end of the innermost array or object.
+func (r *reader) close(c byte) error {
+	r.skip()
+	r.stack = r.stack[:len(r.stack)-1]
+	if r.skipDepth == len(r.keys) {
+		// the end of the object isn't part of the skipped entry
+		r.skipDepth = 0
+	}
+	if c == '}' {
+		r.emit(common.NewEndMappingEvent())
+	} else {
+		r.emit(common.NewEndArrayEvent())
+	}
+	r.closeCollection()
+	r.valueDone()
+	return nil
+}
+
+func (r *reader) valueDone() {
+	if len(r.stack) == 0 {
+		r.expect = expectRoot
+	} else {
+		r.expect = expectCommaOrEnd
+	}
+}
+
+func (r *reader) checkScalarLength(length int) error {
+	if r.opts.MaxScalarLength > 0 && length > r.opts.MaxScalarLength {
+		return r.errorf("a scalar is longer than %d bytes", r.opts.MaxScalarLength)
+	}
+	return nil
+}
+
+// word reads a sequence of lowercase letters, the start of true, false or
+// null.
+func (r *reader) word() (string, error) {
+	var b strings.Builder
+	for {
+		c, err := r.peek()
+		if err == io.EOF || err == nil && (c < 'a' || c > 'z') {
+			return b.String(), nil
+		}
+		if err != nil {
+			return "", err
+		}
+		if b.Len() >= len("false") {
+			return "", r.errorf("unexpected %q, expected a value", b.String()+string(c))
+		}
+		r.skip()
+		b.WriteByte(c)
+	}
+}
+
+var numberPattern = regexp.MustCompile(`^-?(0|[1-9][0-9]*)(\.[0-9]+)?([eE][-+]?[0-9]+)?$`)
+
+// number reads a number and returns it as it is written.
+func (r *reader) number() (string, error) {
+	line, column := r.line, r.column
+	var b strings.Builder
+	for {
+		c, err := r.peek()
+		if err == io.EOF || err == nil && !strings.ContainsRune("0123456789+-.eE", rune(c)) {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+		r.skip()
+		b.WriteByte(c)
+		if err := r.checkScalarLength(b.Len()); err != nil {
+			return "", err
+		}
+	}
+	if !numberPattern.MatchString(b.String()) {
+		return "", errorAt(line, column, "invalid number %q", b.String())
+	}
+	return b.String(), nil
+}
+
+// string reads a quoted string and returns its value. Invalid UTF-8 is
+// replaced by U+FFFD, like encoding/json does.
+func (r *reader) string() (string, error) {
+	r.skip()
+	var b strings.Builder
+	for {
+		if err := r.checkScalarLength(b.Len()); err != nil {
+			return "", err
+		}
+		c, err := r.readByte()
+		if err == io.EOF {
+			return "", r.errorf(endOfInput + " in a string")
+		}
+		if err != nil {
+			return "", err
+		}
+		switch {
+		case c == '"':
+			s := b.String()
+			if !utf8.ValidString(s) {
+				s = strings.ToValidUTF8(s, "\uFFFD")
+			}
+			return s, nil
+		case c == '\\':
+			if err := r.escape(&b); err != nil {
+				return "", err
+			}
+		case c < ' ':
+			return "", r.errorf("unexpected %s in a string", describe(c))
+		default:
+			b.WriteByte(c)
+		}
+	}
+}
+
+// escape reads an escape sequence after the backslash.
+func (r *reader) escape(b *strings.Builder) error {
+	c, err := r.readByte()
+	if err == io.EOF {
+		return r.errorf(endOfInput + " in a string")
+	}
+	if err != nil {
+		return err
+	}
+	switch c {
+	case '"', '\\', '/':
+		b.WriteByte(c)
+	case 'b':
+		b.WriteByte('\b')
+	case 'f':
+		b.WriteByte('\f')
+	case 'n':
+		b.WriteByte('\n')
+	case 'r':
+		b.WriteByte('\r')
+	case 't':
+		b.WriteByte('\t')
+	case 'u':
+		r1, err := r.hex4()
+		if err != nil {
+			return err
+		}
+		if utf16.IsSurrogate(r1) {
+			// the second half of a surrogate pair must follow
+			if next, err := r.r.Peek(2); err == nil && string(next) == `\u` {
+				r.skip()
+				r.skip()
+				r2, err := r.hex4()
+				if err != nil {
+					return err
+				}
+				if combined := utf16.DecodeRune(r1, r2); combined != utf8.RuneError {
+					b.WriteRune(combined)
+					return nil
+				}
+				b.WriteRune(utf8.RuneError)
+				r1 = r2
+				if utf16.IsSurrogate(r1) {
+					r1 = utf8.RuneError
+				}
+			} else {
+				r1 = utf8.RuneError
+			}
+		}
+		b.WriteRune(r1)
+	default:
+		return r.errorf("invalid escape sequence %s", strconv.Quote(`\`+string(rune(c))))
+	}
+	return nil
+}
+
+func (r *reader) hex4() (rune, error) {
+	var value rune
+	for i := 0; i < 4; i++ {
+		c, err := r.readByte()
+		if err == io.EOF {
+			return 0, r.errorf(endOfInput + " in a string")
+		}
+		if err != nil {
+			return 0, err
+		}
+		var digit byte
+		switch {
+		case c >= '0' && c <= '9':
+			digit = c - '0'
+		case c >= 'a' && c <= 'f':
+			digit = c - 'a' + 10
+		case c >= 'A' && c <= 'F':
+			digit = c - 'A' + 10
+		default:
+			return 0, r.errorf("invalid character %s in a \\u escape sequence", describe(c))
+		}
+		value = value<<4 | rune(digit)
+	}
+	return value, nil
+}
@@ -0,0 +1,210 @@
+package json
+
+import (
+	"context"
+	"hbibel/yaml-to-json/common"
+	"hbibel/yaml-to-json/internal/leaktest"
+	"hbibel/yaml-to-json/yaml"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestReadScalars(t *testing.T) {
+	tests := map[string]common.Event{
+		`"foo"`:                common.NewStringEvent("foo"),
+		`42`:                   common.NewNumberEvent("42"),
+		`-0.5e+10`:             common.NewNumberEvent("-0.5e+10"),
+		` true `:               common.NewBooleanEvent("true"),
+		"false\n":              common.NewBooleanEvent("false"),
+		`null`:                 common.NewNullEvent(),
+		`"a\"\\\/\n"`:          common.NewStringEvent("a\"\\/\n"),
+		`"\u00e4\ud83d\ude00"`: common.NewStringEvent("ä😀"),
+		`"\ud83d"`:             common.NewStringEvent("\uFFFD"),
+		"\"\xff\"":             common.NewStringEvent("\uFFFD"),
+	}
+	for input, expected := range tests {
+		runReadTest(t, input, ReadOptions{}, []common.Event{expected})
+	}
+}
+
+func TestReadCollections(t *testing.T) {
+	input := `{"data": [{"name": "John", "age": 30}, [], {}], "ok": true}`
+	expected := []common.Event{
+		common.NewStartMappingEvent(),
+		common.NewKeyEvent("data"),
+		common.NewStartArrayEvent(),
+		common.NewEmitElementEvent(),
+		common.NewStartMappingEvent(),
+		common.NewKeyEvent("name"),
+		common.NewStringEvent("John"),
+		common.NewKeyEvent("age"),
+		common.NewNumberEvent("30"),
+		common.NewEndMappingEvent(),
+		common.NewEmitElementEvent(),
+		common.NewStartArrayEvent(),
+		common.NewEndArrayEvent(),
+		common.NewEmitElementEvent(),
+		common.NewStartMappingEvent(),
+		common.NewEndMappingEvent(),
+		common.NewEndArrayEvent(),
+		common.NewKeyEvent("ok"),
+		common.NewBooleanEvent("true"),
+		common.NewEndMappingEvent(),
+	}
+	runReadTest(t, input, ReadOptions{}, expected)
+}
+
+func TestReadMultipleValues(t *testing.T) {
+	input := "{\"a\": 1}\n[2]\n"
+	runReadTest(t, input, ReadOptions{MultiDocument: yaml.FirstDocument}, []common.Event{
+		common.NewStartMappingEvent(),
+		common.NewKeyEvent("a"),
+		common.NewNumberEvent("1"),
+		common.NewEndMappingEvent(),
+	})
+	runReadTest(t, input, ReadOptions{MultiDocument: yaml.DocumentArray}, []common.Event{
+		common.NewStartArrayEvent(),
+		common.NewEmitElementEvent(),
+		common.NewStartMappingEvent(),
+		common.NewKeyEvent("a"),
+		common.NewNumberEvent("1"),
+		common.NewEndMappingEvent(),
+		common.NewEmitElementEvent(),
+		common.NewStartArrayEvent(),
+		common.NewEmitElementEvent(),
+		common.NewNumberEvent("2"),
+		common.NewEndArrayEvent(),
+		common.NewEndArrayEvent(),
+	})
+	runReadTest(t, "", ReadOptions{MultiDocument: yaml.DocumentArray}, []common.Event{
+		common.NewStartArrayEvent(),
+		common.NewEndArrayEvent(),
+	})
+}
+
+func TestReadErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		opts     ReadOptions
+		expected string
+	}{
+		{"", ReadOptions{}, "line 1, column 1: the input contains no JSON value"},
+		{"[1,]", ReadOptions{}, `line 1, column 4: unexpected ']', expected a value`},
+		{"[1 2]", ReadOptions{}, `line 1, column 4: unexpected '2', expected "," or "]"`},
+		{"{\n  \"a\" 1}", ReadOptions{}, `line 2, column 7: unexpected '1', expected ":"`},
+		{"{1: 2}", ReadOptions{}, `line 1, column 2: unexpected '1', expected a string as key`},
+		{`{"a": 1]`, ReadOptions{}, `line 1, column 8: unexpected ']', expected "," or "}"`},
+		{"[tru]", ReadOptions{}, `line 1, column 2: unexpected "tru", expected a value`},
+		{"01", ReadOptions{}, `line 1, column 1: invalid number "01"`},
+		{`"a`, ReadOptions{}, "line 1, column 3: unexpected end of input in a string"},
+		{"\"a\tb\"", ReadOptions{}, "line 1, column 4: unexpected byte 0x09 in a string"},
+		{`"\x"`, ReadOptions{}, `line 1, column 4: invalid escape sequence "\\x"`},
+		{"[1", ReadOptions{}, "line 1, column 3: unexpected end of input"},
+		{"1 2", ReadOptions{}, "line 1, column 3: the input contains more than one value"},
+		{"[[1]]", ReadOptions{MaxDepth: 1}, "line 1, column 2: the input is nested deeper than 1 levels"},
+		{`"abcdef"`, ReadOptions{MaxScalarLength: 3}, "line 1, column 6: a scalar is longer than 3 bytes"},
+		{"[1, 2, 3]", ReadOptions{MaxInputBytes: 4}, "line 1, column 5: the input is longer than 4 bytes"},
+	}
+	for _, test := range tests {
+		_, err := read(test.input, test.opts)
+		if err == nil || err.Error() != test.expected {
+			t.Errorf("%q: expected error %q, got %v", test.input, test.expected, err)
+		}
+	}
+}
+
+// hugeArray produces a JSON array with n elements without holding it in
+// memory.
+type hugeArray struct {
+	n, written int
+	pending    string
+}
+
+func (h *hugeArray) Read(p []byte) (int, error) {
+	if h.pending == "" {
+		switch {
+		case h.written == 0:
+			h.pending = `["element"`
+		case h.written < h.n:
+			h.pending = `, "element"`
+		case h.written == h.n:
+			h.pending = "]"
+		default:
+			return 0, io.EOF
+		}
+		h.written++
+	}
+	n := copy(p, h.pending)
+	h.pending = h.pending[n:]
+	return n, nil
+}
+
+func TestReadHugeArray(t *testing.T) {
+	const n = 100000
+	events, errc := ReadEventBatches(context.Background(), &hugeArray{n: n}, ReadOptions{})
+	count := 0
+	for batch := range events {
+		count += len(batch)
+	}
+	if err := <-errc; err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	if expected := 2*n + 2; count != expected {
+		t.Errorf("Expected %d events, got %d", expected, count)
+	}
+}
+
+func TestReadEventsCancelled(t *testing.T) {
+	defer leaktest.Check(t)()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	events, errc := ReadEvents(ctx, strings.NewReader("[1, 2, 3]"))
+	<-events
+	cancel()
+	for range events {
+	}
+	if err := <-errc; err != context.Canceled {
+		t.Errorf("Expected %v, got %v", context.Canceled, err)
+	}
+}
+
+func TestReadAndRender(t *testing.T) {
+	input := "{ \"a\" : [1, \"\\u0041\", null],\n \"b\": {} }"
+	events, readErrc := ReadEvents(context.Background(), strings.NewReader(input))
+	chunks, renderErrc := RenderEventsWithOptions(context.Background(), events, RenderOptions{})
+	var b strings.Builder
+	for chunk := range chunks {
+		b.WriteString(chunk)
+	}
+	if err := <-readErrc; err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	if err := <-renderErrc; err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	if expected := `{"a":[1,"A",null],"b":{}}`; b.String() != expected {
+		t.Errorf("Expected %s, got %s", expected, b.String())
+	}
+}
+
+func runReadTest(t *testing.T, input string, opts ReadOptions, expected []common.Event) {
+	t.Helper()
+	actual, err := read(input, opts)
+	if err != nil {
+		t.Fatalf("%q: unexpected error: %v", input, err)
+	}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("%q: expected %v, got %v", input, expected, actual)
+	}
+}
+
+func read(input string, opts ReadOptions) ([]common.Event, error) {
+	events, errc := ReadEventsWithOptions(context.Background(), strings.NewReader(input), opts)
+	var result []common.Event
+	for event := range events {
+		result = append(result, event)
+	}
+	return result, <-errc
+}
@@ -1,64 +1,411 @@
 package json
 
 import (
+	"context"
+	"fmt"
 	"hbibel/yaml-to-json/common"
+	"hbibel/yaml-to-json/internal/pipeline"
+	"strings"
 )
 
 func RenderEvents(events <-chan common.Event) <-chan string {
+	output, _ := RenderEventsContext(context.Background(), events)
+	return output
+}
+
+// RenderEventsContext is like RenderEvents, but stops as soon as ctx is
+// cancelled or an event cannot be rendered. The output channel is closed in
+// any case. After an error, the remaining events are received and discarded
+// until their channel is closed, so that the stage before doesn't block even
+// if ctx isn't cancelled. The returned error channel yields at most one error
+// and is closed when the renderer goroutine has exited.
+func RenderEventsContext(ctx context.Context, events <-chan common.Event) (<-chan string, <-chan error) {
+	return RenderEventsWithOptions(ctx, events, RenderOptions{})
+}
+
+// RenderOptions configure RenderEventsWithOptions. The zero value renders
+// compact JSON.
+type RenderOptions struct {
+	// Indent is repeated once per nesting level at the start of each line. If
+	// it is empty, the output is rendered on a single line.
+	Indent string
+	// NDJSON writes newline-delimited JSON: each element of a top-level
+	// sequence, or each top-level value if there are several, is written as
+	// a compact line of its own, without the enclosing array. Indent is
+	// ignored. RenderEventBatches sends each line as soon as it is complete.
+	NDJSON bool
+	// Canonical writes the JSON Canonicalization Scheme of RFC 8785, which
+	// is byte-stable for signing and hashing: the keys of each mapping are
+	// sorted by their UTF-16 code units, numbers are written like
+	// ECMAScript does, and strings are escaped minimally. Indent is
+	// ignored. Each mapping is held back until it ends.
+	Canonical bool
+	// MaxBufferBytes limits the memory for the mappings that Canonical holds
+	// back. Exceeding it fails with ErrBufferLimit. Zero means unlimited.
+	MaxBufferBytes int
+	// Comments writes COMMENT events as JSONC comments: "// ..." on the line
+	// of the value before them or on lines of their own before the next key
+	// or element, or "/* ... */" if the output is compact. Empty lines are
+	// kept as well.
+	Comments bool
+	// JSON5 writes keys that are identifiers without quotes, and a comma
+	// after the last entry of a collection that spans several lines.
+	JSON5 bool
+}
+
+// RenderEventsWithOptions is like RenderEventsContext, but allows to configure
+// the output format.
+func RenderEventsWithOptions(ctx context.Context, events <-chan common.Event, opts RenderOptions) (<-chan string, <-chan error) {
 	output := make(chan string)
+	errc := make(chan error, 1)
 	go func() {
-		firstElement := true
-		for op := range events {
-			switch op.GetKind() {
-			case common.START_MAPPING:
-				firstElement = true
-				output <- "{"
-			case common.EMIT_KEY:
-				if !firstElement {
-					output <- ","
+		defer close(errc)
+		defer pipeline.Drain(ctx, events)
+		defer close(output)
+
+		var chunks []string
+		r := newRenderer(opts, func(chunk string) {
+			chunks = append(chunks, chunk)
+		})
+
+		for {
+			var op common.Event
+			var ok bool
+			select {
+			case op, ok = <-events:
+			case <-ctx.Done():
+				errc <- ctx.Err()
+				return
+			}
+			if !ok {
+				return
+			}
+
+			chunks = chunks[:0]
+			if err := r.render(op); err != nil {
+				errc <- err
+				return
+			}
+			for _, chunk := range chunks {
+				select {
+				case output <- chunk:
+				case <-ctx.Done():
+					errc <- ctx.Err()
+					return
+				}
+			}
+		}
+	}()
+	return output, errc
+}
+
+// RenderEventBatches is like RenderEventsWithOptions, but receives slices of
+// events and sends the JSON for each slice as a single chunk. The receiver
+// owns the chunks that are sent to it.
+func RenderEventBatches(ctx context.Context, events <-chan []common.Event, opts RenderOptions) (<-chan []byte, <-chan error) {
+	output := make(chan []byte)
+	errc := make(chan error, 1)
+	go func() {
+		defer close(errc)
+		defer pipeline.Drain(ctx, events)
+		defer close(output)
+
+		var chunk []byte
+		r := newRenderer(opts, func(s string) {
+			chunk = append(chunk, s...)
+		})
+		send := func() bool {
+			select {
+			case output <- chunk:
+			case <-ctx.Done():
+				errc <- ctx.Err()
+				return false
+			}
+			// the chunk belongs to the receiver now
+			chunk = make([]byte, 0, 2*len(chunk))
+			return true
+		}
+
+		for {
+			var batch []common.Event
+			var ok bool
+			select {
+			case batch, ok = <-events:
+			case <-ctx.Done():
+				errc <- ctx.Err()
+				return
+			}
+			if !ok {
+				break
+			}
+
+			for _, op := range batch {
+				if err := r.render(op); err != nil {
+					errc <- err
+					return
 				}
-				firstElement = false
-				output <- renderAsKey(op)
-				output <- ":"
-			case common.EMIT_VALUE:
-				output <- renderAsValue(op)
-			case common.END_MAPPING:
-				firstElement = false
-				output <- "}"
-			case common.START_ARRAY:
-				firstElement = true
-				output <- "["
-			case common.EMIT_ELEMENT:
-				if !firstElement {
-					output <- ","
+				if r.lineEnded && !send() {
+					return
 				}
-				firstElement = false
-			case common.END_ARRAY:
-				firstElement = false
-				output <- "]"
+				r.lineEnded = false
 			}
+			// lines of NDJSON are only sent when they are complete
+			if !opts.NDJSON && len(chunk) > 0 && !send() {
+				return
+			}
+		}
+		if len(chunk) > 0 {
+			send()
 		}
-		close(output)
 	}()
-	return output
+	return output, errc
 }
 
-// TODO escape special characters
-func renderAsKey(op common.Event) string {
-	return "\"" + op.(common.HasPayload).GetPayload() + "\""
+// renderer holds the state needed to render a stream of events. It passes the
+// JSON for each event to write.
+type renderer struct {
+	opts  RenderOptions
+	write func(string)
+
+	firstElement bool
+	depth        int
+	colon        string
+
+	// whether the elements of a top-level sequence are written as lines of
+	// NDJSON, and whether the event that was just rendered ended a line
+	unwrapped bool
+	lineEnded bool
+
+	// the mappings that are held back in canonical mode, innermost last,
+	// and the number of bytes they hold
+	mappings []*canonicalMapping
+	buffered int
+
+	// the comments and empty lines ("") before the next key or element, the
+	// comment at the end of the current line, and whether the root value
+	// has started
+	notes       []string
+	lineComment string
+	started     bool
+}
+
+func newRenderer(opts RenderOptions, write func(string)) *renderer {
+	if opts.NDJSON || opts.Canonical {
+		opts.Indent = ""
+	}
+	colon := ":"
+	if opts.Indent != "" {
+		colon = ": "
+	}
+	r := &renderer{
+		opts:         opts,
+		write:        write,
+		firstElement: true,
+		colon:        colon,
+	}
+	if opts.Canonical {
+		r.write = r.buffer(write)
+	}
+	return r
 }
 
-func renderAsValue(op common.Event) string {
+func (r *renderer) newline() {
+	if r.opts.Indent != "" {
+		r.endLine()
+		r.write("\n" + strings.Repeat(r.opts.Indent, r.depth))
+	}
+}
+
+func (r *renderer) render(op common.Event) error {
+	if r.opts.NDJSON && r.unwrap(op) {
+		return nil
+	}
+	var err error
+	if r.opts.Canonical {
+		err = r.renderCanonical(op)
+	} else {
+		err = r.renderEvent(op)
+	}
+	if err != nil {
+		return err
+	}
+
+	if r.opts.NDJSON && r.valueEnds(op) {
+		r.write("\n")
+		r.lineEnded = true
+	}
+	return nil
+}
+
+func (r *renderer) renderEvent(op common.Event) error {
+	switch op.GetKind() {
+	case common.START_MAPPING:
+		r.startRoot()
+		r.firstElement = true
+		r.depth++
+		r.write("{")
+	case common.EMIT_KEY:
+		r.startEntry()
+		r.write(r.renderKey(op))
+		r.write(r.colon)
+	case common.EMIT_VALUE:
+		r.startRoot()
+		value, err := renderAsValue(op)
+		if err != nil {
+			return err
+		}
+		r.write(value)
+	case common.END_MAPPING:
+		r.endCollection()
+		r.write("}")
+	case common.START_ARRAY:
+		r.startRoot()
+		r.firstElement = true
+		r.depth++
+		r.write("[")
+	case common.EMIT_ELEMENT:
+		r.startEntry()
+	case common.END_ARRAY:
+		r.endCollection()
+		r.write("]")
+	case common.ALIAS:
+		return fmt.Errorf("aliases must be expanded before they can be rendered as JSON")
+	case common.COMMENT:
+		r.comment(op.(*common.CommentEvent))
+	case common.BLANK_LINE:
+		if r.opts.Comments && r.opts.Indent != "" && (len(r.notes) == 0 || r.notes[len(r.notes)-1] != "") {
+			r.notes = append(r.notes, "")
+		}
+	}
+	// stream and document events don't affect the JSON output
+	return nil
+}
+
+// startEntry ends the previous entry of a collection and starts a line for
+// the next one, after the comments that precede it.
+func (r *renderer) startEntry() {
+	if !r.firstElement {
+		r.write(",")
+	}
+	r.firstElement = false
+	r.writeNotes()
+	r.newline()
+}
+
+// endCollection ends the last entry of a collection and the line before its
+// closing bracket.
+func (r *renderer) endCollection() {
+	// firstElement is still set if the collection is empty
+	if !r.firstElement && r.opts.JSON5 && r.opts.Indent != "" {
+		r.write(",")
+	}
+	if len(r.notes) > 0 {
+		r.writeNotes()
+		r.firstElement = false
+	}
+	r.depth--
+	if !r.firstElement {
+		r.newline()
+	}
+	r.firstElement = false
+}
+
+func (r *renderer) renderKey(op common.Event) string {
+	key := op.(common.HasPayload).GetPayload()
+	if r.opts.JSON5 && identifier.MatchString(key) {
+		return key
+	}
+	return quote(key)
+}
+
+// unwrap handles the events of a top-level sequence in NDJSON mode, whose
+// elements are written as lines instead of as an array. It returns false for
+// all other events.
+func (r *renderer) unwrap(op common.Event) bool {
+	switch {
+	case op.GetKind() == common.START_ARRAY && r.depth == 0:
+		r.unwrapped = true
+		r.depth++
+	case op.GetKind() == common.EMIT_ELEMENT && r.unwrapped && r.depth == 1:
+	case op.GetKind() == common.END_ARRAY && r.unwrapped && r.depth == 1:
+		r.unwrapped = false
+		r.depth--
+	default:
+		return false
+	}
+	return true
+}
+
+// valueEnds reports whether op completes a line of NDJSON.
+func (r *renderer) valueEnds(op common.Event) bool {
+	lineDepth := 0
+	if r.unwrapped {
+		lineDepth = 1
+	}
+	switch op.GetKind() {
+	case common.EMIT_VALUE, common.END_MAPPING, common.END_ARRAY:
+		return r.depth == lineDepth
+	}
+	return false
+}
+
+func renderAsValue(op common.Event) (string, error) {
 	withPayload := op.(common.HasPayload)
 	switch withPayload.GetPayLoadType() {
 	case common.STRING:
-		return "\"" + withPayload.GetPayload() + "\""
+		return quote(withPayload.GetPayload()), nil
 	case common.NUMBER:
-		return string(withPayload.GetPayload())
+		return string(withPayload.GetPayload()), nil
 	case common.BOOLEAN:
-		return withPayload.GetPayload()
+		return withPayload.GetPayload(), nil
 	case common.NULL:
-		return "null"
+		return "null", nil
+	}
+	return "", fmt.Errorf("unknown payload type %d", withPayload.GetPayLoadType())
+}
+
+const hexDigits = "0123456789abcdef"
+
+// quote renders s as a JSON string, escaping the characters that JSON doesn't
+// allow in strings.
+func quote(s string) string {
+	needsEscaping := false
+	for i := 0; i < len(s); i++ {
+		if s[i] < 0x20 || s[i] == '"' || s[i] == '\\' {
+			needsEscaping = true
+			break
+		}
+	}
+	if !needsEscaping {
+		return "\"" + s + "\""
+	}
+
+	sb := strings.Builder{}
+	sb.Grow(len(s) + 8)
+	sb.WriteByte('"')
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch c {
+		case '"':
+			sb.WriteString(`\"`)
+		case '\\':
+			sb.WriteString(`\\`)
+		case '\n':
+			sb.WriteString(`\n`)
+		case '\r':
+			sb.WriteString(`\r`)
+		case '\t':
+			sb.WriteString(`\t`)
+		default:
+			if c < 0x20 {
+				sb.WriteString(`\u00`)
+				sb.WriteByte(hexDigits[c>>4])
+				sb.WriteByte(hexDigits[c&0xF])
+			} else {
+				sb.WriteByte(c)
+			}
+		}
 	}
-	panic("unknown payload type")
+	sb.WriteByte('"')
+	return sb.String()
 }
@@ -1,8 +1,11 @@
 package json
 
 import (
+	"context"
 	"hbibel/yaml-to-json/common"
+	"hbibel/yaml-to-json/internal/leaktest"
 	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -52,6 +55,23 @@ func TestNullEvent(t *testing.T) {
 	runTest(t, events, expected)
 }
 
+func TestEscapedStrings(t *testing.T) {
+	events := []common.Event{
+		common.NewStartMappingEvent(),
+		common.NewKeyEvent("a\"b"),
+		common.NewStringEvent("line\nbreak\t\\ \x01 ä"),
+		common.NewEndMappingEvent(),
+	}
+	expected := []string{
+		"{",
+		`"a\"b"`,
+		":",
+		`"line\nbreak\t\\ \u0001 ä"`,
+		"}",
+	}
+	runTest(t, events, expected)
+}
+
 func TestMapping(t *testing.T) {
 	events := []common.Event{
 		common.NewStartMappingEvent(),
@@ -75,6 +95,62 @@ func TestMapping(t *testing.T) {
 	runTest(t, events, expected)
 }
 
+func TestDetailedEvents(t *testing.T) {
+	events := []common.Event{
+		common.NewStreamStartEvent(),
+		common.NewDocumentStartEvent(true),
+		&common.CollectionEvent{Kind: common.START_MAPPING, Anchor: "m"},
+		&common.EventWithPayload{Kind: common.EMIT_KEY, PayloadType: common.STRING, Payload: "foo", Style: common.DOUBLE_QUOTED},
+		&common.EventWithPayload{Kind: common.EMIT_VALUE, PayloadType: common.STRING, Payload: "1", Tag: "tag:yaml.org,2002:str"},
+		common.NewEndMappingEvent(),
+		common.NewDocumentEndEvent(false),
+		common.NewStreamEndEvent(),
+	}
+	expected := []string{
+		"{",
+		"\"foo\"",
+		":",
+		"\"1\"",
+		"}",
+	}
+	runTest(t, events, expected)
+}
+
+func TestAliasEventError(t *testing.T) {
+	defer leaktest.Check(t)()
+
+	events := make(chan common.Event, 1)
+	events <- common.NewAliasEvent("a")
+	close(events)
+	chunks, errc := RenderEventsContext(context.Background(), events)
+	for range chunks {
+	}
+	if err := <-errc; err == nil {
+		t.Error("Expected an error")
+	}
+}
+
+func TestRenderErrorDrainsEvents(t *testing.T) {
+	defer leaktest.Check(t)()
+
+	// the sender is blocked on an unbuffered channel unless the renderer
+	// keeps receiving after it failed
+	events := make(chan []common.Event)
+	go func() {
+		defer close(events)
+		events <- []common.Event{common.NewAliasEvent("a")}
+		for i := 0; i < 1000; i++ {
+			events <- []common.Event{common.NewNullEvent()}
+		}
+	}()
+	chunks, errc := RenderEventBatches(context.Background(), events, RenderOptions{})
+	for range chunks {
+	}
+	if err := <-errc; err == nil {
+		t.Error("Expected an error")
+	}
+}
+
 func TestArray(t *testing.T) {
 	events := []common.Event{
 		common.NewStartArrayEvent(),
@@ -140,11 +216,171 @@ func TestArrayOfMappings(t *testing.T) {
 	runTest(t, events, expected)
 }
 
+func TestIndentedNestedCollections(t *testing.T) {
+	events := []common.Event{
+		common.NewStartMappingEvent(),
+		common.NewKeyEvent("foo"),
+		common.NewStartArrayEvent(),
+		common.NewEmitElementEvent(),
+		common.NewNumberEvent("1"),
+		common.NewEndArrayEvent(),
+		common.NewKeyEvent("bar"),
+		common.NewStartMappingEvent(),
+		common.NewEndMappingEvent(),
+		common.NewEndMappingEvent(),
+	}
+	expected := []string{
+		"{",
+		"\n  ",
+		"\"foo\"",
+		": ",
+		"[",
+		"\n    ",
+		"1",
+		"\n  ",
+		"]",
+		",",
+		"\n  ",
+		"\"bar\"",
+		": ",
+		"{",
+		"}",
+		"\n",
+		"}",
+	}
+	runTestWithOptions(t, events, expected, RenderOptions{Indent: "  "})
+}
+
+func TestRenderEventBatches(t *testing.T) {
+	batches := make(chan []common.Event, 2)
+	batches <- []common.Event{
+		common.NewStartArrayEvent(),
+		common.NewEmitElementEvent(),
+		common.NewStringEvent("foo"),
+	}
+	batches <- []common.Event{
+		common.NewEmitElementEvent(),
+		common.NewNumberEvent("42"),
+		common.NewEndArrayEvent(),
+	}
+	close(batches)
+
+	chunks, errc := RenderEventBatches(context.Background(), batches, RenderOptions{})
+	actual := []string{}
+	for chunk := range chunks {
+		actual = append(actual, string(chunk))
+	}
+	if err := <-errc; err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	expected := []string{`["foo"`, `,42]`}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Error("Expected", expected, "got", actual)
+	}
+}
+
+func TestNDJSON(t *testing.T) {
+	events := []common.Event{
+		common.NewStartArrayEvent(),
+		common.NewEmitElementEvent(),
+		common.NewStartMappingEvent(),
+		common.NewKeyEvent("a"),
+		common.NewStartArrayEvent(),
+		common.NewEmitElementEvent(),
+		common.NewNumberEvent("1"),
+		common.NewEndArrayEvent(),
+		common.NewEndMappingEvent(),
+		common.NewEmitElementEvent(),
+		common.NewStringEvent("b"),
+		common.NewEndArrayEvent(),
+	}
+	expected := []string{"{", "\"a\"", ":", "[", "1", "]", "}", "\n", "\"b\"", "\n"}
+	runTestWithOptions(t, events, expected, RenderOptions{NDJSON: true, Indent: "  "})
+
+	// a top-level value that isn't a sequence is a single line
+	events = []common.Event{common.NewStartMappingEvent(), common.NewEndMappingEvent()}
+	runTestWithOptions(t, events, []string{"{", "}", "\n"}, RenderOptions{NDJSON: true})
+}
+
+func TestRenderEventBatchesNDJSON(t *testing.T) {
+	batches := make(chan []common.Event, 2)
+	batches <- []common.Event{
+		common.NewStartArrayEvent(),
+		common.NewEmitElementEvent(),
+		common.NewStringEvent("foo"),
+		common.NewEmitElementEvent(),
+		common.NewStartMappingEvent(),
+	}
+	batches <- []common.Event{
+		common.NewKeyEvent("a"),
+		common.NewNullEvent(),
+		common.NewEndMappingEvent(),
+		common.NewEmitElementEvent(),
+		common.NewNumberEvent("42"),
+		common.NewEndArrayEvent(),
+	}
+	close(batches)
+
+	chunks, errc := RenderEventBatches(context.Background(), batches, RenderOptions{NDJSON: true})
+	actual := []string{}
+	for chunk := range chunks {
+		actual = append(actual, string(chunk))
+	}
+	if err := <-errc; err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	// every line is sent on its own as soon as it is complete
+	expected := []string{"\"foo\"\n", "{\"a\":null}\n", "42\n"}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Error("Expected", expected, "got", actual)
+	}
+}
+
+func TestRenderEventsContextCancelled(t *testing.T) {
+	defer leaktest.Check(t)()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	events := make(chan common.Event)
+
+	output, errc := RenderEventsContext(ctx, events)
+
+	// nobody reads the output, so the renderer blocks on its first send
+	events <- common.NewStartMappingEvent()
+	cancel()
+
+	if err := <-errc; err != context.Canceled {
+		t.Errorf("Expected %v, got %v", context.Canceled, err)
+	}
+	if _, ok := <-output; ok {
+		t.Error("Expected output channel to be closed")
+	}
+}
+
+func TestRenderEventsContextUnknownPayloadType(t *testing.T) {
+	defer leaktest.Check(t)()
+
+	events := make(chan common.Event, 1)
+	events <- &common.EventWithPayload{Kind: common.EMIT_VALUE, PayloadType: -1}
+	close(events)
+
+	output, errc := RenderEventsContext(context.Background(), events)
+	for range output {
+	}
+	if err := <-errc; err == nil {
+		t.Error("Expected an error")
+	}
+}
+
 func runTest(t *testing.T, events []common.Event, expectedChunks []string) {
+	runTestWithOptions(t, events, expectedChunks, RenderOptions{})
+}
+
+func runTestWithOptions(t *testing.T, events []common.Event, expectedChunks []string, opts RenderOptions) {
+	t.Helper()
 	eventsChannel := make(chan common.Event)
 	done := make(chan bool)
 
-	chunkChannel := RenderEvents(eventsChannel)
+	chunkChannel, _ := RenderEventsWithOptions(context.Background(), eventsChannel, opts)
 	var chunks = make([]string, 0)
 	go func() {
 		for chunk := range chunkChannel {
@@ -163,3 +399,162 @@ func runTest(t *testing.T, events []common.Event, expectedChunks []string) {
 		t.Error("Expected", expectedChunks, "got", chunks)
 	}
 }
+
+func TestCanonical(t *testing.T) {
+	// the example of RFC 8785, section 3.2.3
+	events := []common.Event{
+		common.NewStartMappingEvent(),
+		common.NewKeyEvent("€"),
+		common.NewStringEvent("Euro Sign"),
+		common.NewKeyEvent("\r"),
+		common.NewStringEvent("Carriage Return"),
+		common.NewKeyEvent("\ufb33"),
+		common.NewStringEvent("Hebrew Letter Dalet With Dagesh"),
+		common.NewKeyEvent("1"),
+		common.NewStringEvent("One"),
+		common.NewKeyEvent("\U0001f600"),
+		common.NewStringEvent("Emoji: Grinning Face"),
+		common.NewKeyEvent("\u0080"),
+		common.NewStringEvent("Control"),
+		common.NewKeyEvent("ö"),
+		common.NewStringEvent("Latin Small Letter O With Diaeresis"),
+		common.NewKeyEvent("nested"),
+		common.NewStartArrayEvent(),
+		common.NewEmitElementEvent(),
+		common.NewStartMappingEvent(),
+		common.NewKeyEvent("b"),
+		common.NewBooleanEvent("true"),
+		common.NewKeyEvent("a"),
+		common.NewNullEvent(),
+		common.NewEndMappingEvent(),
+		common.NewEmitElementEvent(),
+		common.NewStringEvent("\x08\x0c\x1f "),
+		common.NewEndArrayEvent(),
+		common.NewEndMappingEvent(),
+	}
+	expected := `{"\r":"Carriage Return","1":"One","nested":[{"a":null,"b":true},"\b\f\u001f` + " " + `"],"` +
+		"\u0080" + `":"Control","ö":"Latin Small Letter O With Diaeresis","€":"Euro Sign","😀":"Emoji: Grinning Face","` + "\ufb33" + `":"Hebrew Letter Dalet With Dagesh"}`
+	actual := strings.Join(renderChunks(t, events, RenderOptions{Canonical: true, Indent: "  "}), "")
+	if actual != expected {
+		t.Errorf("Expected %s, got %s", expected, actual)
+	}
+}
+
+func TestCanonicalNumbers(t *testing.T) {
+	tests := map[string]string{
+		"0":                        "0",
+		"-0.0":                     "0",
+		"2.50":                     "2.5",
+		"1e20":                     "100000000000000000000",
+		"1e21":                     "1e+21",
+		"0.000001":                 "0.000001",
+		"1e-7":                     "1e-7",
+		"-1.5e-10":                 "-1.5e-10",
+		"123456789012345678901234": "1.2345678901234569e+23",
+		"333333333.33333329":       "333333333.3333333",
+		"9007199254740993":         "9007199254740992",
+		"4.35":                     "4.35",
+	}
+	for number, expected := range tests {
+		actual, err := canonicalNumber(number)
+		if err != nil || actual != expected {
+			t.Errorf("%s: expected %s, got %s (%v)", number, expected, actual, err)
+		}
+	}
+	if _, err := canonicalNumber("1e400"); err == nil {
+		t.Error("Expected an error for a number out of range")
+	}
+}
+
+func TestCanonicalErrors(t *testing.T) {
+	tests := map[string][]common.Event{
+		"duplicate key": {
+			common.NewStartMappingEvent(),
+			common.NewKeyEvent("a"),
+			common.NewNumberEvent("1"),
+			common.NewKeyEvent("a"),
+			common.NewNumberEvent("2"),
+			common.NewEndMappingEvent(),
+		},
+		"buffer limit": {
+			common.NewStartMappingEvent(),
+			common.NewKeyEvent("a"),
+			common.NewStringEvent("a long value"),
+			common.NewEndMappingEvent(),
+		},
+	}
+	for name, events := range tests {
+		func() {
+			defer leaktest.Check(t)()
+
+			input := make(chan common.Event, len(events))
+			for _, event := range events {
+				input <- event
+			}
+			close(input)
+			output, errc := RenderEventsWithOptions(context.Background(), input, RenderOptions{Canonical: true, MaxBufferBytes: 10})
+			for range output {
+			}
+			err := <-errc
+			if err == nil || (name == "buffer limit") != (err == ErrBufferLimit) {
+				t.Errorf("%s: unexpected error %v", name, err)
+			}
+		}()
+	}
+}
+
+func TestComments(t *testing.T) {
+	events := []common.Event{
+		common.NewCommentEvent(" header", false),
+		common.NewStartMappingEvent(),
+		common.NewKeyEvent("a"),
+		common.NewNumberEvent("1"),
+		common.NewCommentEvent(" one", true),
+		common.NewBlankLineEvent(),
+		common.NewCommentEvent(" before b", false),
+		common.NewKeyEvent("b-c"),
+		common.NewStartArrayEvent(),
+		common.NewEmitElementEvent(),
+		common.NewStringEvent("x"),
+		common.NewCommentEvent(" last */", false),
+		common.NewEndArrayEvent(),
+		common.NewEndMappingEvent(),
+		common.NewCommentEvent(" footer", false),
+	}
+	tests := []struct {
+		opts     RenderOptions
+		expected string
+	}{
+		{RenderOptions{}, `{"a":1,"b-c":["x"]}`},
+		{RenderOptions{Comments: true}, `/* header */{"a":1/* one */,/* before b */"b-c":["x"/* last * / */]} /* footer */`},
+		{RenderOptions{Comments: true, Indent: "  "}, "// header\n{\n  \"a\": 1, // one\n\n  // before b\n  \"b-c\": [\n    \"x\"\n    // last */\n  ]\n}\n// footer"},
+		{RenderOptions{Comments: true, JSON5: true, Indent: "  "}, "// header\n{\n  a: 1, // one\n\n  // before b\n  \"b-c\": [\n    \"x\",\n    // last */\n  ],\n}\n// footer"},
+	}
+	for _, test := range tests {
+		actual := strings.Join(renderChunks(t, events, test.opts), "")
+		if actual != test.expected {
+			t.Errorf("%+v: expected %q, got %q", test.opts, test.expected, actual)
+		}
+	}
+}
+
+// renderChunks returns the chunks that RenderEventsWithOptions sends for the
+// events.
+func renderChunks(t *testing.T, events []common.Event, opts RenderOptions) []string {
+	t.Helper()
+	input := make(chan common.Event, len(events))
+	for _, event := range events {
+		input <- event
+	}
+	close(input)
+
+	output, errc := RenderEventsWithOptions(context.Background(), input, opts)
+	chunks := []string{}
+	for chunk := range output {
+		chunks = append(chunks, chunk)
+	}
+	if err := <-errc; err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	return chunks
+}
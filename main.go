@@ -2,63 +2,169 @@ package main
 
 import (
 	"bufio"
+	"context"
+	"flag"
 	"fmt"
-	"hbibel/yaml-to-json/json"
 	"hbibel/yaml-to-json/yaml"
+	"hbibel/yaml-to-json/yamltojson"
+	"io"
 	"log"
 	"os"
+	"strings"
 )
 
-type Config struct {
-}
-
 func main() {
-	yamlFilePath := "test.yaml"
-	jsonFilePath := "test.json"
-	var err error
+	log.SetFlags(0)
+	if len(os.Args) > 1 && (os.Args[1] == "tokens" || os.Args[1] == "events") {
+		if err := runDebugCommand(os.Args[1], os.Args[2:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "fmt" {
+		if err := runFmtCommand(os.Args[2:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags] [FILE]\n", os.Args[0])
+		fmt.Fprintf(flag.CommandLine.Output(), "       %s tokens|events [FILE]\n", os.Args[0])
+		fmt.Fprintf(flag.CommandLine.Output(), "       %s fmt [flags] [FILE...]\n\n", os.Args[0])
+		fmt.Fprintln(flag.CommandLine.Output(), "Converts the YAML FILE (or stdin) to JSON, or prints its tokens or parser events.")
+		fmt.Fprintln(flag.CommandLine.Output(), "With -from and -to, it also converts JSON to YAML or reformats JSON or YAML.")
+		fmt.Fprintln(flag.CommandLine.Output(), "fmt rewrites YAML files in place with a consistent layout, see fmt -h.")
+		fmt.Fprintln(flag.CommandLine.Output())
+		flag.PrintDefaults()
+	}
+
+	outputPath := flag.String("o", "", "write the output to this file instead of stdout")
+	from := flag.String("from", "yaml", "the format of the input: yaml or json")
+	to := flag.String("to", "json", "the format of the output: json, jsonc (with the comments of YAML input), json5 or yaml")
+	ndjson := flag.Bool("ndjson", false, "write each element of a top-level sequence, or each document, as a compact line of JSON")
+	canonical := flag.Bool("canonical", false, "write canonical JSON (RFC 8785) with sorted keys, for signing and hashing")
+	maxBufferBytes := flag.Int("max-buffer-bytes", 0, "fail if -canonical or -duplicate-keys last-wins hold back a mapping of more than this many bytes (0 means unlimited)")
+	indent := flag.Int("indent", 0, "pretty-print the JSON with this many spaces per level, or indent YAML by this many spaces (default 2)")
+	schema := flag.String("schema", "core", "how to resolve plain scalars: core, json, failsafe or yaml1.1")
+	multiDoc := flag.String("multi-doc", "single", "how to convert several documents: single, first or array")
+	duplicateKeys := flag.String("duplicate-keys", "error", "how to handle duplicate mapping keys: error, last-wins, first-wins or warn")
+	maxLineLength := flag.Int("max-line-length", 0, "fail on input lines longer than this many bytes (0 means unlimited)")
+	maxInputBytes := flag.Int("max-input-bytes", 0, "fail on input larger than this many bytes (0 means unlimited)")
+	maxDepth := flag.Int("max-depth", 0, "fail on collections nested deeper than this (0 means unlimited)")
+	maxScalarLength := flag.Int("max-scalar-length", 0, "fail on scalars longer than this many bytes (0 means unlimited)")
+	maxEvents := flag.Int("max-events", 0, "fail on input with more than this many parser events (0 means unlimited)")
+	maxAliasExpansions := flag.Int("max-alias-expansions", 0, "fail if aliases expand to more than this many parser events (0 means 1000000, negative means unlimited)")
+	flag.Parse()
 
-	_, err = os.Stat(jsonFilePath)
-	if err != nil && !os.IsNotExist(err) {
+	opts := yamltojson.Options{
+		Indent:             strings.Repeat(" ", *indent),
+		NDJSON:             *ndjson,
+		Canonical:          *canonical,
+		MaxBufferBytes:     *maxBufferBytes,
+		MaxLineLength:      *maxLineLength,
+		MaxInputBytes:      *maxInputBytes,
+		MaxDepth:           *maxDepth,
+		MaxScalarLength:    *maxScalarLength,
+		MaxEvents:          *maxEvents,
+		MaxAliasExpansions: *maxAliasExpansions,
+		Warn: func(err error) {
+			log.Print("warning: ", err)
+		},
+	}
+	var err error
+	if opts.Input, err = parseInputFormat(*from); err != nil {
+		log.Fatal(err)
+	}
+	if opts.Output, err = parseOutputFormat(*to); err != nil {
+		log.Fatal(err)
+	}
+	if opts.Schema, err = parseSchema(*schema); err != nil {
 		log.Fatal(err)
-	} else if err == nil {
-		err = os.Remove(jsonFilePath)
+	}
+	if opts.MultiDocument, err = parseMultiDocumentMode(*multiDoc); err != nil {
+		log.Fatal(err)
+	}
+	if opts.DuplicateKeys, err = parseDuplicateKeyPolicy(*duplicateKeys); err != nil {
+		log.Fatal(err)
+	}
+
+	var input io.Reader = os.Stdin
+	switch flag.NArg() {
+	case 0:
+	case 1:
+		inputFile, err := os.Open(flag.Arg(0))
 		if err != nil {
 			log.Fatal(err)
 		}
+		defer inputFile.Close()
+		input = inputFile
+	default:
+		flag.Usage()
+		os.Exit(2)
 	}
 
-	yamlFile, err := os.Open(yamlFilePath)
-	if err != nil {
-		log.Fatal(err)
+	var output io.Writer = os.Stdout
+	if *outputPath != "" {
+		outputFile, err := os.Create(*outputPath)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer outputFile.Close()
+		output = outputFile
 	}
-	defer yamlFile.Close()
 
-	jsonFile, err := os.Create(jsonFilePath)
+	writer := bufio.NewWriter(output)
+	err = yamltojson.Convert(context.Background(), input, writer, opts)
+	if err == nil {
+		err = writer.Flush()
+	}
 	if err != nil {
 		log.Fatal(err)
 	}
-	defer jsonFile.Close()
+}
+
+func parseInputFormat(s string) (yamltojson.InputFormat, error) {
+	for _, format := range []yamltojson.InputFormat{yamltojson.YAMLInput, yamltojson.JSONInput} {
+		if s == format.String() {
+			return format, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown input format '%s'", s)
+}
 
-	var tokens chan yaml.Token = make(chan yaml.Token)
-	var lines chan string = make(chan string)
-	yaml.Tokenize(lines, tokens)
-	events := yaml.TokensToEvents(tokens)
-	jsonChunks := json.RenderEvents(events)
+func parseOutputFormat(s string) (yamltojson.OutputFormat, error) {
+	for _, format := range []yamltojson.OutputFormat{yamltojson.JSONOutput, yamltojson.JSONCOutput, yamltojson.JSON5Output, yamltojson.YAMLOutput} {
+		if s == format.String() {
+			return format, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown output format '%s'", s)
+}
 
-	outDone := make(chan bool)
-	go func() {
-		writer := bufio.NewWriter(jsonFile)
-		for chunk := range jsonChunks {
-			fmt.Fprint(writer, chunk)
+func parseSchema(s string) (yaml.Schema, error) {
+	for _, schema := range []yaml.Schema{yaml.CoreSchema, yaml.JSONSchema, yaml.FailsafeSchema, yaml.YAML11Schema} {
+		if s == schema.String() {
+			return schema, nil
 		}
-		writer.Flush()
-		outDone <- true
-	}()
+	}
+	return 0, fmt.Errorf("unknown schema '%s'", s)
+}
 
-	scanner := bufio.NewScanner(yamlFile)
-	for scanner.Scan() {
-		lines <- scanner.Text()
+func parseMultiDocumentMode(s string) (yaml.MultiDocumentMode, error) {
+	for _, mode := range []yaml.MultiDocumentMode{yaml.SingleDocument, yaml.FirstDocument, yaml.DocumentArray} {
+		if s == mode.String() {
+			return mode, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown multi-document mode '%s'", s)
+}
+
+func parseDuplicateKeyPolicy(s string) (yaml.DuplicateKeyPolicy, error) {
+	for _, policy := range []yaml.DuplicateKeyPolicy{yaml.DuplicateKeyError, yaml.DuplicateKeyLastWins, yaml.DuplicateKeyFirstWins, yaml.DuplicateKeyWarn} {
+		if s == policy.String() {
+			return policy, nil
+		}
 	}
-	close(lines)
-	<-outDone
+	return 0, fmt.Errorf("unknown duplicate key policy '%s'", s)
 }
@@ -0,0 +1,353 @@
+package yaml
+
+import (
+	"hbibel/yaml-to-json/common"
+	"math"
+	"strings"
+)
+
+// JSON has no references, so aliases are expanded: the events of an anchored
+// node are recorded, and each alias emits them again. An alias within an
+// anchored node is recorded as a reference to the node it refers to, so that
+// nested aliases don't multiply the memory for the recorded events.
+
+// anchorNode is the recorded content of an anchored node.
+type anchorNode struct {
+	// the events of the node, where aliases are aliasRefs
+	events []common.Event
+	// the number of events with all aliases expanded, which saturates at
+	// math.MaxInt
+	size int
+}
+
+// aliasRef stands for the events of an aliased node in the events of another
+// anchored node. It is never emitted.
+type aliasRef struct {
+	common.Event
+	node *anchorNode
+}
+
+// expand appends the events of the node to events, with all aliases expanded.
+func (n *anchorNode) expand(events []common.Event) []common.Event {
+	for _, event := range n.events {
+		switch event := event.(type) {
+		case nil:
+			// removed for a duplicate key
+		case aliasRef:
+			events = event.node.expand(events)
+		default:
+			events = append(events, event)
+		}
+	}
+	return events
+}
+
+// addSize adds numbers of events, which grow exponentially with nested
+// aliases, without overflowing.
+func addSize(a, b int) int {
+	if a > math.MaxInt-b {
+		return math.MaxInt
+	}
+	return a + b
+}
+
+// recorder collects the events of an anchored node.
+type recorder struct {
+	name string
+	// the number of breadcrumbs while the anchored collection is open, or 0
+	// for a scalar, which consists of a single event
+	depth int
+	node  anchorNode
+	// the offset of the first event of the node, and where aliases were
+	// recorded, to find the events that a duplicate key removes
+	start   int
+	aliases []recordedAlias
+	// whether the node started in an entry that is skipped for a duplicate
+	// key, whose events are then recorded although they aren't passed on
+	inSkip bool
+}
+
+// recordedAlias is an alias in the events of a recorder.
+type recordedAlias struct {
+	index int
+	size  int
+}
+
+// records reports whether the recorder takes events that are emitted now. The
+// events of an entry with a duplicate key that is skipped don't belong to the
+// nodes around it.
+func (r *recorder) records(p *parser) bool {
+	return p.skipDepth == 0 || r.inSkip
+}
+
+// index returns the index in the recorded events of the event that was
+// emitted at offset, which must not be part of an alias.
+func (r *recorder) index(offset int) int {
+	i := offset - r.start
+	for _, alias := range r.aliases {
+		if alias.index >= i {
+			break
+		}
+		i -= alias.size - 1
+	}
+	return i
+}
+
+// remove drops the recorded events that were emitted between the offsets
+// start and end, like removeEvents.
+func (r *recorder) remove(start, end int) {
+	if start < r.start {
+		return
+	}
+	events := r.node.events[r.index(start):r.index(end)]
+	for i, event := range events {
+		switch event := event.(type) {
+		case nil:
+		case aliasRef:
+			r.node.size -= event.node.size
+		default:
+			r.node.size--
+		}
+		events[i] = nil
+	}
+}
+
+// keepsAliases reports whether aliases are passed on as AliasEvents instead
+// of being expanded.
+func (p *parser) keepsAliases() bool {
+	return p.opts.Detailed && !p.expandAliases
+}
+
+// properties are the tag and the anchor of a node.
+type properties struct {
+	tag    string
+	anchor string
+}
+
+// parseProperties splits a tag like "!!str" and an anchor like "&name" off the
+// start of the tokens, in any order. It returns the properties with the tag
+// expanded, the tokens after them and the column at which these start.
+func (p *parser) parseProperties(tokens []Token, column int) (properties, []Token, int, error) {
+	var props properties
+	for len(tokens) > 0 && tokens[0].Kind() == WORD {
+		word := tokens[0].String()
+		if !strings.HasPrefix(word, "!") && !strings.HasPrefix(word, "&") {
+			break
+		}
+		end := 0
+		for end < len(tokens) && tokens[end].Kind() != SPACE {
+			end++
+		}
+		property := tokensToString(tokens[:end])
+
+		if property[0] == '!' {
+			if props.tag != "" {
+				return props, nil, 0, p.syntaxError(column, "a node can only have one tag")
+			}
+			tag, err := p.expandTag(property)
+			if err != nil {
+				return props, nil, 0, p.syntaxError(column, "%v", err)
+			}
+			props.tag = tag
+		} else {
+			if props.anchor != "" {
+				return props, nil, 0, p.syntaxError(column, "a node can only have one anchor")
+			}
+			if len(property) == 1 {
+				return props, nil, 0, p.syntaxError(column, "an anchor needs a name")
+			}
+			props.anchor = property[1:]
+		}
+		tokens, column = skipSpaces(tokens[end:], column+tokensWidth(tokens[:end]))
+	}
+	return props, tokens, column, nil
+}
+
+// setPendingProperties stores properties in pendingTag and pendingAnchor,
+// where they wait for the node that they belong to.
+func (p *parser) setPendingProperties(props properties, column int) error {
+	if props.tag != "" {
+		if p.pendingTag != "" {
+			return p.syntaxError(column, "a node can only have one tag")
+		}
+		p.pendingTag = props.tag
+	}
+	if props.anchor != "" {
+		if p.pendingAnchor != "" {
+			return p.syntaxError(column, "a node can only have one anchor")
+		}
+		p.pendingAnchor = props.anchor
+	}
+	return nil
+}
+
+// startValue parses a node that doesn't start a block collection, which is
+// an alias, an empty flow collection or a scalar.
+func (p *parser) startValue(tokens []Token, column int) error {
+	if isAlias(tokens) {
+		return p.expandAlias(tokens, column)
+	}
+	if nt, ok := emptyFlowCollection(tokens); ok {
+		return p.emptyCollection(nt, column)
+	}
+	return p.startScalar(tokens, column)
+}
+
+func isAlias(tokens []Token) bool {
+	return tokens[0].Kind() == WORD && strings.HasPrefix(tokens[0].String(), "*")
+}
+
+// expandAlias emits the events of the node that an alias refers to.
+func (p *parser) expandAlias(tokens []Token, column int) error {
+	if p.pendingTag != "" || p.pendingAnchor != "" {
+		return p.syntaxError(column, "an alias cannot have a tag or an anchor")
+	}
+	if !isBlank(tokens[1:]) {
+		return p.syntaxError(column+tokenWidth(tokens[0]), "unexpected content after an alias")
+	}
+	alias := tokens[0].String()
+	node, err := p.resolveAlias(alias, column)
+	if err != nil {
+		return err
+	}
+	p.pendingValue = false
+	if p.keepsAliases() {
+		p.emit(&common.AliasEvent{Anchor: alias[1:], Position: p.position(column)})
+		return nil
+	}
+	for _, r := range p.recording {
+		if r.records(p) {
+			r.aliases = append(r.aliases, recordedAlias{len(r.node.events), node.size})
+			r.node.events = append(r.node.events, aliasRef{node: node})
+			r.node.size = addSize(r.node.size, node.size)
+		}
+	}
+	p.pass(node.expand(nil))
+	return nil
+}
+
+// resolveAlias returns the node that an alias like "*name" refers to, which
+// is nil for detailed events. It enforces the limits on alias expansions and
+// events before the events of the node are emitted.
+func (p *parser) resolveAlias(alias string, column int) (*anchorNode, error) {
+	node, ok := p.anchors[alias[1:]]
+	if !ok {
+		return nil, p.syntaxError(column, "the alias %s refers to an unknown anchor", alias)
+	}
+	if p.keepsAliases() {
+		return nil, nil
+	}
+	p.aliasEvents = addSize(p.aliasEvents, node.size)
+	if limit := p.opts.maxAliasExpansions(); limit > 0 && p.aliasEvents > limit {
+		return nil, p.limitError(ErrTooManyAliasExpansions)
+	}
+	if p.opts.MaxEvents > 0 && addSize(p.eventCount, node.size) > p.opts.MaxEvents {
+		return nil, p.limitError(ErrTooManyEvents)
+	}
+	return node, nil
+}
+
+// aliasKey returns the event of a mapping key that is an alias like "*name",
+// and the key that identifies it for the duplicate key detection. The alias must
+// refer to a scalar unless events are detailed.
+func (p *parser) aliasKey(alias string, column int) (common.Event, string, error) {
+	node, err := p.resolveAlias(alias, column)
+	if err != nil {
+		return nil, "", err
+	}
+	if p.keepsAliases() {
+		return &common.AliasEvent{Anchor: alias[1:], Position: p.position(column)}, alias, nil
+	}
+	var scalar common.HasPayload
+	ok := node.size == 1
+	if ok {
+		scalar, ok = node.events[0].(common.HasPayload)
+	}
+	if !ok {
+		return nil, "", p.syntaxError(column, "the alias %s refers to a collection, which cannot be a mapping key", alias)
+	}
+	key := p.keyEvent(scalar.GetPayload(), common.PLAIN, properties{}, column)
+	return key, scalar.GetPayload(), nil
+}
+
+// keyEvent creates the EMIT_KEY event for a key with the given style and
+// properties, which starts at column.
+func (p *parser) keyEvent(key string, style common.ScalarStyle, props properties, column int) common.Event {
+	if !p.opts.Detailed {
+		return common.NewKeyEvent(key)
+	}
+	return &common.EventWithPayload{
+		Kind:        common.EMIT_KEY,
+		PayloadType: common.STRING,
+		Payload:     key,
+		Source:      key,
+		Style:       style,
+		Tag:         props.tag,
+		Anchor:      props.anchor,
+		Position:    p.position(column),
+	}
+}
+
+// anchorKey records a mapping key as an anchored node.
+func (p *parser) anchorKey(anchor string, key string) {
+	if anchor == "" {
+		return
+	}
+	if p.keepsAliases() {
+		p.setAnchor(anchor, nil)
+	} else {
+		p.setAnchor(anchor, &anchorNode{events: []common.Event{common.NewStringEvent(key)}, size: 1})
+	}
+}
+
+// takeAnchor returns the pending anchor, which belongs to the node that
+// starts now, and records the events of the node for aliases unless events are
+// detailed. depth is the number of breadcrumbs while the node is open, or 0 for
+// a scalar.
+func (p *parser) takeAnchor(depth int) string {
+	anchor := p.pendingAnchor
+	if anchor == "" {
+		return ""
+	}
+	p.pendingAnchor = ""
+	if p.keepsAliases() {
+		// aliases aren't expanded, but they must refer to an anchor
+		p.setAnchor(anchor, nil)
+	} else {
+		p.recording = append(p.recording, &recorder{
+			name:   anchor,
+			depth:  depth,
+			start:  p.offset(),
+			inSkip: p.skipDepth > 0,
+		})
+	}
+	return anchor
+}
+
+// record adds emitted events to all anchored nodes that are open.
+func (p *parser) record(events []common.Event) {
+	for _, r := range p.recording {
+		if r.records(p) {
+			r.node.events = append(r.node.events, events...)
+			r.node.size = addSize(r.node.size, len(events))
+		}
+	}
+	if r := p.recording[len(p.recording)-1]; r.depth == 0 {
+		p.finishRecording()
+	}
+}
+
+// finishRecording completes the innermost anchored node.
+func (p *parser) finishRecording() {
+	r := p.recording[len(p.recording)-1]
+	p.recording = p.recording[:len(p.recording)-1]
+	p.setAnchor(r.name, &r.node)
+}
+
+func (p *parser) setAnchor(name string, node *anchorNode) {
+	if p.anchors == nil {
+		p.anchors = map[string]*anchorNode{}
+	}
+	// an anchor may be redefined, later aliases refer to the new node
+	p.anchors[name] = node
+}
@@ -0,0 +1,98 @@
+package yaml
+
+import (
+	"hbibel/yaml-to-json/common"
+	"testing"
+)
+
+func TestTokensToEventsScalarAlias(t *testing.T) {
+	input := "a: &x 1\nb: *x\nc:\n- *x\n"
+	expectedEvents := []common.Event{
+		common.NewStartMappingEvent(),
+		common.NewKeyEvent("a"),
+		common.NewNumberEvent("1"),
+		common.NewKeyEvent("b"),
+		common.NewNumberEvent("1"),
+		common.NewKeyEvent("c"),
+		common.NewStartArrayEvent(),
+		common.NewEmitElementEvent(),
+		common.NewNumberEvent("1"),
+		common.NewEndArrayEvent(),
+		common.NewEndMappingEvent(),
+	}
+	runTest(t, tokenize(input), expectedEvents)
+}
+
+func TestTokensToEventsCollectionAlias(t *testing.T) {
+	input := "base: &base\n  x: 1\n  list: &list\n  - a\nother: *base\nlist: *list\n"
+	base := []common.Event{
+		common.NewStartMappingEvent(),
+		common.NewKeyEvent("x"),
+		common.NewNumberEvent("1"),
+		common.NewKeyEvent("list"),
+		common.NewStartArrayEvent(),
+		common.NewEmitElementEvent(),
+		common.NewStringEvent("a"),
+		common.NewEndArrayEvent(),
+		common.NewEndMappingEvent(),
+	}
+	expectedEvents := []common.Event{common.NewStartMappingEvent(), common.NewKeyEvent("base")}
+	expectedEvents = append(expectedEvents, base...)
+	expectedEvents = append(expectedEvents, common.NewKeyEvent("other"))
+	expectedEvents = append(expectedEvents, base...)
+	expectedEvents = append(expectedEvents, common.NewKeyEvent("list"))
+	expectedEvents = append(expectedEvents, base[4:8]...)
+	expectedEvents = append(expectedEvents, common.NewEndMappingEvent())
+	runTest(t, tokenize(input), expectedEvents)
+}
+
+func TestTokensToEventsAnchorProperties(t *testing.T) {
+	input := "- &a !!str 1\n- !!str &b 2\n- &c\n- &k key: *a\n  *k : *b\n- *c\n"
+	expectedEvents := []common.Event{
+		common.NewStartArrayEvent(),
+		common.NewEmitElementEvent(),
+		common.NewStringEvent("1"),
+		common.NewEmitElementEvent(),
+		common.NewStringEvent("2"),
+		common.NewEmitElementEvent(),
+		common.NewNullEvent(),
+		common.NewEmitElementEvent(),
+		common.NewStartMappingEvent(),
+		common.NewKeyEvent("key"),
+		common.NewStringEvent("2"),
+		common.NewEndMappingEvent(),
+		common.NewEmitElementEvent(),
+		common.NewNullEvent(),
+		common.NewEndArrayEvent(),
+	}
+	// the alias key repeats the anchored key, whose entry it replaces
+	runTestWithOptions(t, tokenize(input), expectedEvents, ParseOptions{DuplicateKeys: DuplicateKeyLastWins})
+}
+
+func TestTokensToEventsAnchorRedefinition(t *testing.T) {
+	input := "- &a 1\n- *a\n- &a 2\n- *a\n"
+	expectedEvents := []common.Event{
+		common.NewStartArrayEvent(),
+		common.NewEmitElementEvent(),
+		common.NewNumberEvent("1"),
+		common.NewEmitElementEvent(),
+		common.NewNumberEvent("1"),
+		common.NewEmitElementEvent(),
+		common.NewNumberEvent("2"),
+		common.NewEmitElementEvent(),
+		common.NewNumberEvent("2"),
+		common.NewEndArrayEvent(),
+	}
+	runTest(t, tokenize(input), expectedEvents)
+}
+
+func TestTokensToEventsAliasErrors(t *testing.T) {
+	runErrorTest(t, "a: *x\n", 1, 4)
+	runErrorTest(t, "a: &x 1\nb: *x y\n", 2, 6)
+	runErrorTest(t, "a: &x 1\nb: &y *x\n", 2, 7)
+	runErrorTest(t, "a: &x &y 1\n", 1, 7)
+	runErrorTest(t, "a: & 1\n", 1, 4)
+	runErrorTest(t, "a: &x\n  b: 1\n*x : c\n", 3, 1)
+	// anchors only apply to their document
+	runErrorTestWithOptions(t, "--- &x 1\n--- *x\n", 2, 5, ParseOptions{MultiDocument: DocumentArray})
+}
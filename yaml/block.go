@@ -0,0 +1,411 @@
+package yaml
+
+import (
+	"hbibel/yaml-to-json/common"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// parseLine parses the tokens of a line that starts at the given column, which
+// is only non-zero after a "---" marker.
+func (p *parser) parseLine(tokens []Token, column int) error {
+	if tokens[0].Kind() == INDENT {
+		column += tokenWidth(tokens[0])
+		tokens = tokens[1:]
+	}
+	if tokens[0].Kind() == SPACE && strings.ContainsRune(tokens[0].String(), '\t') {
+		return p.syntaxError(column, "found a tab character in the indentation, YAML only allows spaces")
+	}
+
+	sequenceEntry := isSequenceEntry(tokens)
+	if p.pendingValue && column <= p.pendingColumn && !(sequenceEntry && p.isIndentlessSequence(column)) {
+		// the line doesn't belong to the previous "key:" or "-"
+		if err := p.finishPendingValue(); err != nil {
+			return err
+		}
+	}
+
+	dedented := p.top().position > column
+	positions := p.openPositions()
+	p.closeBlocks(column)
+	if !sequenceEntry && p.top().nt == IN_ARRAY && p.top().position == column {
+		// the line continues the mapping that contains an indentless sequence
+		if below := p.breadcrumbs[len(p.breadcrumbs)-2]; below.nt == IN_MAPPING && below.position == column {
+			p.pop()
+		}
+	}
+	if !p.pendingValue && p.top().position != column {
+		if dedented {
+			return p.syntaxError(column, "the indentation does not match any enclosing block, expected %s", positions)
+		}
+		if p.top().nt == IN_DOCUMENT {
+			return p.syntaxError(column, "unexpected content after the end of the document's root node")
+		}
+		return p.syntaxError(column, "unexpected indentation, expected %s", p.openPositions())
+	}
+
+	return p.parseNode(tokens, column)
+}
+
+// parseNode parses the remaining tokens of a line, which start at the given
+// column. Several nodes can start on the same line, e.g. "- - key: value".
+func (p *parser) parseNode(tokens []Token, column int) error {
+	top := p.top()
+	continuesBlock := !p.pendingValue && top.position == column
+
+	// properties in front of a mapping key belong to the key, so the mapping
+	// starts at the column of the properties
+	nodeColumn := column
+	props, tokens, column, err := p.parseProperties(tokens, column)
+	if err != nil {
+		return err
+	}
+	if len(tokens) == 0 {
+		if !p.pendingValue {
+			return p.syntaxError(nodeColumn, "node properties must be followed by a node on the same line")
+		}
+		// the properties belong to a node on the next lines
+		return p.setPendingProperties(props, nodeColumn)
+	}
+	if props != (properties{}) && isSequenceEntry(tokens) {
+		return p.syntaxError(column, "a block sequence cannot start on the same line as its properties")
+	}
+
+	quoted := tokens[0].Kind() == SINGLE_QUOTE || tokens[0].Kind() == DOUBLE_QUOTE
+	if quoted {
+		key, colon, ok, err := p.quotedKey(tokens, column)
+		if err != nil {
+			return err
+		}
+		if ok {
+			style := common.SINGLE_QUOTED
+			if tokens[0].Kind() == DOUBLE_QUOTE {
+				style = common.DOUBLE_QUOTED
+			}
+			return p.startMappingEntry(key, p.keyEvent(key, style, props, column), props.anchor, tokens, colon, nodeColumn, continuesBlock)
+		}
+	}
+
+	if isSequenceEntry(tokens) {
+		if continuesBlock && top.nt == IN_ARRAY {
+			p.emit(common.NewEmitElementEvent())
+		} else if p.pendingValue {
+			if err := p.push(IN_ARRAY, common.BLOCK, column); err != nil {
+				return err
+			}
+			p.emit(common.NewEmitElementEvent())
+		} else {
+			return p.syntaxError(column, "expected a mapping key, found a sequence entry")
+		}
+
+		p.pendingValue = true
+		p.pendingColumn = column
+		p.pendingLine = p.line
+		rest, restColumn := skipSpaces(tokens[1:], column+1)
+		if len(rest) == 0 {
+			return nil
+		}
+		return p.parseNode(rest, restColumn)
+	}
+
+	if colon := findMappingColon(tokens); colon >= 0 && !quoted {
+		key := strings.TrimRight(tokensToString(tokens[:colon]), " \t")
+		if key == "" {
+			return p.syntaxError(column, "empty mapping keys are not supported")
+		}
+		if isAlias(tokens) {
+			keyEvent, key, err := p.aliasKey(key, column)
+			if err != nil {
+				return err
+			}
+			return p.startMappingEntry(key, keyEvent, "", tokens, colon, nodeColumn, continuesBlock)
+		}
+		if err := p.checkPlainStart(tokens, column); err != nil {
+			return err
+		}
+		return p.startMappingEntry(key, p.keyEvent(key, common.PLAIN, props, column), props.anchor, tokens, colon, nodeColumn, continuesBlock)
+	}
+
+	if !p.pendingValue {
+		if top.nt == IN_ARRAY {
+			return p.syntaxError(column, "expected a sequence entry, found a scalar")
+		}
+		return p.syntaxError(column, "expected a mapping key, found a scalar")
+	}
+	if err := p.setPendingProperties(props, nodeColumn); err != nil {
+		return err
+	}
+	return p.startValue(tokens, column)
+}
+
+// startMappingEntry emits the event of a mapping key, and parses the tokens
+// after the ":" at tokens[colon] as its value. key identifies the key for the
+// duplicate key detection, and anchor is the anchor of the key.
+func (p *parser) startMappingEntry(key string, keyEvent common.Event, anchor string, tokens []Token, colon int, column int, continuesBlock bool) error {
+	if !continuesBlock || p.top().nt != IN_MAPPING {
+		if !p.pendingValue {
+			return p.syntaxError(column, "expected a sequence entry, found a mapping key")
+		}
+		if err := p.push(IN_MAPPING, common.BLOCK, column); err != nil {
+			return err
+		}
+	}
+	if err := p.checkScalarLength(len(key)); err != nil {
+		return err
+	}
+	if err := p.addKey(key, column); err != nil {
+		return err
+	}
+	p.anchorKey(anchor, key)
+	p.emit(keyEvent)
+
+	p.pendingValue = true
+	p.pendingColumn = column
+	p.pendingLine = p.line
+	rest, restColumn := skipSpaces(tokens[colon+1:], column+tokensWidth(tokens[:colon+1]))
+	if len(rest) == 0 {
+		return nil
+	}
+	props, rest, restColumn, err := p.parseProperties(rest, restColumn)
+	if err == nil {
+		err = p.setPendingProperties(props, restColumn)
+	}
+	if err != nil || len(rest) == 0 {
+		return err
+	}
+	return p.startValue(rest, restColumn)
+}
+
+// quotedKey checks if the tokens start with a quoted scalar that is followed
+// by a ":". If so, it returns the unquoted key and the index of the ":".
+func (p *parser) quotedKey(tokens []Token, column int) (string, int, bool, error) {
+	quote := tokens[0].Kind()
+	end := findClosingQuote(tokens[1:], quote)
+	if end < 0 {
+		return "", 0, false, nil
+	}
+	end++
+	colon := end + 1
+	for colon < len(tokens) && tokens[colon].Kind() == SPACE {
+		colon++
+	}
+	if findMappingColon(tokens[colon:]) != 0 {
+		return "", 0, false, nil
+	}
+
+	raw := tokensToString(tokens[1:end])
+	if quote == SINGLE_QUOTE {
+		return strings.ReplaceAll(raw, "''", "'"), colon, true, nil
+	}
+	key, err := unescapeDoubleQuoted(raw)
+	if err != nil {
+		return "", 0, false, p.syntaxError(column, "%v", err)
+	}
+	return key, colon, true, nil
+}
+
+// isIndentlessSequence checks if a sequence entry at column is the value of
+// the pending mapping key, as in "key:\n- entry". The YAML spec allows such
+// sequences to have the same indentation as the key.
+func (p *parser) isIndentlessSequence(column int) bool {
+	top := p.top()
+	return p.pendingValue && top.nt == IN_MAPPING && top.position == column && p.pendingColumn == column
+}
+
+// finishPendingValue emits a null for a "key:" or "-" whose value is empty.
+func (p *parser) finishPendingValue() error {
+	if !p.pendingValue {
+		return nil
+	}
+	p.pendingValue = false
+	anchor := p.takeAnchor(0)
+	tag := p.pendingTag
+	p.pendingTag = ""
+	event := common.NewNullEvent()
+	if tag != "" {
+		// e.g. "key: !!str" is an empty string
+		var err error
+		if event, err = resolveTagged(p.schema, tag, "", true); err != nil {
+			return p.syntaxError(0, "%v", err)
+		}
+	}
+	// the value has no position of its own, so it gets the one of its key
+	// or dash
+	position := common.Position{}
+	if p.pendingColumn >= 0 {
+		position = common.Position{Line: p.pendingLine, Column: p.pendingColumn + 1}
+	}
+	p.emit(p.scalarEvent(event, "", common.PLAIN, tag, anchor, position))
+	return nil
+}
+
+func (p *parser) top() breadcrumb {
+	return p.breadcrumbs[len(p.breadcrumbs)-1]
+}
+
+// push opens a collection and emits its START event.
+func (p *parser) push(nt nestingType, style common.CollectionStyle, position int) error {
+	if err := p.checkDepth(); err != nil {
+		return err
+	}
+	tag := p.pendingTag
+	p.pendingTag = ""
+	b := breadcrumb{nt: nt, position: position}
+	if nt == IN_MAPPING {
+		b.keys = &keySet{start: p.offset()}
+		if p.opts.DuplicateKeys == DuplicateKeyLastWins && p.holdFrom < 0 {
+			p.holdFrom = b.keys.start
+			p.heldBytes = 0
+		}
+	}
+	p.breadcrumbs = append(p.breadcrumbs, b)
+	anchor := p.takeAnchor(len(p.breadcrumbs))
+
+	kind := common.START_ARRAY
+	if nt == IN_MAPPING {
+		kind = common.START_MAPPING
+	}
+	if p.opts.Detailed {
+		p.emit(&common.CollectionEvent{Kind: kind, Style: style, Tag: tag, Anchor: anchor, Position: p.position(position)})
+	} else if nt == IN_MAPPING {
+		// tags of collections have no JSON representation
+		p.emit(common.NewStartMappingEvent())
+	} else {
+		p.emit(common.NewStartArrayEvent())
+	}
+	return nil
+}
+
+// emptyFlowCollection checks if the tokens are an empty flow collection, "[]"
+// or "{}", the only flow collections that the parser reads. It returns the
+// kind of the collection.
+func emptyFlowCollection(tokens []Token) (nestingType, bool) {
+	s := strings.TrimRight(tokensToString(tokens), " \t")
+	if len(s) < 2 || strings.Trim(s[1:len(s)-1], " \t") != "" {
+		return 0, false
+	}
+	switch s[0:1] + s[len(s)-1:] {
+	case "[]":
+		return IN_ARRAY, true
+	case "{}":
+		return IN_MAPPING, true
+	}
+	return 0, false
+}
+
+// emptyCollection emits an empty flow collection with the pending properties.
+func (p *parser) emptyCollection(nt nestingType, column int) error {
+	p.pendingValue = false
+	if err := p.push(nt, common.FLOW, column); err != nil {
+		return err
+	}
+	p.pop()
+	return nil
+}
+
+// closeBlocks ends all blocks that are more indented than column, innermost
+// first.
+func (p *parser) closeBlocks(column int) {
+	for p.top().position > column {
+		p.pop()
+	}
+}
+
+// pop ends the innermost block.
+func (p *parser) pop() {
+	top := p.top()
+	if p.skipDepth == len(p.breadcrumbs) {
+		// the skipped entry of a duplicate key ends with its mapping
+		p.skipDepth = 0
+	}
+	switch top.nt {
+	case IN_ARRAY:
+		p.emit(common.NewEndArrayEvent())
+	case IN_MAPPING:
+		p.emit(common.NewEndMappingEvent())
+		if top.keys.start == p.holdFrom {
+			p.holdFrom = -1
+		}
+	}
+	if n := len(p.recording); n > 0 && p.recording[n-1].depth == len(p.breadcrumbs) {
+		p.finishRecording()
+	}
+	p.breadcrumbs = p.breadcrumbs[:len(p.breadcrumbs)-1]
+}
+
+// openPositions describes the columns at which a line may continue, for error
+// messages.
+func (p *parser) openPositions() string {
+	columns := []string{}
+	for _, b := range p.breadcrumbs {
+		if b.nt != IN_DOCUMENT {
+			columns = append(columns, strconv.Itoa(b.position))
+		}
+	}
+	if len(columns) == 0 {
+		return "no indentation"
+	}
+	return "an indentation of " + strings.Join(columns, " or ") + " spaces"
+}
+
+// isSequenceEntry checks if the tokens start with a "-" that is followed by a
+// space or the end of the line.
+func isSequenceEntry(tokens []Token) bool {
+	return tokens[0].Kind() == DASH && (len(tokens) == 1 || tokens[1].Kind() == SPACE)
+}
+
+// findMappingColon returns the index of the first ":" that is followed by a
+// space or the end of the line, or -1 if there is none.
+func findMappingColon(tokens []Token) int {
+	for i, t := range tokens {
+		if t.Kind() == COLON && (len(tokens) == i+1 || tokens[i+1].Kind() == SPACE) {
+			return i
+		}
+	}
+	return -1
+}
+
+// skipSpaces drops leading SPACE tokens and returns the remaining tokens and
+// the column at which they start.
+func skipSpaces(tokens []Token, column int) ([]Token, int) {
+	for len(tokens) > 0 && tokens[0].Kind() == SPACE {
+		column += tokenWidth(tokens[0])
+		tokens = tokens[1:]
+	}
+	return tokens, column
+}
+
+func isBlank(tokens []Token) bool {
+	for _, t := range tokens {
+		if t.Kind() != SPACE && t.Kind() != INDENT {
+			return false
+		}
+	}
+	return true
+}
+
+func tokensToString(tokens []Token) string {
+	sb := strings.Builder{}
+	for _, t := range tokens {
+		sb.WriteString(t.String())
+	}
+	return sb.String()
+}
+
+// tokensWidth returns the number of columns that the tokens occupy.
+func tokensWidth(tokens []Token) int {
+	width := 0
+	for _, t := range tokens {
+		width += tokenWidth(t)
+	}
+	return width
+}
+
+// tokenWidth returns the number of columns that a token occupies.
+func tokenWidth(t Token) int {
+	if indent, ok := t.(*indentToken); ok {
+		return int(indent.spaceCount)
+	}
+	return utf8.RuneCountInString(t.String())
+}
@@ -0,0 +1,139 @@
+package yaml
+
+import (
+	"hbibel/yaml-to-json/common"
+	"strings"
+)
+
+// A comment starts with a "#" at the beginning of a line or after whitespace,
+// and ends with the line. It may follow any node except within a quoted
+// scalar, see https://yaml.org/spec/1.2.2/#66-comments
+
+// lineComment is the comment at the end of a line.
+type lineComment struct {
+	// the text after the "#"
+	text string
+	// the zero based column of the "#"
+	column int
+}
+
+// splitComment separates the comment of a line from its content. If the line
+// starts within a quoted scalar, quote is the kind of its quotes, otherwise
+// it is NEWLINE.
+func splitComment(tokens []Token, quote TokenKind) ([]Token, *lineComment) {
+	for i := 0; i < len(tokens); i++ {
+		t := tokens[i]
+		if quote != NEWLINE {
+			if t.Kind() != quote {
+				continue
+			}
+			if quote == SINGLE_QUOTE && i+1 < len(tokens) && tokens[i+1].Kind() == SINGLE_QUOTE {
+				// an escaped quote
+				i++
+				continue
+			}
+			if quote == DOUBLE_QUOTE && i > 0 && tokens[i-1].Kind() == WORD && trailingBackslashes(tokens[i-1].String())%2 == 1 {
+				continue
+			}
+			quote = NEWLINE
+			continue
+		}
+
+		switch t.Kind() {
+		case SINGLE_QUOTE, DOUBLE_QUOTE:
+			if opensQuotedScalar(tokens[:i]) {
+				quote = t.Kind()
+			}
+		case WORD:
+			if strings.HasPrefix(t.String(), "#") && (i == 0 || tokens[i-1].Kind() == SPACE || tokens[i-1].Kind() == INDENT) {
+				text := strings.TrimPrefix(tokensToString(tokens[i:]), "#")
+				return tokens[:i], &lineComment{text: text, column: tokensWidth(tokens[:i])}
+			}
+		}
+	}
+	return tokens, nil
+}
+
+// opensQuotedScalar checks if a quote after the given tokens of a line starts
+// a quoted scalar, rather than being part of a plain scalar like "don't". A
+// quoted scalar starts a line, or follows the indicator of a mapping value,
+// a sequence entry or node properties.
+func opensQuotedScalar(before []Token) bool {
+	if len(before) == 0 {
+		return true
+	}
+	last := before[len(before)-1]
+	if last.Kind() == INDENT {
+		return true
+	}
+	if last.Kind() != SPACE {
+		return false
+	}
+	n := len(before)
+	for n > 0 && before[n-1].Kind() == SPACE {
+		n--
+	}
+	if n == 0 {
+		return true
+	}
+	switch previous := before[n-1]; previous.Kind() {
+	case INDENT, COLON, DASH:
+		return true
+	case WORD:
+		return strings.HasPrefix(previous.String(), "&") || strings.HasPrefix(previous.String(), "!")
+	}
+	return false
+}
+
+// openQuote returns the kind of quotes of a quoted scalar that continues on
+// the next line, or NEWLINE if there is none.
+func (p *parser) openQuote() TokenKind {
+	switch {
+	case p.scalar == nil || p.scalar.closed:
+		return NEWLINE
+	case p.scalar.style == singleQuotedStyle:
+		return SINGLE_QUOTE
+	case p.scalar.style == doubleQuotedStyle:
+		return DOUBLE_QUOTE
+	}
+	return NEWLINE
+}
+
+// endLine handles the comment at the end of a line, which also ends a plain
+// scalar on that line.
+func (p *parser) endLine(comment *lineComment, inline bool) error {
+	if comment == nil {
+		return nil
+	}
+	if p.scalar != nil && p.scalar.style == plainStyle {
+		if err := p.finishScalar(); err != nil {
+			return err
+		}
+	}
+	p.emitComment(comment, inline)
+	return nil
+}
+
+// emitComment passes on a comment if comments are requested. Unlike the
+// events of nodes, comments are neither counted nor recorded for aliases.
+func (p *parser) emitComment(comment *lineComment, inline bool) {
+	if !p.opts.Comments || p.discard || p.skipDepth > 0 {
+		return
+	}
+	p.events = append(p.events, &common.CommentEvent{
+		Text:     comment.text,
+		Inline:   inline,
+		Position: p.position(comment.column),
+	})
+}
+
+// emitBlankLines passes on empty lines if comments are requested, because
+// they group the nodes like comments do.
+func (p *parser) emitBlankLines(n int) {
+	if !p.opts.Comments || p.discard || p.skipDepth > 0 {
+		return
+	}
+	for i := 0; i < n; i++ {
+		p.events = append(p.events, common.NewBlankLineEvent())
+	}
+}
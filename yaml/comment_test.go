@@ -0,0 +1,70 @@
+package yaml
+
+import (
+	"hbibel/yaml-to-json/common"
+	"testing"
+)
+
+func TestTokensToEventsComments(t *testing.T) {
+	input := "# head\n\na: 1 # one\nb: \"x # not\" # two\n# before c\nc:\n  - p  # item\n  - 'q'\n\n  - r\nd: plain\n  continued # end\n"
+	comment := func(text string, inline bool, line, column int) common.Event {
+		return &common.CommentEvent{Text: text, Inline: inline, Position: common.Position{Line: line, Column: column}}
+	}
+	expectedEvents := []common.Event{
+		comment(" head", false, 1, 1),
+		common.NewBlankLineEvent(),
+		common.NewStartMappingEvent(),
+		common.NewKeyEvent("a"),
+		common.NewNumberEvent("1"),
+		comment(" one", true, 3, 6),
+		common.NewKeyEvent("b"),
+		common.NewStringEvent("x # not"),
+		comment(" two", true, 4, 14),
+		comment(" before c", false, 5, 1),
+		common.NewKeyEvent("c"),
+		common.NewStartArrayEvent(),
+		common.NewEmitElementEvent(),
+		common.NewStringEvent("p"),
+		comment(" item", true, 7, 8),
+		common.NewEmitElementEvent(),
+		common.NewStringEvent("q"),
+		common.NewBlankLineEvent(),
+		common.NewEmitElementEvent(),
+		common.NewStringEvent("r"),
+		common.NewEndArrayEvent(),
+		common.NewKeyEvent("d"),
+		common.NewStringEvent("plain continued"),
+		comment(" end", true, 12, 13),
+		common.NewEndMappingEvent(),
+	}
+	runTestWithOptions(t, tokenize(input), expectedEvents, ParseOptions{Comments: true})
+}
+
+func TestTokensToEventsCommentsAreDropped(t *testing.T) {
+	expectedEvents := []common.Event{
+		common.NewStartMappingEvent(),
+		common.NewKeyEvent("a"),
+		common.NewNumberEvent("1"),
+		common.NewKeyEvent("b"),
+		common.NewStringEvent("don't # stop"),
+		common.NewEndMappingEvent(),
+	}
+	runTest(t, tokenize("# c\na: 1 # c\nb: 'don''t # stop' # c\n"), expectedEvents)
+}
+
+func TestTokensToEventsCommentEndsPlainScalar(t *testing.T) {
+	expectedEvents := []common.Event{
+		common.NewStartMappingEvent(),
+		common.NewKeyEvent("a"),
+		common.NewStringEvent("b"),
+		common.NewEndMappingEvent(),
+	}
+	runTest(t, tokenize("a: b\n  # c\n"), expectedEvents)
+	// the comment ends the scalar, so the next line can't continue it
+	runErrorTest(t, "a: b\n  # c\n  d\n", 3, 3)
+}
+
+func TestTokensToEventsHashWithinPlainScalar(t *testing.T) {
+	expectedEvents := []common.Event{common.NewStringEvent("a#b")}
+	runTest(t, tokenize("a#b\n"), expectedEvents)
+}
@@ -0,0 +1,845 @@
+package yaml
+
+import (
+	"bytes"
+	textencoding "encoding"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hbibel/yaml-to-json/common"
+	"io"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// Unmarshal and Decoder fill Go values directly from the events of the
+// parser, without rendering JSON first. They follow the rules of
+// encoding/json: struct fields are matched by their `json` tag or their name,
+// preferring an exact match over a case-insensitive one, unknown keys are
+// ignored, and null leaves values other than pointers, interfaces, maps and
+// slices unchanged. A `yaml` tag takes precedence over a `json` tag. Unlike
+// encoding/json, numbers and booleans can be stored in strings, which receive
+// them as they were written, and ".inf" and ".nan" can be stored in floats.
+
+// Unmarshaler is implemented by types that decode a YAML node themselves.
+// unmarshal decodes the node into another value, and may be called more than
+// once, e.g. to try several representations. Types that implement
+// json.Unmarshaler receive the node as JSON instead, and types that implement
+// encoding.TextUnmarshaler receive a scalar as it was written.
+type Unmarshaler interface {
+	UnmarshalYAML(unmarshal func(any) error) error
+}
+
+// UnmarshalTypeError describes a YAML value that cannot be stored in a Go
+// value of a specific type.
+type UnmarshalTypeError struct {
+	// Value describes the YAML value, e.g. "mapping" or "number 1.5".
+	Value string
+	Type  reflect.Type
+	// Field is the path of the value from the root, e.g. "spec.replicas",
+	// or empty for the root.
+	Field string
+	// Line and Column locate the value in the input, both starting at 1.
+	Line   int
+	Column int
+}
+
+func (e *UnmarshalTypeError) Error() string {
+	target := "Go value"
+	if e.Field != "" {
+		target = "Go struct field " + e.Field
+	}
+	return fmt.Sprintf("line %d, column %d: cannot unmarshal %s into %s of type %s", e.Line, e.Column, e.Value, target, e.Type)
+}
+
+// Unmarshal decodes the YAML document in data into the value that v points
+// to. An empty input leaves v unchanged, and more than one document is an
+// error.
+func Unmarshal(data []byte, v any) error {
+	return UnmarshalWithOptions(data, v, ParseOptions{})
+}
+
+// UnmarshalWithOptions is like Unmarshal, but allows to configure the parser.
+// MultiDocument determines how a stream of several documents is decoded:
+// DocumentArray decodes it like a sequence of the documents, and
+// FirstDocument ignores all documents after the first one. Detailed is
+// ignored.
+func UnmarshalWithOptions(data []byte, v any, opts ParseOptions) error {
+	d := NewDecoderWithOptions(bytes.NewReader(data), opts)
+	if opts.MultiDocument == DocumentArray {
+		return d.decodeDocumentArray(v)
+	}
+	err := d.Decode(v)
+	if err == io.EOF {
+		return nil
+	}
+	if err != nil || opts.MultiDocument == FirstDocument {
+		return err
+	}
+	for {
+		event, err := d.next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if event.GetKind() == common.DOCUMENT_START {
+			return errors.New("the input contains more than one document")
+		}
+	}
+}
+
+// Decoder reads the documents of a YAML stream one by one. It reads from its
+// input only as much as is needed for the next document.
+type Decoder struct {
+	scanner *Scanner
+	parser  *parser
+	// the events of the parser that haven't been decoded yet
+	events []common.Event
+	// the error of the scanner or the parser, which ends the stream
+	err      error
+	finished bool
+
+	disallowUnknownFields bool
+}
+
+// NewDecoder returns a Decoder that reads YAML in any of the encodings that
+// NewUTF8Reader accepts from r.
+func NewDecoder(r io.Reader) *Decoder {
+	return NewDecoderWithOptions(r, ParseOptions{})
+}
+
+// NewDecoderWithOptions is like NewDecoder, but allows to configure the
+// parser. Detailed and MultiDocument are ignored.
+func NewDecoderWithOptions(r io.Reader, opts ParseOptions) *Decoder {
+	// detailed events have positions for the errors, and separate the
+	// documents
+	opts.Detailed = true
+	p := newParser(opts)
+	p.expandAliases = true
+	return &Decoder{scanner: NewScanner(NewUTF8Reader(r)), parser: p}
+}
+
+// DisallowUnknownFields makes Decode fail if a mapping has a key that doesn't
+// match any field of the struct that it is decoded into.
+func (d *Decoder) DisallowUnknownFields() {
+	d.disallowUnknownFields = true
+}
+
+// Decode decodes the next document of the stream into the value that v points
+// to. It returns io.EOF if there are no more documents. If the document
+// cannot be stored in v, Decode stores as much as it can and returns the
+// first error, like an *UnmarshalTypeError. The next call continues with the
+// next document.
+func (d *Decoder) Decode(v any) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() {
+		return fmt.Errorf("cannot decode into %v, a non-nil pointer is needed", reflect.TypeOf(v))
+	}
+	for {
+		event, err := d.next()
+		if err != nil {
+			return err
+		}
+		if event.GetKind() == common.DOCUMENT_START {
+			break
+		}
+	}
+
+	ds := d.newDecodeState(d.next)
+	if err := ds.document(rv); err != nil {
+		return err
+	}
+	if _, err := d.next(); err != nil {
+		// the DOCUMENT_END event
+		return err
+	}
+	return ds.err
+}
+
+// decodeDocumentArray decodes all documents like a sequence of them.
+func (d *Decoder) decodeDocumentArray(v any) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() {
+		return fmt.Errorf("cannot decode into %v, a non-nil pointer is needed", reflect.TypeOf(v))
+	}
+	started, ended := false, false
+	next := func() (common.Event, error) {
+		for {
+			if !started {
+				started = true
+				return common.NewStartArrayEvent(), nil
+			}
+			if ended {
+				return nil, io.EOF
+			}
+			event, err := d.next()
+			if err == io.EOF {
+				ended = true
+				return common.NewEndArrayEvent(), nil
+			}
+			if err != nil {
+				return nil, err
+			}
+			switch event.GetKind() {
+			case common.DOCUMENT_START:
+				return common.NewEmitElementEvent(), nil
+			case common.STREAM_START, common.STREAM_END, common.DOCUMENT_END:
+				continue
+			}
+			return event, nil
+		}
+	}
+	ds := d.newDecodeState(next)
+	if err := ds.document(rv); err != nil {
+		return err
+	}
+	return ds.err
+}
+
+// next returns the next event of the parser, or io.EOF after the last one.
+func (d *Decoder) next() (common.Event, error) {
+	for len(d.events) == 0 {
+		if d.err != nil {
+			return nil, d.err
+		}
+		if d.finished {
+			return nil, io.EOF
+		}
+		d.read()
+	}
+	event := d.events[0]
+	d.events[0] = nil
+	d.events = d.events[1:]
+	return event, nil
+}
+
+// read feeds the next token to the parser and takes the events that are
+// ready.
+func (d *Decoder) read() {
+	var err error
+	if d.scanner.Scan() {
+		err = d.parser.feed(d.scanner.Token())
+	} else if err = d.scanner.Err(); err == nil {
+		err = d.parser.finish()
+		d.finished = true
+	}
+	n := d.parser.flushable()
+	d.events = append(d.events, d.parser.events[:n]...)
+	d.parser.flush(n)
+	if err != nil {
+		d.err = err
+	}
+}
+
+func (d *Decoder) newDecodeState(next func() (common.Event, error)) *decodeState {
+	return &decodeState{next: next, disallowUnknownFields: d.disallowUnknownFields}
+}
+
+// decodeState decodes the events of a single node.
+type decodeState struct {
+	next                  func() (common.Event, error)
+	disallowUnknownFields bool
+	// the keys from the root to the current node
+	path []string
+	// the first error that didn't stop the decoding
+	err error
+}
+
+// document decodes the root node into the value that v points to. Errors
+// that only affect a part of the value are stored in err, the returned error
+// ends the decoding.
+func (ds *decodeState) document(v reflect.Value) error {
+	event, err := ds.next()
+	if err != nil {
+		return err
+	}
+	return ds.value(event, v.Elem())
+}
+
+func (ds *decodeState) saveError(err error) {
+	if ds.err == nil {
+		ds.err = err
+	}
+}
+
+func (ds *decodeState) typeError(event common.Event, value string, t reflect.Type) {
+	position := positionOf(event)
+	ds.saveError(&UnmarshalTypeError{
+		Value:  value,
+		Type:   t,
+		Field:  strings.Join(ds.path, "."),
+		Line:   position.Line,
+		Column: position.Column,
+	})
+}
+
+// hookError adds the position of a node to the error of a hook.
+func (ds *decodeState) hookError(event common.Event, err error) {
+	position := positionOf(event)
+	ds.saveError(fmt.Errorf("line %d, column %d: %w", position.Line, position.Column, err))
+}
+
+func positionOf(event common.Event) common.Position {
+	if e, ok := event.(common.HasPosition); ok {
+		return e.GetPosition()
+	}
+	return common.Position{}
+}
+
+// value decodes the node that starts with event into v.
+func (ds *decodeState) value(event common.Event, v reflect.Value) error {
+	u, ju, tu, v := indirect(v, isNull(event))
+	if u != nil || ju != nil {
+		events, err := ds.collect(event)
+		if err != nil {
+			return err
+		}
+		if u != nil {
+			err = u.UnmarshalYAML(ds.unmarshalFunc(events))
+		} else {
+			err = ju.UnmarshalJSON(eventsToJSON(events))
+		}
+		if err != nil {
+			ds.hookError(event, err)
+		}
+		return nil
+	}
+	if tu != nil {
+		e, ok := event.(*common.EventWithPayload)
+		if !ok || event.GetKind() != common.EMIT_VALUE {
+			ds.typeError(event, describe(event), reflect.TypeOf(tu))
+			return ds.skip(event)
+		}
+		if err := tu.UnmarshalText([]byte(e.Source)); err != nil {
+			ds.hookError(event, err)
+		}
+		return nil
+	}
+
+	switch event.GetKind() {
+	case common.START_MAPPING:
+		return ds.mapping(event, v)
+	case common.START_ARRAY:
+		return ds.sequence(event, v)
+	case common.EMIT_VALUE:
+		ds.scalar(event.(*common.EventWithPayload), v)
+		return nil
+	}
+	return fmt.Errorf("unexpected event %v", event)
+}
+
+// unmarshalFunc returns the function that an Unmarshaler calls to decode its
+// node.
+func (ds *decodeState) unmarshalFunc(events []common.Event) func(any) error {
+	return func(v any) error {
+		rv := reflect.ValueOf(v)
+		if rv.Kind() != reflect.Pointer || rv.IsNil() {
+			return fmt.Errorf("cannot decode into %v, a non-nil pointer is needed", reflect.TypeOf(v))
+		}
+		rest := events
+		sub := &decodeState{
+			next: func() (common.Event, error) {
+				if len(rest) == 0 {
+					return nil, io.EOF
+				}
+				event := rest[0]
+				rest = rest[1:]
+				return event, nil
+			},
+			disallowUnknownFields: ds.disallowUnknownFields,
+			path:                  ds.path,
+		}
+		if err := sub.document(rv); err != nil {
+			return err
+		}
+		return sub.err
+	}
+}
+
+func isNull(event common.Event) bool {
+	e, ok := event.(*common.EventWithPayload)
+	return ok && e.PayloadType == common.NULL
+}
+
+// indirect walks down v, allocating pointers as needed, until it gets to a
+// value that isn't a pointer, or one that implements a hook. If decodingNull
+// is set, it stops at the last pointer, so that it can be set to nil.
+func indirect(v reflect.Value, decodingNull bool) (Unmarshaler, json.Unmarshaler, textencoding.TextUnmarshaler, reflect.Value) {
+	// the hooks usually have pointer receivers
+	if v.Kind() != reflect.Pointer && v.Type().Name() != "" && v.CanAddr() {
+		v = v.Addr()
+	}
+	for {
+		// decode into the pointer that an interface holds
+		if v.Kind() == reflect.Interface && !v.IsNil() {
+			e := v.Elem()
+			if e.Kind() == reflect.Pointer && !e.IsNil() && (!decodingNull || e.Elem().Kind() == reflect.Pointer) {
+				v = e
+				continue
+			}
+		}
+		if v.Kind() != reflect.Pointer {
+			break
+		}
+		if decodingNull && v.CanSet() {
+			break
+		}
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		if v.Type().NumMethod() > 0 && v.CanInterface() {
+			if u, ok := v.Interface().(Unmarshaler); ok {
+				return u, nil, nil, reflect.Value{}
+			}
+			if u, ok := v.Interface().(json.Unmarshaler); ok {
+				return nil, u, nil, reflect.Value{}
+			}
+			if !decodingNull {
+				if u, ok := v.Interface().(textencoding.TextUnmarshaler); ok {
+					return nil, nil, u, reflect.Value{}
+				}
+			}
+		}
+		v = v.Elem()
+	}
+	return nil, nil, nil, v
+}
+
+// describe returns a description of a node for an UnmarshalTypeError.
+func describe(event common.Event) string {
+	switch event.GetKind() {
+	case common.START_MAPPING:
+		return "mapping"
+	case common.START_ARRAY:
+		return "sequence"
+	}
+	e, ok := event.(*common.EventWithPayload)
+	if !ok {
+		return "alias"
+	}
+	switch e.PayloadType {
+	case common.STRING:
+		return "string " + strconv.Quote(e.Payload)
+	case common.NUMBER:
+		return "number " + e.Payload
+	case common.BOOLEAN:
+		return "bool " + e.Payload
+	}
+	return "null"
+}
+
+// skip reads the rest of the node that starts with event.
+func (ds *decodeState) skip(event common.Event) error {
+	_, err := ds.read(event, false)
+	return err
+}
+
+// collect returns all events of the node that starts with event.
+func (ds *decodeState) collect(event common.Event) ([]common.Event, error) {
+	return ds.read(event, true)
+}
+
+func (ds *decodeState) read(event common.Event, keep bool) ([]common.Event, error) {
+	var events []common.Event
+	if keep {
+		events = append(events, event)
+	}
+	depth := 0
+	for {
+		switch event.GetKind() {
+		case common.START_MAPPING, common.START_ARRAY:
+			depth++
+		case common.END_MAPPING, common.END_ARRAY:
+			depth--
+		}
+		if depth == 0 {
+			return events, nil
+		}
+		var err error
+		if event, err = ds.next(); err != nil {
+			return nil, err
+		}
+		if keep {
+			events = append(events, event)
+		}
+	}
+}
+
+func (ds *decodeState) mapping(start common.Event, v reflect.Value) error {
+	var entry func(key string, event common.Event) error
+	switch v.Kind() {
+	case reflect.Interface:
+		if v.NumMethod() != 0 {
+			ds.typeError(start, "mapping", v.Type())
+			return ds.skip(start)
+		}
+		m := map[string]any{}
+		v.Set(reflect.ValueOf(m))
+		entry = func(key string, event common.Event) error {
+			var value any
+			err := ds.value(event, reflect.ValueOf(&value).Elem())
+			m[key] = value
+			return err
+		}
+	case reflect.Map:
+		keyType := v.Type().Key()
+		if !isMapKeyType(keyType) {
+			ds.typeError(start, "mapping", v.Type())
+			return ds.skip(start)
+		}
+		if v.IsNil() {
+			v.Set(reflect.MakeMap(v.Type()))
+		}
+		entry = func(key string, event common.Event) error {
+			value := reflect.New(v.Type().Elem()).Elem()
+			if err := ds.value(event, value); err != nil {
+				return err
+			}
+			if k, ok := ds.mapKey(event, key, keyType); ok {
+				v.SetMapIndex(k, value)
+			}
+			return nil
+		}
+	case reflect.Struct:
+		fields := cachedTypeFields(v.Type())
+		entry = func(key string, event common.Event) error {
+			f := fields.lookup(key)
+			if f == nil {
+				if ds.disallowUnknownFields {
+					position := positionOf(event)
+					ds.saveError(fmt.Errorf("line %d, column %d: unknown field %q", position.Line, position.Column, key))
+				}
+				return ds.skip(event)
+			}
+			field, err := fieldByIndex(v, f.index)
+			if err != nil {
+				ds.hookError(event, err)
+				return ds.skip(event)
+			}
+			return ds.value(event, field)
+		}
+	default:
+		ds.typeError(start, "mapping", v.Type())
+		return ds.skip(start)
+	}
+
+	for {
+		event, err := ds.next()
+		if err != nil {
+			return err
+		}
+		if event.GetKind() == common.END_MAPPING {
+			return nil
+		}
+		key, ok := event.(*common.EventWithPayload)
+		if !ok || key.Kind != common.EMIT_KEY {
+			return fmt.Errorf("unexpected event %v in place of a key", event)
+		}
+		if event, err = ds.next(); err != nil {
+			return err
+		}
+		ds.path = append(ds.path, key.Payload)
+		err = entry(key.Payload, event)
+		ds.path = ds.path[:len(ds.path)-1]
+		if err != nil {
+			return err
+		}
+	}
+}
+
+var textUnmarshalerType = reflect.TypeOf((*textencoding.TextUnmarshaler)(nil)).Elem()
+
+func isMapKeyType(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.String,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return true
+	}
+	return reflect.PointerTo(t).Implements(textUnmarshalerType)
+}
+
+// mapKey converts a key to the key type of a map.
+func (ds *decodeState) mapKey(event common.Event, key string, t reflect.Type) (reflect.Value, bool) {
+	if reflect.PointerTo(t).Implements(textUnmarshalerType) {
+		k := reflect.New(t)
+		if err := k.Interface().(textencoding.TextUnmarshaler).UnmarshalText([]byte(key)); err != nil {
+			ds.hookError(event, err)
+			return reflect.Value{}, false
+		}
+		return k.Elem(), true
+	}
+	k := reflect.New(t).Elem()
+	switch t.Kind() {
+	case reflect.String:
+		k.SetString(key)
+		return k, true
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(key, 10, t.Bits())
+		if err == nil {
+			k.SetInt(n)
+			return k, true
+		}
+	default:
+		n, err := strconv.ParseUint(key, 10, t.Bits())
+		if err == nil {
+			k.SetUint(n)
+			return k, true
+		}
+	}
+	ds.typeError(event, "key "+strconv.Quote(key), t)
+	return reflect.Value{}, false
+}
+
+// fieldByIndex returns the field of a struct, allocating the embedded structs
+// on the way that are nil pointers.
+func fieldByIndex(v reflect.Value, index []int) (reflect.Value, error) {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Pointer {
+			if v.IsNil() {
+				if !v.CanSet() {
+					return reflect.Value{}, fmt.Errorf("cannot set the embedded pointer to the unexported struct %v", v.Type().Elem())
+				}
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v, nil
+}
+
+func (ds *decodeState) sequence(start common.Event, v reflect.Value) error {
+	switch v.Kind() {
+	case reflect.Interface:
+		if v.NumMethod() != 0 {
+			ds.typeError(start, "sequence", v.Type())
+			return ds.skip(start)
+		}
+		var items []any
+		err := ds.items(func(i int, event common.Event) error {
+			items = append(items, nil)
+			return ds.value(event, reflect.ValueOf(&items[i]).Elem())
+		})
+		if items == nil {
+			items = []any{}
+		}
+		v.Set(reflect.ValueOf(items))
+		return err
+	case reflect.Slice:
+		n := 0
+		err := ds.items(func(i int, event common.Event) error {
+			if i >= v.Cap() {
+				v.Grow(1)
+			}
+			v.SetLen(i + 1)
+			// the backing array may hold an old value
+			v.Index(i).SetZero()
+			n++
+			return ds.value(event, v.Index(i))
+		})
+		if err != nil {
+			return err
+		}
+		if n == 0 && v.IsNil() {
+			v.Set(reflect.MakeSlice(v.Type(), 0, 0))
+		}
+		v.SetLen(n)
+		return nil
+	case reflect.Array:
+		n := 0
+		err := ds.items(func(i int, event common.Event) error {
+			if i >= v.Len() {
+				return ds.skip(event)
+			}
+			n++
+			return ds.value(event, v.Index(i))
+		})
+		for i := n; i < v.Len(); i++ {
+			v.Index(i).SetZero()
+		}
+		return err
+	}
+	ds.typeError(start, "sequence", v.Type())
+	return ds.skip(start)
+}
+
+// items calls item with the first event of each entry of a sequence.
+func (ds *decodeState) items(item func(i int, event common.Event) error) error {
+	for i := 0; ; {
+		event, err := ds.next()
+		if err != nil {
+			return err
+		}
+		switch event.GetKind() {
+		case common.END_ARRAY:
+			return nil
+		case common.EMIT_ELEMENT:
+			continue
+		}
+		ds.path = append(ds.path, strconv.Itoa(i))
+		err = item(i, event)
+		ds.path = ds.path[:len(ds.path)-1]
+		if err != nil {
+			return err
+		}
+		i++
+	}
+}
+
+func (ds *decodeState) scalar(e *common.EventWithPayload, v reflect.Value) {
+	if e.PayloadType == common.NULL {
+		switch v.Kind() {
+		case reflect.Interface, reflect.Pointer, reflect.Map, reflect.Slice:
+			v.SetZero()
+		}
+		return
+	}
+
+	switch v.Kind() {
+	case reflect.Interface:
+		if v.NumMethod() != 0 {
+			break
+		}
+		switch e.PayloadType {
+		case common.STRING:
+			v.Set(reflect.ValueOf(e.Payload))
+		case common.NUMBER:
+			f, err := strconv.ParseFloat(e.Payload, 64)
+			if err != nil {
+				break
+			}
+			v.Set(reflect.ValueOf(f))
+		case common.BOOLEAN:
+			v.Set(reflect.ValueOf(e.Payload == "true"))
+		}
+		return
+	case reflect.String:
+		if e.PayloadType == common.STRING {
+			v.SetString(e.Payload)
+		} else {
+			v.SetString(e.Source)
+		}
+		return
+	case reflect.Bool:
+		if e.PayloadType == common.BOOLEAN {
+			v.SetBool(e.Payload == "true")
+			return
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if e.PayloadType == common.NUMBER {
+			if n, err := strconv.ParseInt(e.Payload, 10, v.Type().Bits()); err == nil {
+				v.SetInt(n)
+				return
+			}
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if e.PayloadType == common.NUMBER {
+			if n, err := strconv.ParseUint(e.Payload, 10, v.Type().Bits()); err == nil {
+				v.SetUint(n)
+				return
+			}
+		}
+	case reflect.Float32, reflect.Float64:
+		if f, ok := parseFloat(e); ok && !overflowsFloat(v.Type(), f) {
+			v.SetFloat(f)
+			return
+		}
+	case reflect.Slice:
+		if v.Type().Elem().Kind() == reflect.Uint8 && e.PayloadType == common.STRING {
+			b, err := base64.StdEncoding.DecodeString(e.Payload)
+			if err != nil {
+				ds.hookError(e, err)
+				return
+			}
+			v.SetBytes(b)
+			return
+		}
+	}
+	ds.typeError(e, describe(e), v.Type())
+}
+
+// parseFloat returns the value of a number, or of a plain ".inf" or ".nan",
+// which the schemas resolve to strings because JSON has no such numbers.
+func parseFloat(e *common.EventWithPayload) (float64, bool) {
+	switch e.PayloadType {
+	case common.NUMBER:
+		f, err := strconv.ParseFloat(e.Payload, 64)
+		return f, err == nil
+	case common.STRING:
+		if e.Style != common.PLAIN || !coreInfNaN.MatchString(e.Source) {
+			return 0, false
+		}
+		switch {
+		case strings.HasSuffix(strings.ToLower(e.Source), "nan"):
+			return math.NaN(), true
+		case strings.HasPrefix(e.Source, "-"):
+			return math.Inf(-1), true
+		default:
+			return math.Inf(1), true
+		}
+	}
+	return 0, false
+}
+
+func overflowsFloat(t reflect.Type, f float64) bool {
+	if t.Kind() != reflect.Float32 || math.IsInf(f, 0) || math.IsNaN(f) {
+		return false
+	}
+	return math.Abs(f) > math.MaxFloat32
+}
+
+// eventsToJSON renders the events of a node as JSON for a json.Unmarshaler.
+func eventsToJSON(events []common.Event) []byte {
+	var b bytes.Buffer
+	// whether the next entry of each open collection is its first one
+	first := []bool{}
+	separate := func() {
+		if len(first) > 0 && !first[len(first)-1] {
+			b.WriteByte(',')
+		}
+		if len(first) > 0 {
+			first[len(first)-1] = false
+		}
+	}
+	for _, event := range events {
+		switch event.GetKind() {
+		case common.START_MAPPING:
+			b.WriteByte('{')
+			first = append(first, true)
+		case common.START_ARRAY:
+			b.WriteByte('[')
+			first = append(first, true)
+		case common.END_MAPPING:
+			b.WriteByte('}')
+			first = first[:len(first)-1]
+		case common.END_ARRAY:
+			b.WriteByte(']')
+			first = first[:len(first)-1]
+		case common.EMIT_ELEMENT:
+			separate()
+		case common.EMIT_KEY:
+			separate()
+			key, _ := json.Marshal(event.(common.HasPayload).GetPayload())
+			b.Write(key)
+			b.WriteByte(':')
+		case common.EMIT_VALUE:
+			e := event.(common.HasPayload)
+			switch e.GetPayLoadType() {
+			case common.STRING:
+				s, _ := json.Marshal(e.GetPayload())
+				b.Write(s)
+			case common.NULL:
+				b.WriteString("null")
+			default:
+				b.WriteString(e.GetPayload())
+			}
+		}
+	}
+	return b.Bytes()
+}
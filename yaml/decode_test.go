@@ -0,0 +1,329 @@
+package yaml
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type container struct {
+	Name  string            `json:"name"`
+	Image string            `json:"image,omitempty"`
+	Ports []int             `json:"ports"`
+	Env   map[string]string `json:"env"`
+}
+
+type deployment struct {
+	Kind     string `yaml:"kind" json:"type"`
+	Replicas *int   `json:"replicas"`
+	Paused   bool
+	Ignored  string `json:"-"`
+	Spec     struct {
+		Containers []container `json:"containers"`
+	} `json:"spec"`
+	Labels map[string]any `json:"labels"`
+	Extra  any            `json:"extra"`
+}
+
+func TestUnmarshalStruct(t *testing.T) {
+	input := `kind: Deployment
+replicas: 0x3
+paused: true
+Ignored: x
+spec:
+  containers:
+  - name: app
+    image: &img app:1.0
+    ports:
+    - 80
+    - 443
+    env:
+      MODE: prod
+  - name: sidecar
+    image: *img
+labels:
+  tier: web
+  weight: 1.5
+extra:
+- ~
+- yes
+`
+	var d deployment
+	if err := Unmarshal([]byte(input), &d); err != nil {
+		t.Fatal(err)
+	}
+	replicas := 3
+	expected := deployment{Kind: "Deployment", Replicas: &replicas, Paused: true}
+	expected.Spec.Containers = []container{
+		{Name: "app", Image: "app:1.0", Ports: []int{80, 443}, Env: map[string]string{"MODE": "prod"}},
+		{Name: "sidecar", Image: "app:1.0"},
+	}
+	expected.Labels = map[string]any{"tier": "web", "weight": 1.5}
+	expected.Extra = []any{nil, "yes"}
+	if !reflect.DeepEqual(d, expected) {
+		t.Errorf("expected %+v, got %+v", expected, d)
+	}
+}
+
+func TestUnmarshalInterface(t *testing.T) {
+	var v any
+	if err := Unmarshal([]byte("a:\n- 1\n- 'two'\n- false\nb:\nc: []\n"), &v); err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]any{"a": []any{1.0, "two", false}, "b": nil, "c": []any{}}
+	if !reflect.DeepEqual(v, expected) {
+		t.Errorf("expected %#v, got %#v", expected, v)
+	}
+}
+
+func TestUnmarshalScalars(t *testing.T) {
+	var v struct {
+		Version string
+		Count   uint8
+		Ratio   float32
+		Inf     float64
+		NaN     float64
+		Data    []byte
+		Null    *string
+		Kept    int
+		Array   [2]int
+		Keys    map[int]bool
+	}
+	input := "version: 1.10\ncount: 255\nratio: 0.5\ninf: -.inf\nnan: .NaN\ndata: aGk=\nnull: ~\nkept: null\narray:\n- 1\n- 2\n- 3\nkeys:\n  7: true\n"
+	v.Kept = 42
+	empty := ""
+	v.Null = &empty
+	if err := Unmarshal([]byte(input), &v); err != nil {
+		t.Fatal(err)
+	}
+	if v.Version != "1.10" || v.Count != 255 || v.Ratio != 0.5 || !math.IsInf(v.Inf, -1) || !math.IsNaN(v.NaN) {
+		t.Errorf("unexpected scalars %+v", v)
+	}
+	if string(v.Data) != "hi" || v.Null != nil || v.Kept != 42 || v.Array != [2]int{1, 2} || !v.Keys[7] {
+		t.Errorf("unexpected values %+v", v)
+	}
+}
+
+type embeddedBase struct {
+	ID   string `json:"id"`
+	Name string
+}
+
+type embedding struct {
+	embeddedBase
+	*Meta
+	Name string
+}
+
+type Meta struct {
+	Owner string `json:"owner"`
+}
+
+func TestUnmarshalEmbedded(t *testing.T) {
+	var v embedding
+	if err := Unmarshal([]byte("id: 1\nname: outer\nowner: me\n"), &v); err != nil {
+		t.Fatal(err)
+	}
+	if v.ID != "1" || v.Name != "outer" || v.embeddedBase.Name != "" || v.Meta == nil || v.Owner != "me" {
+		t.Errorf("unexpected value %+v", v)
+	}
+}
+
+// stringOrList accepts a single string or a sequence of strings.
+type stringOrList []string
+
+func (s *stringOrList) UnmarshalYAML(unmarshal func(any) error) error {
+	var single string
+	if err := unmarshal(&single); err == nil {
+		*s = stringOrList{single}
+		return nil
+	}
+	var list []string
+	if err := unmarshal(&list); err != nil {
+		return err
+	}
+	*s = list
+	return nil
+}
+
+type jsonHook struct {
+	raw string
+}
+
+func (j *jsonHook) UnmarshalJSON(data []byte) error {
+	j.raw = string(data)
+	return nil
+}
+
+type upper string
+
+func (u *upper) UnmarshalText(text []byte) error {
+	if len(text) == 0 {
+		return errors.New("empty text")
+	}
+	*u = upper(strings.ToUpper(string(text)))
+	return nil
+}
+
+func TestUnmarshalHooks(t *testing.T) {
+	var v struct {
+		One   stringOrList
+		Many  stringOrList
+		JSON  jsonHook
+		Text  upper
+		Keyed map[upper]int
+	}
+	input := "one: a\nmany:\n- b\n- c\njson:\n  k: \"[1]\"\n  n: 1.0\n  l:\n  - \"q\\\"\"\n  - ~\ntext: 0x1f\nkeyed:\n  x: 1\n"
+	if err := Unmarshal([]byte(input), &v); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(v.One, stringOrList{"a"}) || !reflect.DeepEqual(v.Many, stringOrList{"b", "c"}) {
+		t.Errorf("unexpected UnmarshalYAML results %v, %v", v.One, v.Many)
+	}
+	if expected := `{"k":"[1]","n":1.0,"l":["q\"",null]}`; v.JSON.raw != expected {
+		t.Errorf("expected the JSON %s, got %s", expected, v.JSON.raw)
+	}
+	if v.Text != "0X1F" || v.Keyed["X"] != 1 {
+		t.Errorf("unexpected UnmarshalText results %q, %v", v.Text, v.Keyed)
+	}
+}
+
+func TestUnmarshalHookError(t *testing.T) {
+	var v struct{ Text upper }
+	err := Unmarshal([]byte("a: 1\ntext: ''\n"), &v)
+	if err == nil || err.Error() != "line 2, column 7: empty text" {
+		t.Errorf("expected the error of the hook with its position, got %v", err)
+	}
+}
+
+func TestUnmarshalTypeError(t *testing.T) {
+	var v deployment
+	input := "kind: Deployment\nspec:\n  containers:\n  - name: app\n    ports:\n    - http\n    - 80\n"
+	err := Unmarshal([]byte(input), &v)
+	var typeErr *UnmarshalTypeError
+	if !errors.As(err, &typeErr) {
+		t.Fatalf("expected an UnmarshalTypeError, got %v", err)
+	}
+	expected := "line 6, column 7: cannot unmarshal string \"http\" into Go struct field spec.containers.0.ports.0 of type int"
+	if err.Error() != expected {
+		t.Errorf("expected %q, got %q", expected, err.Error())
+	}
+	// the rest of the document is decoded anyway
+	if v.Kind != "Deployment" || !reflect.DeepEqual(v.Spec.Containers[0].Ports, []int{0, 80}) {
+		t.Errorf("unexpected value %+v", v)
+	}
+}
+
+func TestUnmarshalTypeErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		target   any
+		expected string
+	}{
+		{"a: 1\n", new(string), "line 1, column 1: cannot unmarshal mapping into Go value of type string"},
+		{"- 1\n", new(map[string]int), "line 1, column 1: cannot unmarshal sequence into Go value of type map[string]int"},
+		{"1.5\n", new(int), "line 1, column 1: cannot unmarshal number 1.5 into Go value of type int"},
+		{"256\n", new(uint8), "line 1, column 1: cannot unmarshal number 256 into Go value of type uint8"},
+		{"yes\n", new(bool), "line 1, column 1: cannot unmarshal string \"yes\" into Go value of type bool"},
+		{"x: 1\n", new(map[int]int), "line 1, column 4: cannot unmarshal key \"x\" into Go struct field x of type int"},
+		{"a: 1\n", new(fmt.Stringer), "line 1, column 1: cannot unmarshal mapping into Go value of type fmt.Stringer"},
+	}
+	for _, test := range tests {
+		err := Unmarshal([]byte(test.input), test.target)
+		if err == nil || err.Error() != test.expected {
+			t.Errorf("%q: expected %q, got %v", test.input, test.expected, err)
+		}
+	}
+}
+
+func TestUnmarshalSyntaxError(t *testing.T) {
+	var v any
+	err := Unmarshal([]byte("a: 1\n b: 2\n"), &v)
+	var syntaxErr *SyntaxError
+	if !errors.As(err, &syntaxErr) || syntaxErr.Line != 2 {
+		t.Errorf("expected a syntax error in line 2, got %v", err)
+	}
+}
+
+func TestUnmarshalDocuments(t *testing.T) {
+	var v any
+	if err := Unmarshal([]byte("--- 1\n--- 2\n"), &v); err == nil {
+		t.Error("expected an error for two documents")
+	}
+	if err := UnmarshalWithOptions([]byte("--- 1\n--- 2\n"), &v, ParseOptions{MultiDocument: FirstDocument}); err != nil || v != 1.0 {
+		t.Errorf("expected the first document, got %v, %v", v, err)
+	}
+	var numbers []int
+	if err := UnmarshalWithOptions([]byte("--- 1\n--- 2\n"), &numbers, ParseOptions{MultiDocument: DocumentArray}); err != nil || !reflect.DeepEqual(numbers, []int{1, 2}) {
+		t.Errorf("expected both documents, got %v, %v", numbers, err)
+	}
+	v = "unchanged"
+	if err := Unmarshal(nil, &v); err != nil || v != "unchanged" {
+		t.Errorf("expected an empty input to change nothing, got %v, %v", v, err)
+	}
+	if err := Unmarshal([]byte("1"), v); err == nil {
+		t.Error("expected an error for a non-pointer")
+	}
+}
+
+func TestDecoder(t *testing.T) {
+	d := NewDecoder(strings.NewReader("a: 1\n---\na: x\n--- \nb: 3\n"))
+	var values []map[string]int
+	var errs []error
+	for {
+		var v map[string]int
+		err := d.Decode(&v)
+		if err == io.EOF {
+			break
+		}
+		values = append(values, v)
+		errs = append(errs, err)
+	}
+	expected := []map[string]int{{"a": 1}, {"a": 0}, {"b": 3}}
+	if !reflect.DeepEqual(values, expected) {
+		t.Errorf("expected %v, got %v", expected, values)
+	}
+	if errs[0] != nil || errs[1] == nil || errs[2] != nil {
+		t.Errorf("expected an error for the second document only, got %v", errs)
+	}
+}
+
+func TestDecoderDisallowUnknownFields(t *testing.T) {
+	d := NewDecoder(strings.NewReader("name: app\nimage: x\ntag: 1\n"))
+	d.DisallowUnknownFields()
+	var c container
+	err := d.Decode(&c)
+	if err == nil || err.Error() != "line 3, column 6: unknown field \"tag\"" {
+		t.Errorf("expected an unknown field error, got %v", err)
+	}
+	if c.Name != "app" || c.Image != "x" {
+		t.Errorf("unexpected value %+v", c)
+	}
+}
+
+func TestDecoderCaseInsensitiveFields(t *testing.T) {
+	var v struct {
+		Name     string
+		NAME     string `json:"exact"`
+		UserName string `json:"userName"`
+	}
+	if err := Unmarshal([]byte("NAME: a\nusername: b\nexact: c\n"), &v); err != nil {
+		t.Fatal(err)
+	}
+	if v.Name != "a" || v.UserName != "b" || v.NAME != "c" {
+		t.Errorf("unexpected value %+v", v)
+	}
+}
+
+func TestDecoderAliasLimit(t *testing.T) {
+	input := "a: &a x\nb: &b\n- *a\n- *a\nc:\n- *b\n- *b\n"
+	var v any
+	err := UnmarshalWithOptions([]byte(input), &v, ParseOptions{MaxAliasExpansions: 5})
+	if !errors.Is(err, ErrTooManyAliasExpansions) {
+		t.Errorf("expected ErrTooManyAliasExpansions, got %v", err)
+	}
+}
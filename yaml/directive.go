@@ -0,0 +1,160 @@
+package yaml
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Directives are lines starting with "%" in front of a document, see
+// https://yaml.org/spec/1.2.2/#68-directives. They apply to the next document
+// only, which must start with an explicit "---".
+
+// defaultTagHandles are the tag handles that are available without a %TAG
+// directive.
+var defaultTagHandles = map[string]string{
+	"!":  "!",
+	"!!": yamlTagPrefix,
+}
+
+// isDirective checks if a line that is not part of a document starts with a
+// "%".
+func isDirective(tokens []Token) bool {
+	return len(tokens) > 0 && tokens[0].Kind() == WORD && strings.HasPrefix(tokens[0].String(), "%")
+}
+
+// parseDirective records the %YAML or %TAG directive on the current line.
+func (p *parser) parseDirective(tokens []Token) error {
+	fields := strings.Fields(tokensToString(tokens))
+	switch fields[0] {
+	case "%YAML":
+		if len(fields) != 2 {
+			return p.syntaxError(0, "the %%YAML directive expects exactly one version")
+		}
+		return p.versionDirective(fields[1])
+	case "%TAG":
+		if len(fields) != 3 {
+			return p.syntaxError(0, "the %%TAG directive expects a tag handle and a prefix")
+		}
+		return p.tagDirective(fields[1], fields[2])
+	default:
+		// the spec says that unknown directives should be ignored
+		p.warn(0, "ignoring the unknown directive %s", fields[0])
+		return nil
+	}
+}
+
+func (p *parser) versionDirective(version string) error {
+	if p.version != "" {
+		return p.syntaxError(0, "the %%YAML directive is repeated")
+	}
+	major, minor, ok := strings.Cut(version, ".")
+	majorNumber, err1 := strconv.Atoi(major)
+	minorNumber, err2 := strconv.Atoi(minor)
+	if !ok || err1 != nil || err2 != nil {
+		return p.syntaxError(0, "malformed YAML version %q", version)
+	}
+	if majorNumber != 1 {
+		return p.syntaxError(0, "unsupported YAML version %s", version)
+	}
+	if minorNumber > 2 {
+		p.warn(0, "unsupported YAML version %s, parsing the document as YAML 1.2", version)
+	} else if minorNumber < 1 {
+		p.warn(0, "unsupported YAML version %s, parsing the document as YAML 1.1", version)
+	}
+	p.version = version
+	return nil
+}
+
+func (p *parser) tagDirective(handle, prefix string) error {
+	if !isTagHandle(handle) {
+		return p.syntaxError(0, "malformed tag handle %q", handle)
+	}
+	if _, ok := p.tagHandles[handle]; ok {
+		return p.syntaxError(0, "the tag handle %s is declared twice", handle)
+	}
+	if p.tagHandles == nil {
+		p.tagHandles = map[string]string{}
+	}
+	p.tagHandles[handle] = prefix
+	return nil
+}
+
+// documentSchema returns the schema for the document that the directives
+// belong to. A YAML 1.1 document uses the YAML 1.1 types instead of the core
+// schema, stricter schemas are kept.
+func (p *parser) documentSchema() Schema {
+	if p.opts.Schema != CoreSchema {
+		return p.opts.Schema
+	}
+	if major, minor, _ := strings.Cut(p.version, "."); major == "1" && (minor == "0" || minor == "1") {
+		return YAML11Schema
+	}
+	return CoreSchema
+}
+
+// resetDirectives forgets the directives of the previous document.
+func (p *parser) resetDirectives() {
+	p.version = ""
+	p.tagHandles = nil
+	p.hasDirectives = false
+}
+
+// isTagHandle checks for "!", "!!" or "!name!".
+func isTagHandle(handle string) bool {
+	if handle == "!" || handle == "!!" {
+		return true
+	}
+	if len(handle) < 3 || handle[0] != '!' || handle[len(handle)-1] != '!' {
+		return false
+	}
+	for _, r := range handle[1 : len(handle)-1] {
+		if !(r == '-' || r >= '0' && r <= '9' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z') {
+			return false
+		}
+	}
+	return true
+}
+
+// isTagSeparator checks for white space and control characters, which an
+// escape sequence must not smuggle into a tag.
+func isTagSeparator(r rune) bool {
+	return unicode.IsSpace(r) || unicode.IsControl(r)
+}
+
+// expandTag turns a tag shorthand like "!!str" or "!e!foo" into the full tag
+// by replacing the handle with its prefix.
+func (p *parser) expandTag(tag string) (string, error) {
+	if tag == "!" {
+		// the non-specific tag of quoted scalars
+		return tag, nil
+	}
+	if strings.HasPrefix(tag, "!<") {
+		if !strings.HasSuffix(tag, ">") || len(tag) == 3 {
+			return "", fmt.Errorf("malformed verbatim tag %s", tag)
+		}
+		return tag[2 : len(tag)-1], nil
+	}
+
+	handle, suffix := "!", tag[1:]
+	if i := strings.IndexByte(tag[1:], '!'); i >= 0 {
+		handle, suffix = tag[:i+2], tag[i+2:]
+	}
+	if !isTagHandle(handle) || suffix == "" {
+		return "", fmt.Errorf("malformed tag %s", tag)
+	}
+	prefix, ok := p.tagHandles[handle]
+	if !ok {
+		prefix, ok = defaultTagHandles[handle]
+	}
+	if !ok {
+		return "", fmt.Errorf("the tag %s uses an undeclared tag handle", tag)
+	}
+	decoded, err := url.PathUnescape(suffix)
+	if err != nil || strings.IndexFunc(decoded, isTagSeparator) >= 0 {
+		return "", fmt.Errorf("malformed escape sequence in the tag %s", tag)
+	}
+	return prefix + decoded, nil
+}
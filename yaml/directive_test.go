@@ -0,0 +1,178 @@
+package yaml
+
+import (
+	"hbibel/yaml-to-json/common"
+	"strings"
+	"testing"
+)
+
+func TestTokensToEventsYAML11Directive(t *testing.T) {
+	input := "%YAML 1.1\n---\n- yes\n- 0755\n- 1_000\n---\n- yes\n"
+	expectedEvents := []common.Event{
+		common.NewStartArrayEvent(),
+		common.NewEmitElementEvent(),
+		common.NewStartArrayEvent(),
+		common.NewEmitElementEvent(),
+		common.NewBooleanEvent("true"),
+		common.NewEmitElementEvent(),
+		common.NewNumberEvent("493"),
+		common.NewEmitElementEvent(),
+		common.NewNumberEvent("1000"),
+		common.NewEndArrayEvent(),
+		// the directive only applies to the first document
+		common.NewEmitElementEvent(),
+		common.NewStartArrayEvent(),
+		common.NewEmitElementEvent(),
+		common.NewStringEvent("yes"),
+		common.NewEndArrayEvent(),
+		common.NewEndArrayEvent(),
+	}
+	runTestWithOptions(t, tokenize(input), expectedEvents, ParseOptions{MultiDocument: DocumentArray})
+}
+
+func TestTokensToEventsYAML11DirectiveKeepsStricterSchema(t *testing.T) {
+	input := "%YAML 1.1\n--- yes\n"
+	expectedEvents := []common.Event{
+		common.NewStringEvent("yes"),
+	}
+	runTestWithOptions(t, tokenize(input), expectedEvents, ParseOptions{Schema: JSONSchema})
+}
+
+func TestTokensToEventsUnsupportedYAMLVersion(t *testing.T) {
+	var warnings []error
+	opts := ParseOptions{Warn: func(err error) { warnings = append(warnings, err) }}
+	input := "%YAML 1.3\n%FOO bar\n--- true\n"
+	runTestWithOptions(t, tokenize(input), []common.Event{common.NewBooleanEvent("true")}, opts)
+
+	if len(warnings) != 2 {
+		t.Fatal("Expected two warnings, got", warnings)
+	}
+	if err, ok := warnings[0].(*SyntaxError); !ok || err.Line != 1 || !strings.Contains(err.Msg, "1.3") {
+		t.Error("Unexpected warning:", warnings[0])
+	}
+	if err, ok := warnings[1].(*SyntaxError); !ok || err.Line != 2 || !strings.Contains(err.Msg, "%FOO") {
+		t.Error("Unexpected warning:", warnings[1])
+	}
+}
+
+func TestTokensToEventsDirectiveErrors(t *testing.T) {
+	runErrorTest(t, "%YAML 2.0\n---\n", 1, 1)
+	runErrorTest(t, "%YAML one\n---\n", 1, 1)
+	runErrorTest(t, "%YAML 1.2\n%YAML 1.2\n---\n", 2, 1)
+	runErrorTest(t, "%TAG !e! tag:a,2000:\n%TAG !e! tag:b,2000:\n---\n", 2, 1)
+	runErrorTest(t, "%TAG e tag:a,2000:\n---\n", 1, 1)
+	// the document must start with "---"
+	runErrorTest(t, "%YAML 1.2\nfoo\n", 2, 1)
+	runErrorTest(t, "%YAML 1.2\n", 2, 1)
+	// the previous document must be ended with "..."
+	runErrorTest(t, "a: 1\n%YAML 1.2\n---\nbar\n", 2, 1)
+}
+
+func TestTokensToEventsDirectiveAfterDocumentEnd(t *testing.T) {
+	input := "foo\n...\n%YAML 1.1\n--- on\n"
+	expectedEvents := []common.Event{
+		common.NewStringEvent("foo"),
+	}
+	runTestWithOptions(t, tokenize(input), expectedEvents, ParseOptions{MultiDocument: FirstDocument})
+}
+
+func TestTokensToEventsCoreTags(t *testing.T) {
+	input := strings.Join([]string{
+		"a: !!str 42",
+		"b: !!int \"42\"",
+		"c: !!bool 'true'",
+		"d: !!null ''",
+		"e: !!float .inf",
+		"f: ! 12",
+		"!!str g: !!str",
+		"h:",
+		"  !!str",
+		"  yes multi",
+		"  line",
+		"i: !<tag:yaml.org,2002:str> 1",
+		"j: !local 1",
+		"k: !!map",
+		"  l: !!seq",
+		"  - 1",
+	}, "\n")
+	expectedEvents := []common.Event{
+		common.NewStartMappingEvent(),
+		common.NewKeyEvent("a"),
+		common.NewStringEvent("42"),
+		common.NewKeyEvent("b"),
+		common.NewNumberEvent("42"),
+		common.NewKeyEvent("c"),
+		common.NewBooleanEvent("true"),
+		common.NewKeyEvent("d"),
+		common.NewNullEvent(),
+		common.NewKeyEvent("e"),
+		common.NewStringEvent(".inf"),
+		common.NewKeyEvent("f"),
+		common.NewStringEvent("12"),
+		common.NewKeyEvent("g"),
+		common.NewStringEvent(""),
+		common.NewKeyEvent("h"),
+		common.NewStringEvent("yes multi line"),
+		common.NewKeyEvent("i"),
+		common.NewStringEvent("1"),
+		common.NewKeyEvent("j"),
+		common.NewNumberEvent("1"),
+		common.NewKeyEvent("k"),
+		common.NewStartMappingEvent(),
+		common.NewKeyEvent("l"),
+		common.NewStartArrayEvent(),
+		common.NewEmitElementEvent(),
+		common.NewNumberEvent("1"),
+		common.NewEndArrayEvent(),
+		common.NewEndMappingEvent(),
+		common.NewEndMappingEvent(),
+	}
+	runTest(t, tokenize(input), expectedEvents)
+}
+
+func TestTokensToEventsTagDirective(t *testing.T) {
+	input := "%TAG !! tag:example.com,2000:\n%TAG !e! tag:yaml.org,2002:\n---\n- !e!int \"1\"\n- !!int \"1\"\n"
+	expectedEvents := []common.Event{
+		common.NewStartArrayEvent(),
+		common.NewEmitElementEvent(),
+		common.NewNumberEvent("1"),
+		common.NewEmitElementEvent(),
+		// !! no longer stands for the YAML tags
+		common.NewStringEvent("1"),
+		common.NewEndArrayEvent(),
+	}
+	runTest(t, tokenize(input), expectedEvents)
+}
+
+func TestTokensToEventsTagErrors(t *testing.T) {
+	runErrorTest(t, "a: !!int foo\n", 1, 10)
+	runErrorTest(t, "a: !e!foo bar\n", 1, 4)
+	runErrorTest(t, "- !!str !!str a\n", 1, 9)
+	runErrorTest(t, "!!seq - a\n", 1, 7)
+	// handles only apply to the document after the directive
+	runErrorTestWithOptions(t, "%TAG !e! tag:a,2000:\n--- !e!x a\n--- !e!x b\n", 3, 5, ParseOptions{MultiDocument: DocumentArray})
+}
+
+func TestExpandTag(t *testing.T) {
+	p := newParser(ParseOptions{})
+	p.tagHandles = map[string]string{"!e!": "tag:example.com,2000:app/"}
+	cases := map[string]string{
+		"!":                  "!",
+		"!!str":              "tag:yaml.org,2002:str",
+		"!local":             "!local",
+		"!e!foo":             "tag:example.com,2000:app/foo",
+		"!e!f%21o":           "tag:example.com,2000:app/f!o",
+		"!<tag:example.com>": "tag:example.com",
+	}
+	for tag, expected := range cases {
+		actual, err := p.expandTag(tag)
+		if err != nil || actual != expected {
+			t.Errorf("%s: expected %s, got %s (%v)", tag, expected, actual, err)
+		}
+	}
+	for _, tag := range []string{"!!", "!x!y", "!<>", "!<foo", "!e!%zz", "!e!a%0Ab", "!a%20b"} {
+		if _, err := p.expandTag(tag); err == nil {
+			t.Errorf("%s: expected an error", tag)
+		}
+	}
+}
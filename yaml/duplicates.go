@@ -0,0 +1,148 @@
+package yaml
+
+import "hash/maphash"
+
+// DuplicateKeyPolicy determines what happens if a mapping contains the same
+// key more than once, which YAML forbids.
+type DuplicateKeyPolicy int
+
+const (
+	// DuplicateKeyError reports a SyntaxError.
+	DuplicateKeyError DuplicateKeyPolicy = iota
+	// DuplicateKeyLastWins keeps the last entry with the key. Since the
+	// earlier entries cannot be taken back once they are passed on, the
+	// events of a mapping are held back until the mapping ends. This gives up
+	// streaming: the memory grows with the size of the outermost mapping,
+	// often the whole document, and the next stages only see it when it
+	// ends. Set ParseOptions.MaxBufferBytes to bound it for untrusted input.
+	DuplicateKeyLastWins
+	// DuplicateKeyFirstWins keeps the first entry with the key and drops
+	// the later ones.
+	DuplicateKeyFirstWins
+	// DuplicateKeyWarn passes a warning to ParseOptions.Warn and keeps the
+	// first entry like DuplicateKeyFirstWins. Passing on all entries would
+	// give JSON whose consumers disagree about the value of the key.
+	DuplicateKeyWarn
+)
+
+func (d DuplicateKeyPolicy) String() string {
+	switch d {
+	case DuplicateKeyError:
+		return "error"
+	case DuplicateKeyLastWins:
+		return "last-wins"
+	case DuplicateKeyFirstWins:
+		return "first-wins"
+	case DuplicateKeyWarn:
+		return "warn"
+	default:
+		return "unknown"
+	}
+}
+
+// keySet remembers the keys of a mapping. Only a 64 bit hash of each key is
+// stored, so the memory per key doesn't depend on the length of the key. Two
+// different keys are mistaken for duplicates with a negligible probability of
+// about 2^-64 per pair.
+type keySet struct {
+	// the index of each key's entry in starts
+	entries map[uint64]int
+	// the offsets of the events of the entries, only for
+	// DuplicateKeyLastWins
+	starts []int
+	// the offset of the START_MAPPING event
+	start int
+}
+
+// addKey records a key of the innermost mapping, which starts at column, and
+// applies the duplicate key policy. It must be called before the key event is
+// emitted.
+func (p *parser) addKey(key string, column int) error {
+	depth := len(p.breadcrumbs)
+	if p.skipDepth == depth {
+		// the entry that was skipped is complete
+		p.skipDepth = 0
+	}
+
+	keys := p.breadcrumbs[depth-1].keys
+	if keys.entries == nil {
+		keys.entries = map[uint64]int{}
+	}
+	hash := maphash.String(p.seed, key)
+	index, duplicate := keys.entries[hash]
+	offset := p.offset()
+	if p.opts.DuplicateKeys == DuplicateKeyLastWins {
+		keys.entries[hash] = len(keys.starts)
+		keys.starts = append(keys.starts, offset)
+	} else if !duplicate {
+		keys.entries[hash] = 0
+	}
+	if !duplicate {
+		return nil
+	}
+
+	switch p.opts.DuplicateKeys {
+	case DuplicateKeyLastWins:
+		// the entry ends where the next one starts
+		p.removeEvents(keys.starts[index], keys.starts[index+1])
+	case DuplicateKeyFirstWins, DuplicateKeyWarn:
+		if p.opts.DuplicateKeys == DuplicateKeyWarn {
+			p.warn(column, "duplicate mapping key %q, keeping the first entry", key)
+		}
+		if p.skipDepth == 0 {
+			p.skipDepth = depth
+		}
+	default:
+		return p.syntaxError(column, "duplicate mapping key %q", key)
+	}
+	return nil
+}
+
+// offset returns the number of events that have been emitted so far.
+func (p *parser) offset() int {
+	return p.flushed + len(p.events)
+}
+
+// removeEvents drops the events between the offsets start and end, which are
+// still held back, also from the anchored nodes that are being recorded.
+func (p *parser) removeEvents(start, end int) {
+	for i := start; i < end; i++ {
+		p.events[i-p.flushed] = nil
+	}
+	p.removed = true
+	if !p.discard {
+		for _, r := range p.recording {
+			r.remove(start, end)
+		}
+	}
+}
+
+// flushable returns how many events at the start of events can be passed on.
+// The events of a mapping are held back until the mapping ends if the earlier
+// entries of duplicate keys might have to be removed.
+func (p *parser) flushable() int {
+	if p.holdFrom >= 0 {
+		return p.holdFrom - p.flushed
+	}
+	if p.removed {
+		kept := p.events[:0]
+		for _, event := range p.events {
+			if event != nil {
+				kept = append(kept, event)
+			}
+		}
+		clear(p.events[len(kept):])
+		p.events = kept
+		p.removed = false
+	}
+	return len(p.events)
+}
+
+// flush drops the first n events, which have been passed on.
+func (p *parser) flush(n int) {
+	if n == 0 {
+		return
+	}
+	p.flushed += n
+	p.events = append(p.events[:0], p.events[n:]...)
+}
@@ -0,0 +1,196 @@
+package yaml
+
+import (
+	"context"
+	"fmt"
+	"hbibel/yaml-to-json/common"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const duplicatesInput = "a: 1\nb:\n  c: 2\n  c: 3\na:\n  - 4\nd: 5\n"
+
+func TestTokensToEventsDuplicateKeyError(t *testing.T) {
+	runErrorTest(t, duplicatesInput, 4, 3)
+	runErrorTest(t, "- x: 1\n  'x': 2\n", 2, 3)
+}
+
+func TestTokensToEventsSameKeyInDifferentMappings(t *testing.T) {
+	input := "a:\n  a: 1\nb:\n  a: 2\n"
+	expectedEvents := []common.Event{
+		common.NewStartMappingEvent(),
+		common.NewKeyEvent("a"),
+		common.NewStartMappingEvent(),
+		common.NewKeyEvent("a"),
+		common.NewNumberEvent("1"),
+		common.NewEndMappingEvent(),
+		common.NewKeyEvent("b"),
+		common.NewStartMappingEvent(),
+		common.NewKeyEvent("a"),
+		common.NewNumberEvent("2"),
+		common.NewEndMappingEvent(),
+		common.NewEndMappingEvent(),
+	}
+	runTest(t, tokenize(input), expectedEvents)
+}
+
+func TestTokensToEventsDuplicateKeyFirstWins(t *testing.T) {
+	expectedEvents := []common.Event{
+		common.NewStartMappingEvent(),
+		common.NewKeyEvent("a"),
+		common.NewNumberEvent("1"),
+		common.NewKeyEvent("b"),
+		common.NewStartMappingEvent(),
+		common.NewKeyEvent("c"),
+		common.NewNumberEvent("2"),
+		common.NewEndMappingEvent(),
+		common.NewKeyEvent("d"),
+		common.NewNumberEvent("5"),
+		common.NewEndMappingEvent(),
+	}
+	runTestWithOptions(t, tokenize(duplicatesInput), expectedEvents, ParseOptions{DuplicateKeys: DuplicateKeyFirstWins})
+}
+
+func TestTokensToEventsDuplicateKeyFirstWinsAtEndOfMapping(t *testing.T) {
+	input := "- a: 1\n  a:\n    b: 2\n    b: 3\n- c\n"
+	expectedEvents := []common.Event{
+		common.NewStartArrayEvent(),
+		common.NewEmitElementEvent(),
+		common.NewStartMappingEvent(),
+		common.NewKeyEvent("a"),
+		common.NewNumberEvent("1"),
+		common.NewEndMappingEvent(),
+		common.NewEmitElementEvent(),
+		common.NewStringEvent("c"),
+		common.NewEndArrayEvent(),
+	}
+	runTestWithOptions(t, tokenize(input), expectedEvents, ParseOptions{DuplicateKeys: DuplicateKeyFirstWins})
+}
+
+func TestTokensToEventsDuplicateKeyLastWins(t *testing.T) {
+	expectedEvents := []common.Event{
+		common.NewStartMappingEvent(),
+		common.NewKeyEvent("b"),
+		common.NewStartMappingEvent(),
+		common.NewKeyEvent("c"),
+		common.NewNumberEvent("3"),
+		common.NewEndMappingEvent(),
+		common.NewKeyEvent("a"),
+		common.NewStartArrayEvent(),
+		common.NewEmitElementEvent(),
+		common.NewNumberEvent("4"),
+		common.NewEndArrayEvent(),
+		common.NewKeyEvent("d"),
+		common.NewNumberEvent("5"),
+		common.NewEndMappingEvent(),
+	}
+	runTestWithOptions(t, tokenize(duplicatesInput), expectedEvents, ParseOptions{DuplicateKeys: DuplicateKeyLastWins})
+}
+
+func TestTokensToEventsDuplicateKeyLastWinsRepeatedly(t *testing.T) {
+	input := "- x\n- a: 1\n  b: 2\n  a: 3\n  a: 4\n- y\n"
+	expectedEvents := []common.Event{
+		common.NewStartArrayEvent(),
+		common.NewEmitElementEvent(),
+		common.NewStringEvent("x"),
+		common.NewEmitElementEvent(),
+		common.NewStartMappingEvent(),
+		common.NewKeyEvent("b"),
+		common.NewNumberEvent("2"),
+		common.NewKeyEvent("a"),
+		common.NewNumberEvent("4"),
+		common.NewEndMappingEvent(),
+		common.NewEmitElementEvent(),
+		common.NewStringEvent("y"),
+		common.NewEndArrayEvent(),
+	}
+	runTestWithOptions(t, tokenize(input), expectedEvents, ParseOptions{DuplicateKeys: DuplicateKeyLastWins})
+}
+
+func TestTokenBatchesToEventsDuplicateKeyLastWins(t *testing.T) {
+	input := "- x\n- a: 1\n  b: 2\n  a: 3\n- y\n- z\n"
+	tokens := make(chan []Token, 1)
+	tokens <- tokenize(input)
+	close(tokens)
+
+	batches, errc := TokenBatchesToEvents(context.Background(), tokens, ParseOptions{
+		DuplicateKeys: DuplicateKeyLastWins,
+		BatchSize:     2,
+	})
+	var events []common.Event
+	for batch := range batches {
+		if len(batch) > 2 {
+			t.Error("Batch too large:", batch)
+		}
+		events = append(events, batch...)
+	}
+	if err := <-errc; err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+
+	expectedEvents := []common.Event{
+		common.NewStartArrayEvent(),
+		common.NewEmitElementEvent(),
+		common.NewStringEvent("x"),
+		common.NewEmitElementEvent(),
+		common.NewStartMappingEvent(),
+		common.NewKeyEvent("b"),
+		common.NewNumberEvent("2"),
+		common.NewKeyEvent("a"),
+		common.NewNumberEvent("3"),
+		common.NewEndMappingEvent(),
+		common.NewEmitElementEvent(),
+		common.NewStringEvent("y"),
+		common.NewEmitElementEvent(),
+		common.NewStringEvent("z"),
+		common.NewEndArrayEvent(),
+	}
+	if !reflect.DeepEqual(events, expectedEvents) {
+		t.Error("Expected", expectedEvents, "got", events)
+	}
+}
+
+func TestTokensToEventsDuplicateKeyWarn(t *testing.T) {
+	var warnings []error
+	opts := ParseOptions{
+		DuplicateKeys: DuplicateKeyWarn,
+		Warn:          func(err error) { warnings = append(warnings, err) },
+	}
+	expectedEvents := []common.Event{
+		common.NewStartMappingEvent(),
+		common.NewKeyEvent("a"),
+		common.NewNumberEvent("1"),
+		common.NewEndMappingEvent(),
+	}
+	runTestWithOptions(t, tokenize("a: 1\na: 2\n"), expectedEvents, opts)
+
+	if len(warnings) != 1 {
+		t.Fatal("Expected one warning, got", warnings)
+	}
+	if err, ok := warnings[0].(*SyntaxError); !ok || err.Line != 2 || err.Column != 1 {
+		t.Error("Unexpected warning:", warnings[0])
+	}
+}
+
+func TestTokensToEventsLargeMappingWithoutDuplicates(t *testing.T) {
+	var sb strings.Builder
+	for i := 0; i < 100000; i++ {
+		fmt.Fprintf(&sb, "key%d: %d\n", i, i)
+	}
+	tokens := make(chan []Token, 1)
+	tokens <- tokenize(sb.String())
+	close(tokens)
+
+	batches, errc := TokenBatchesToEvents(context.Background(), tokens, ParseOptions{})
+	count := 0
+	for batch := range batches {
+		count += len(batch)
+	}
+	if err := <-errc; err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	if count != 2*100000+2 {
+		t.Error("Unexpected number of events:", count)
+	}
+}
@@ -0,0 +1,213 @@
+package yaml
+
+import (
+	"bufio"
+	"io"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// The character encodings that YAML streams may use. See
+// https://yaml.org/spec/1.2.2/#52-character-encodings
+type encoding int
+
+const (
+	utf8Encoding encoding = iota
+	utf16BEEncoding
+	utf16LEEncoding
+	utf32BEEncoding
+	utf32LEEncoding
+)
+
+// NewUTF8Reader wraps r, which may be encoded in UTF-8, UTF-16 or UTF-32, and
+// returns a reader for the same input as UTF-8. The encoding is detected from
+// the byte order mark or, in its absence, from the position of null bytes in
+// the first character, as described by the YAML spec. The byte order mark is
+// removed, and line breaks ("\r\n" and lone "\r") are normalized to "\n".
+// Invalid UTF-16 and UTF-32 code units are replaced by U+FFFD.
+func NewUTF8Reader(r io.Reader) io.Reader {
+	return &utf8Reader{
+		reader: bufio.NewReader(r),
+		in:     make([]byte, 32*1024),
+	}
+}
+
+type utf8Reader struct {
+	reader   *bufio.Reader
+	enc      encoding
+	detected bool
+
+	// in holds the raw input that is being decoded
+	in []byte
+	// partial holds the bytes of an incomplete code unit at the end of in
+	partial []byte
+	// out holds decoded output that hasn't been read yet. It is a slice of
+	// outBuf, which is reused for every fill.
+	out    []byte
+	outBuf []byte
+	// whether the last decoded character was a "\r"
+	afterCR bool
+	err     error
+}
+
+func (u *utf8Reader) Read(p []byte) (int, error) {
+	for len(u.out) == 0 && u.err == nil {
+		u.fill()
+	}
+	n := copy(p, u.out)
+	u.out = u.out[n:]
+	if n > 0 {
+		return n, nil
+	}
+	return 0, u.err
+}
+
+func (u *utf8Reader) fill() {
+	if !u.detected {
+		u.detect()
+	}
+
+	n, err := u.reader.Read(u.in)
+	in := u.in[:n]
+	if len(u.partial) > 0 {
+		in = append(u.partial, in...)
+		u.partial = nil
+	}
+
+	u.out = u.outBuf[:0]
+	defer func() { u.outBuf = u.out[:0] }()
+	switch u.enc {
+	case utf8Encoding:
+		// "\r" and "\n" never occur inside of multi-byte UTF-8 sequences, so
+		// there is no need to decode anything
+		for _, b := range in {
+			u.writeNormalized(b)
+		}
+		in = nil
+	case utf16BEEncoding, utf16LEEncoding:
+		in = u.decodeUTF16(in)
+	default:
+		in = u.decodeUTF32(in)
+	}
+
+	if err != nil {
+		if len(in) > 0 {
+			// the input ends in the middle of a code unit
+			u.out = utf8.AppendRune(u.out, utf8.RuneError)
+		}
+		u.err = err
+	} else if len(in) > 0 {
+		u.partial = append([]byte(nil), in...)
+	}
+}
+
+// detect determines the encoding and skips the byte order mark.
+func (u *utf8Reader) detect() {
+	u.detected = true
+	b, _ := u.reader.Peek(4)
+	for len(b) < 4 {
+		// pad with a non-null byte, so that short inputs compare correctly
+		b = append(b, 0xAA)
+	}
+
+	bom := 0
+	switch {
+	case b[0] == 0x00 && b[1] == 0x00 && b[2] == 0xFE && b[3] == 0xFF:
+		u.enc, bom = utf32BEEncoding, 4
+	case b[0] == 0x00 && b[1] == 0x00 && b[2] == 0x00:
+		u.enc = utf32BEEncoding
+	case b[0] == 0xFF && b[1] == 0xFE && b[2] == 0x00 && b[3] == 0x00:
+		u.enc, bom = utf32LEEncoding, 4
+	case b[1] == 0x00 && b[2] == 0x00 && b[3] == 0x00:
+		u.enc = utf32LEEncoding
+	case b[0] == 0xFE && b[1] == 0xFF:
+		u.enc, bom = utf16BEEncoding, 2
+	case b[0] == 0x00:
+		u.enc = utf16BEEncoding
+	case b[0] == 0xFF && b[1] == 0xFE:
+		u.enc, bom = utf16LEEncoding, 2
+	case b[1] == 0x00:
+		u.enc = utf16LEEncoding
+	case b[0] == 0xEF && b[1] == 0xBB && b[2] == 0xBF:
+		u.enc, bom = utf8Encoding, 3
+	default:
+		u.enc = utf8Encoding
+	}
+	u.reader.Discard(bom)
+}
+
+// decodeUTF16 decodes as many characters from in as possible and returns the
+// remaining bytes.
+func (u *utf8Reader) decodeUTF16(in []byte) []byte {
+	for len(in) >= 2 {
+		r1 := rune(u.uint16(in))
+		if !utf16.IsSurrogate(r1) {
+			u.writeRune(r1)
+			in = in[2:]
+			continue
+		}
+		if len(in) < 4 {
+			break
+		}
+		r := utf16.DecodeRune(r1, rune(u.uint16(in[2:])))
+		if r == utf8.RuneError {
+			// only skip the first code unit, the second one may be valid
+			u.writeRune(r)
+			in = in[2:]
+			continue
+		}
+		u.writeRune(r)
+		in = in[4:]
+	}
+	return in
+}
+
+func (u *utf8Reader) uint16(b []byte) uint16 {
+	if u.enc == utf16BEEncoding {
+		return uint16(b[0])<<8 | uint16(b[1])
+	}
+	return uint16(b[1])<<8 | uint16(b[0])
+}
+
+// decodeUTF32 decodes as many characters from in as possible and returns the
+// remaining bytes.
+func (u *utf8Reader) decodeUTF32(in []byte) []byte {
+	for len(in) >= 4 {
+		var r rune
+		if u.enc == utf32BEEncoding {
+			r = rune(in[0])<<24 | rune(in[1])<<16 | rune(in[2])<<8 | rune(in[3])
+		} else {
+			r = rune(in[3])<<24 | rune(in[2])<<16 | rune(in[1])<<8 | rune(in[0])
+		}
+		if !utf8.ValidRune(r) {
+			r = utf8.RuneError
+		}
+		u.writeRune(r)
+		in = in[4:]
+	}
+	return in
+}
+
+func (u *utf8Reader) writeRune(r rune) {
+	if r < utf8.RuneSelf {
+		u.writeNormalized(byte(r))
+	} else {
+		u.afterCR = false
+		u.out = utf8.AppendRune(u.out, r)
+	}
+}
+
+// writeNormalized appends an ASCII character to the output, turning "\r\n" and
+// "\r" into "\n".
+func (u *utf8Reader) writeNormalized(b byte) {
+	switch {
+	case b == '\r':
+		u.out = append(u.out, '\n')
+		u.afterCR = true
+	case b == '\n' && u.afterCR:
+		u.afterCR = false
+	default:
+		u.out = append(u.out, b)
+		u.afterCR = false
+	}
+}
@@ -0,0 +1,95 @@
+package yaml
+
+import (
+	"io"
+	"testing"
+	"testing/iotest"
+	"unicode/utf16"
+)
+
+func TestUTF8ReaderUTF8(t *testing.T) {
+	cases := map[string]string{
+		"":                       "",
+		"key: value\n":           "key: value\n",
+		"\xEF\xBB\xBFkey: value": "key: value",
+		"a: 1\r\nb: 2\r\n":       "a: 1\nb: 2\n",
+		"a: 1\rb: 2\r":           "a: 1\nb: 2\n",
+		"a\r\r\nb\n\rc":          "a\n\nb\n\nc",
+		"ä: ö\r\n":               "ä: ö\n",
+	}
+	for input, expected := range cases {
+		assertUTF8Reader(t, []byte(input), expected)
+	}
+}
+
+func TestUTF8ReaderUTF16(t *testing.T) {
+	text := "key: välue 😀\r\nnext\n"
+	units := utf16.Encode([]rune(text))
+	expected := "key: välue 😀\nnext\n"
+
+	be := make([]byte, 0, 2*len(units))
+	le := make([]byte, 0, 2*len(units))
+	for _, unit := range units {
+		be = append(be, byte(unit>>8), byte(unit))
+		le = append(le, byte(unit), byte(unit>>8))
+	}
+
+	assertUTF8Reader(t, be, expected)
+	assertUTF8Reader(t, le, expected)
+	assertUTF8Reader(t, append([]byte{0xFE, 0xFF}, be...), expected)
+	assertUTF8Reader(t, append([]byte{0xFF, 0xFE}, le...), expected)
+}
+
+func TestUTF8ReaderUTF32(t *testing.T) {
+	text := "key: välue 😀\r\nnext\n"
+	expected := "key: välue 😀\nnext\n"
+
+	be := []byte{}
+	le := []byte{}
+	for _, r := range text {
+		be = append(be, byte(r>>24), byte(r>>16), byte(r>>8), byte(r))
+		le = append(le, byte(r), byte(r>>8), byte(r>>16), byte(r>>24))
+	}
+
+	assertUTF8Reader(t, be, expected)
+	assertUTF8Reader(t, le, expected)
+	assertUTF8Reader(t, append([]byte{0x00, 0x00, 0xFE, 0xFF}, be...), expected)
+	assertUTF8Reader(t, append([]byte{0xFF, 0xFE, 0x00, 0x00}, le...), expected)
+}
+
+func TestUTF8ReaderInvalidUTF16(t *testing.T) {
+	// an unpaired high surrogate followed by 'a', and a truncated code unit
+	input := []byte{0xD8, 0x3D, 0x00, 'a', 0x00}
+	assertUTF8Reader(t, append([]byte{0xFE, 0xFF}, input...), "�a�")
+}
+
+// assertUTF8Reader reads the input both at once and byte by byte, to cover
+// characters and line breaks that are split across reads.
+func assertUTF8Reader(t *testing.T, input []byte, expected string) {
+	t.Helper()
+	for _, reader := range []io.Reader{
+		&sliceReader{input},
+		iotest.OneByteReader(&sliceReader{input}),
+	} {
+		actual, err := io.ReadAll(NewUTF8Reader(reader))
+		if err != nil {
+			t.Fatalf("%q: unexpected error: %v", input, err)
+		}
+		if string(actual) != expected {
+			t.Errorf("%q: expected %q, got %q", input, expected, actual)
+		}
+	}
+}
+
+type sliceReader struct {
+	data []byte
+}
+
+func (r *sliceReader) Read(p []byte) (int, error) {
+	if len(r.data) == 0 {
+		return 0, io.EOF
+	}
+	n := copy(p, r.data)
+	r.data = r.data[n:]
+	return n, nil
+}
@@ -0,0 +1,42 @@
+package yaml
+
+import (
+	"fmt"
+	"hbibel/yaml-to-json/common"
+)
+
+// SyntaxError reports input that is not valid YAML, or that uses a part of the
+// YAML spec that isn't supported.
+type SyntaxError struct {
+	// Line and Column locate the error in the input, both starting at 1.
+	Line   int
+	Column int
+	Msg    string
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("line %d, column %d: %s", e.Line, e.Column, e.Msg)
+}
+
+// syntaxError creates a SyntaxError for the given zero based column of the
+// current line.
+func (p *parser) syntaxError(column int, format string, args ...any) error {
+	return &SyntaxError{
+		Line:   p.line,
+		Column: column + 1,
+		Msg:    fmt.Sprintf(format, args...),
+	}
+}
+
+// position returns the position of the given zero based column of the
+// current line.
+func (p *parser) position(column int) common.Position {
+	return common.Position{Line: p.line, Column: column + 1}
+}
+
+// warn reports a problem that doesn't stop the parser to ParseOptions.Warn.
+func (p *parser) warn(column int, format string, args ...any) {
+	if p.opts.Warn != nil {
+		p.opts.Warn(p.syntaxError(column, format, args...))
+	}
+}
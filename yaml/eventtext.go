@@ -0,0 +1,358 @@
+package yaml
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"hbibel/yaml-to-json/common"
+	"io"
+	"strings"
+)
+
+// The event text notation of the yaml-test-suite, see
+// https://github.com/yaml/yaml-test-suite, describes an event stream with one
+// event per line:
+//
+//	+STR
+//	+DOC ---
+//	+MAP
+//	=VAL :key
+//	+SEQ [] &anchor <tag:yaml.org,2002:seq>
+//	=VAL "a double quoted\nscalar
+//	=ALI *anchor
+//	-SEQ
+//	-MAP
+//	-DOC
+//	-STR
+//
+// It is easier to read and to compare than the String methods of the events.
+
+// EventTextWriter writes events in the event text notation. EMIT_ELEMENT,
+// COMMENT and BLANK_LINE events have no equivalent and are skipped.
+type EventTextWriter struct {
+	w io.Writer
+	// detailed events carry the scalars as they were written, which the
+	// notation expects, other events only have the resolved values
+	detailed bool
+}
+
+func NewEventTextWriter(w io.Writer) *EventTextWriter {
+	return &EventTextWriter{w: w}
+}
+
+// Write writes the line for a single event.
+func (t *EventTextWriter) Write(event common.Event) error {
+	var line string
+	switch event.GetKind() {
+	case common.STREAM_START:
+		t.detailed = true
+		line = "+STR"
+	case common.STREAM_END:
+		line = "-STR"
+	case common.DOCUMENT_START:
+		line = "+DOC"
+		if e, ok := event.(*common.DocumentEvent); ok && e.Explicit {
+			line += " ---"
+		}
+	case common.DOCUMENT_END:
+		line = "-DOC"
+		if e, ok := event.(*common.DocumentEvent); ok && e.Explicit {
+			line += " ..."
+		}
+	case common.START_MAPPING:
+		line = "+MAP" + collectionText(event, "{}")
+	case common.END_MAPPING:
+		line = "-MAP"
+	case common.START_ARRAY:
+		line = "+SEQ" + collectionText(event, "[]")
+	case common.END_ARRAY:
+		line = "-SEQ"
+	case common.EMIT_ELEMENT, common.COMMENT, common.BLANK_LINE:
+		return nil
+	case common.ALIAS:
+		line = "=ALI *" + event.(*common.AliasEvent).Anchor
+	case common.EMIT_KEY, common.EMIT_VALUE:
+		line = "=VAL" + t.scalarText(event)
+	default:
+		return fmt.Errorf("cannot write the event %v", event)
+	}
+	_, err := io.WriteString(t.w, line+"\n")
+	return err
+}
+
+// collectionText returns the flow indicator and the properties of a
+// collection.
+func collectionText(event common.Event, flow string) string {
+	s := ""
+	if e, ok := event.(*common.CollectionEvent); ok {
+		if e.Style == common.FLOW {
+			s = " " + flow
+		}
+		s += propertiesText(e.Anchor, e.Tag)
+	}
+	return s
+}
+
+func (t *EventTextWriter) scalarText(event common.Event) string {
+	e, ok := event.(*common.EventWithPayload)
+	if !ok {
+		return " :"
+	}
+	text := e.Payload
+	if t.detailed {
+		text = e.Source
+	}
+	return propertiesText(e.Anchor, e.Tag) + " " + scalarIndicators[e.Style] + escapeEventText(text)
+}
+
+func propertiesText(anchor, tag string) string {
+	s := ""
+	if anchor != "" {
+		s += " &" + anchor
+	}
+	if tag != "" {
+		s += " <" + tag + ">"
+	}
+	return s
+}
+
+// scalarIndicators start the text of a scalar with the given style.
+var scalarIndicators = map[common.ScalarStyle]string{
+	common.PLAIN:         ":",
+	common.SINGLE_QUOTED: "'",
+	common.DOUBLE_QUOTED: "\"",
+	common.LITERAL:       "|",
+	common.FOLDED:        ">",
+}
+
+var eventTextEscaper = strings.NewReplacer(
+	"\\", "\\\\",
+	"\x00", "\\0",
+	"\b", "\\b",
+	"\t", "\\t",
+	"\n", "\\n",
+	"\r", "\\r",
+)
+
+var eventTextUnescaper = strings.NewReplacer(
+	"\\\\", "\\",
+	"\\0", "\x00",
+	"\\b", "\b",
+	"\\t", "\t",
+	"\\n", "\n",
+	"\\r", "\r",
+)
+
+func escapeEventText(s string) string {
+	return eventTextEscaper.Replace(s)
+}
+
+// EventTextReader parses the event text notation back into detailed events,
+// e.g. to replay a recorded event stream. Scalars are resolved with the core
+// schema, and EMIT_ELEMENT events are inserted in front of sequence entries,
+// so that the events can be rendered like those of the parser.
+type EventTextReader struct {
+	scanner *bufio.Scanner
+	line    int
+	// the open collections, with the number of nodes in each so far
+	stack []openCollection
+	// the events that have been parsed but not returned yet
+	pending []common.Event
+}
+
+type openCollection struct {
+	kind  common.EventType
+	nodes int
+}
+
+func NewEventTextReader(r io.Reader) *EventTextReader {
+	return &EventTextReader{scanner: bufio.NewScanner(r)}
+}
+
+// Read returns the next event, or io.EOF after the last one.
+func (t *EventTextReader) Read() (common.Event, error) {
+	for len(t.pending) == 0 {
+		if !t.scanner.Scan() {
+			if err := t.scanner.Err(); err != nil {
+				return nil, err
+			}
+			if len(t.stack) > 0 {
+				return nil, fmt.Errorf("line %d: unexpected end of the events", t.line)
+			}
+			return nil, io.EOF
+		}
+		t.line++
+		line := strings.TrimRight(t.scanner.Text(), "\r")
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		if err := t.parseLine(strings.TrimLeft(line, " ")); err != nil {
+			return nil, fmt.Errorf("line %d: %w", t.line, err)
+		}
+	}
+	event := t.pending[0]
+	t.pending = t.pending[1:]
+	return event, nil
+}
+
+// ReadEventText reads all events of the event text notation from r.
+func ReadEventText(r io.Reader) ([]common.Event, error) {
+	reader := NewEventTextReader(r)
+	events := []common.Event{}
+	for {
+		event, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			return events, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, event)
+	}
+}
+
+func (t *EventTextReader) parseLine(line string) error {
+	kind, rest, _ := strings.Cut(line, " ")
+	switch kind {
+	case "+STR":
+		t.pending = append(t.pending, common.NewStreamStartEvent())
+	case "-STR":
+		t.pending = append(t.pending, common.NewStreamEndEvent())
+	case "+DOC":
+		t.pending = append(t.pending, common.NewDocumentStartEvent(rest == "---"))
+	case "-DOC":
+		t.pending = append(t.pending, common.NewDocumentEndEvent(rest == "..."))
+	case "+MAP", "+SEQ":
+		return t.startCollection(kind, rest)
+	case "-MAP", "-SEQ":
+		return t.endCollection(kind)
+	case "=ALI":
+		if !strings.HasPrefix(rest, "*") || len(rest) == 1 {
+			return fmt.Errorf("malformed alias %q", rest)
+		}
+		t.startNode()
+		t.pending = append(t.pending, common.NewAliasEvent(rest[1:]))
+	case "=VAL":
+		return t.scalar(rest)
+	default:
+		return fmt.Errorf("unknown event %q", kind)
+	}
+	return nil
+}
+
+// startNode counts a node of the innermost collection and reports whether
+// it is a mapping key.
+func (t *EventTextReader) startNode() bool {
+	if len(t.stack) == 0 {
+		return false
+	}
+	top := &t.stack[len(t.stack)-1]
+	top.nodes++
+	if top.kind == common.START_ARRAY {
+		t.pending = append(t.pending, common.NewEmitElementEvent())
+		return false
+	}
+	return top.nodes%2 == 1
+}
+
+func (t *EventTextReader) startCollection(kind, rest string) error {
+	event := &common.CollectionEvent{Kind: common.START_MAPPING}
+	if kind == "+SEQ" {
+		event.Kind = common.START_ARRAY
+	}
+	if strings.HasPrefix(rest, "{}") || strings.HasPrefix(rest, "[]") {
+		event.Style = common.FLOW
+		rest = strings.TrimPrefix(rest[2:], " ")
+	}
+	var err error
+	if event.Anchor, event.Tag, rest, err = parseEventProperties(rest); err != nil {
+		return err
+	}
+	if rest != "" {
+		return fmt.Errorf("unexpected %q after %s", rest, kind)
+	}
+	if t.startNode() {
+		return errors.New("a collection cannot be a mapping key")
+	}
+	t.stack = append(t.stack, openCollection{kind: event.Kind})
+	t.pending = append(t.pending, event)
+	return nil
+}
+
+func (t *EventTextReader) endCollection(kind string) error {
+	want := common.START_MAPPING
+	event := common.NewEndMappingEvent()
+	if kind == "-SEQ" {
+		want = common.START_ARRAY
+		event = common.NewEndArrayEvent()
+	}
+	if len(t.stack) == 0 || t.stack[len(t.stack)-1].kind != want {
+		return fmt.Errorf("%s doesn't end the innermost collection", kind)
+	}
+	if want == common.START_MAPPING && t.stack[len(t.stack)-1].nodes%2 == 1 {
+		return errors.New("the last mapping key has no value")
+	}
+	t.stack = t.stack[:len(t.stack)-1]
+	t.pending = append(t.pending, event)
+	return nil
+}
+
+func (t *EventTextReader) scalar(rest string) error {
+	anchor, tag, rest, err := parseEventProperties(rest)
+	if err != nil {
+		return err
+	}
+	if rest == "" {
+		return errors.New("a scalar needs a style indicator")
+	}
+	style := common.ScalarStyle(-1)
+	for s, indicator := range scalarIndicators {
+		if rest[:1] == indicator {
+			style = s
+		}
+	}
+	if style < 0 {
+		return fmt.Errorf("unknown scalar style %q", rest[:1])
+	}
+	source := eventTextUnescaper.Replace(rest[1:])
+
+	var event *common.EventWithPayload
+	if t.startNode() {
+		event = common.NewKeyEvent(source).(*common.EventWithPayload)
+	} else {
+		resolved, err := resolveTagged(CoreSchema, tag, source, style == common.PLAIN)
+		if err != nil {
+			return err
+		}
+		event = resolved.(*common.EventWithPayload)
+	}
+	event.Source = source
+	event.Style = style
+	event.Tag = tag
+	event.Anchor = anchor
+	t.pending = append(t.pending, event)
+	return nil
+}
+
+// parseEventProperties splits an anchor like "&a" and a tag like "<tag>" off
+// the start of s.
+func parseEventProperties(s string) (anchor, tag, rest string, err error) {
+	if strings.HasPrefix(s, "&") {
+		anchor, s, _ = strings.Cut(s[1:], " ")
+		if anchor == "" {
+			return "", "", "", errors.New("an anchor needs a name")
+		}
+	}
+	if strings.HasPrefix(s, "<") {
+		// a tag cannot contain spaces, but it may contain ">"
+		end := strings.Index(s, "> ")
+		if end < 0 && strings.HasSuffix(s, ">") {
+			end = len(s) - 1
+		}
+		if end < 0 {
+			return "", "", "", fmt.Errorf("malformed tag %q", s)
+		}
+		tag, s = s[1:end], strings.TrimPrefix(s[end+1:], " ")
+	}
+	return anchor, tag, s, nil
+}
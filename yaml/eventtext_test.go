@@ -0,0 +1,168 @@
+package yaml
+
+import (
+	"bytes"
+	"context"
+	"hbibel/yaml-to-json/common"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestEventTextWriter(t *testing.T) {
+	input := "%TAG !e! tag:example.com,2000:\n--- !e!root\n\"k\": &a 'v\\n'\nl: &s\n- *a\n- 0x1F\n- \"a\\tb\"\n*a : !!str 1\ne:\n...\n"
+	expected := `+STR
++DOC ---
++MAP <tag:example.com,2000:root>
+=VAL "k
+=VAL &a 'v\\n
+=VAL :l
++SEQ &s
+=ALI *a
+=VAL :0x1F
+=VAL "a\tb
+-SEQ
+=ALI *a
+=VAL <tag:yaml.org,2002:str> :1
+=VAL :e
+=VAL :
+-MAP
+-DOC ...
+-STR
+`
+	var out bytes.Buffer
+	writer := NewEventTextWriter(&out)
+	for _, event := range parseDetailed(t, input) {
+		if err := writer.Write(event); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if out.String() != expected {
+		t.Errorf("expected\n%s\ngot\n%s", expected, out.String())
+	}
+}
+
+func TestEventTextWriterUndetailedEvents(t *testing.T) {
+	events := []common.Event{
+		common.NewStartArrayEvent(),
+		common.NewEmitElementEvent(),
+		common.NewNumberEvent("31"),
+		common.NewEndArrayEvent(),
+	}
+	var out bytes.Buffer
+	writer := NewEventTextWriter(&out)
+	for _, event := range events {
+		if err := writer.Write(event); err != nil {
+			t.Fatal(err)
+		}
+	}
+	expected := "+SEQ\n=VAL :31\n-SEQ\n"
+	if out.String() != expected {
+		t.Errorf("expected %q, got %q", expected, out.String())
+	}
+}
+
+func TestEventTextRoundTrip(t *testing.T) {
+	inputs := []string{
+		"a: 1\nb:\n- x\n- &n null\n- *n\nc: 'y'\n",
+		"--- 0o17\n--- !!str true\n...\n",
+		"- - 1\n  - 2\n- k: v\n",
+		"k:\n",
+	}
+	for _, input := range inputs {
+		events := parseDetailed(t, input)
+		var out bytes.Buffer
+		writer := NewEventTextWriter(&out)
+		for _, event := range events {
+			if err := writer.Write(event); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		replayed, err := ReadEventText(&out)
+		if err != nil {
+			t.Errorf("%q: unexpected error: %v", input, err)
+			continue
+		}
+		// the notation has no positions
+		clearPositions(events)
+		if !reflect.DeepEqual(replayed, events) {
+			t.Errorf("%q: expected %v, got %v", input, events, replayed)
+		}
+	}
+}
+
+func TestEventTextReaderFlowCollections(t *testing.T) {
+	text := "+STR\n+DOC\n+SEQ [] &a <tag:yaml.org,2002:seq>\n+MAP {}\n=VAL 'k\n=VAL |line\\n\n-MAP\n-SEQ\n-DOC\n-STR\n"
+	expected := []common.Event{
+		common.NewStreamStartEvent(),
+		common.NewDocumentStartEvent(false),
+		&common.CollectionEvent{Kind: common.START_ARRAY, Style: common.FLOW, Tag: "tag:yaml.org,2002:seq", Anchor: "a"},
+		common.NewEmitElementEvent(),
+		&common.CollectionEvent{Kind: common.START_MAPPING, Style: common.FLOW},
+		&common.EventWithPayload{Kind: common.EMIT_KEY, PayloadType: common.STRING, Payload: "k", Source: "k", Style: common.SINGLE_QUOTED},
+		&common.EventWithPayload{Kind: common.EMIT_VALUE, PayloadType: common.STRING, Payload: "line\n", Source: "line\n", Style: common.LITERAL},
+		common.NewEndMappingEvent(),
+		common.NewEndArrayEvent(),
+		common.NewDocumentEndEvent(false),
+		common.NewStreamEndEvent(),
+	}
+	events, err := ReadEventText(strings.NewReader(text))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(events, expected) {
+		t.Errorf("expected %v, got %v", expected, events)
+	}
+}
+
+func TestEventTextReaderErrors(t *testing.T) {
+	inputs := []string{
+		"+MAP\n",
+		"+SEQ\n-MAP\n",
+		"+MAP\n=VAL :k\n-MAP\n",
+		"+MAP\n+SEQ\n-SEQ\n",
+		"=VAL x\n",
+		"=VAL <tag:yaml.org,2002:int> :abc\n",
+		"=ALI a\n",
+		"+FOO\n",
+	}
+	for _, input := range inputs {
+		if _, err := ReadEventText(strings.NewReader(input)); err == nil {
+			t.Errorf("%q: expected an error", input)
+		}
+	}
+}
+
+func parseDetailed(t *testing.T, input string) []common.Event {
+	t.Helper()
+	tokens := make(chan Token)
+	go func() {
+		defer close(tokens)
+		for _, token := range tokenize(input) {
+			tokens <- token
+		}
+	}()
+	eventChannel, errc := TokensToEventsWithOptions(context.Background(), tokens, ParseOptions{Detailed: true})
+	events := []common.Event{}
+	for event := range eventChannel {
+		events = append(events, event)
+	}
+	if err := <-errc; err != nil {
+		t.Fatalf("%q: unexpected error: %v", input, err)
+	}
+	return events
+}
+
+func clearPositions(events []common.Event) {
+	for _, event := range events {
+		switch e := event.(type) {
+		case *common.EventWithPayload:
+			e.Position = common.Position{}
+		case *common.CollectionEvent:
+			e.Position = common.Position{}
+		case *common.AliasEvent:
+			e.Position = common.Position{}
+		}
+	}
+}
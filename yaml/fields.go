@@ -0,0 +1,153 @@
+package yaml
+
+import (
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// field is a struct field that a mapping key can be decoded into.
+type field struct {
+	name string
+	// the indices of the field and the embedded structs that contain it
+	index []int
+	// whether the name comes from a tag
+	tagged bool
+}
+
+type structFields struct {
+	list   []field
+	byName map[string]*field
+}
+
+// lookup returns the field with the given name, or with a name that only
+// differs in case if there is none, or nil.
+func (f *structFields) lookup(name string) *field {
+	if field, ok := f.byName[name]; ok {
+		return field
+	}
+	for i := range f.list {
+		if strings.EqualFold(f.list[i].name, name) {
+			return &f.list[i]
+		}
+	}
+	return nil
+}
+
+var fieldCache sync.Map
+
+func cachedTypeFields(t reflect.Type) *structFields {
+	if f, ok := fieldCache.Load(t); ok {
+		return f.(*structFields)
+	}
+	f, _ := fieldCache.LoadOrStore(t, typeFields(t))
+	return f.(*structFields)
+}
+
+// fieldName returns the name that a struct field has in YAML, and whether it
+// comes from a tag. A `yaml` tag takes precedence over a `json` tag. Options
+// like "omitempty" only matter for encoding. The name is "-" if the field is
+// ignored.
+func fieldName(sf reflect.StructField) (string, bool) {
+	tag, ok := sf.Tag.Lookup("yaml")
+	if !ok {
+		tag = sf.Tag.Get("json")
+	}
+	if tag == "-" {
+		return "-", true
+	}
+	name, _, _ := strings.Cut(tag, ",")
+	return name, name != ""
+}
+
+// typeFields returns the fields of a struct type including those of embedded
+// structs without a name, like encoding/json: a field hides the fields with
+// the same name that are embedded more deeply, and of several fields with the
+// same name at the same depth, only a single tagged one is kept.
+func typeFields(t reflect.Type) *structFields {
+	type embedded struct {
+		typ   reflect.Type
+		index []int
+	}
+	var fields []field
+	seen := map[string]bool{}
+	visited := map[reflect.Type]bool{}
+	next := []embedded{{typ: t}}
+	for len(next) > 0 {
+		current := next
+		next = nil
+		var level []field
+		for _, e := range current {
+			if visited[e.typ] {
+				continue
+			}
+			visited[e.typ] = true
+			for i := 0; i < e.typ.NumField(); i++ {
+				sf := e.typ.Field(i)
+				name, tagged := fieldName(sf)
+				if name == "-" {
+					continue
+				}
+				index := append(append([]int{}, e.index...), i)
+				ft := sf.Type
+				if ft.Kind() == reflect.Pointer {
+					ft = ft.Elem()
+				}
+				if sf.Anonymous && !tagged && ft.Kind() == reflect.Struct {
+					next = append(next, embedded{typ: ft, index: index})
+					continue
+				}
+				if !sf.IsExported() {
+					continue
+				}
+				if !tagged {
+					name = sf.Name
+				}
+				level = append(level, field{name: name, index: index, tagged: tagged})
+			}
+		}
+		fields = append(fields, dominantFields(level, seen)...)
+	}
+
+	f := &structFields{list: fields, byName: map[string]*field{}}
+	for i := range f.list {
+		f.byName[f.list[i].name] = &f.list[i]
+	}
+	return f
+}
+
+// dominantFields returns the fields of a single depth that aren't hidden by
+// fields of smaller depths, whose names are in seen, or by each other.
+func dominantFields(level []field, seen map[string]bool) []field {
+	byName := map[string][]field{}
+	var names []string
+	for _, f := range level {
+		if seen[f.name] {
+			continue
+		}
+		if _, ok := byName[f.name]; !ok {
+			names = append(names, f.name)
+		}
+		byName[f.name] = append(byName[f.name], f)
+	}
+	var fields []field
+	for _, name := range names {
+		// the name is taken even if the fields cancel each other out
+		seen[name] = true
+		candidates := byName[name]
+		if len(candidates) == 1 {
+			fields = append(fields, candidates[0])
+			continue
+		}
+		var tagged []field
+		for _, f := range candidates {
+			if f.tagged {
+				tagged = append(tagged, f)
+			}
+		}
+		if len(tagged) == 1 {
+			fields = append(fields, tagged[0])
+		}
+	}
+	return fields
+}
@@ -0,0 +1,274 @@
+package yaml
+
+import (
+	"bytes"
+	"context"
+	"hbibel/yaml-to-json/common"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+// Run the fuzz targets with e.g.
+//
+//	go test ./yaml -run '^$' -fuzz FuzzTokensToEvents
+//
+// Inputs that fail are written to testdata/fuzz, where they become part of
+// the seed corpus that every go test run checks.
+
+// fuzzTimeout is how long a pipeline stage may take for a single input
+// before it is considered to hang.
+const fuzzTimeout = 10 * time.Second
+
+var fuzzSeeds = []string{
+	"",
+	"foo",
+	"- a\n- b\n",
+	"a: 1\nb:\n  - x\n  - y: z\n",
+	"key:\n- indentless\n- sequence\n",
+	"'single ''quoted'''\n\"double \\\"quoted\\\"\\n\"\n",
+	"\"multi\n  line\"\n",
+	"%YAML 1.1\n%TAG !e! tag:example.com,2000:\n--- !e!foo\n!!int 0755\n",
+	"&a a: &b [b]\n*b : *a\n",
+	"--- 1\n--- 2\n...\n",
+	"- - - deep\n    - x\n",
+	"a:\n  b:\n c\n",
+	"\t- tab\n",
+	":\n-\n- :\n",
+	"? complex\n: key\n",
+	"\xef\xbb\xbfbom: 1\r\n",
+}
+
+func addFuzzSeeds(f *testing.F) {
+	for _, seed := range fuzzSeeds {
+		f.Add(seed)
+	}
+}
+
+// FuzzTokenize checks that Tokenize terminates, that the tokens of each line
+// add up to the line, and that Scanner produces the same tokens.
+func FuzzTokenize(f *testing.F) {
+	addFuzzSeeds(f)
+	f.Fuzz(func(t *testing.T, input string) {
+		if !utf8.ValidString(input) || strings.ContainsRune(input, '\r') {
+			// Tokenize works on runes and Scanner on bytes, and only
+			// Scanner handles line breaks
+			t.Skip()
+		}
+		lines := strings.Split(strings.TrimSuffix(input, "\n"), "\n")
+		if input == "" {
+			lines = nil
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), fuzzTimeout)
+		defer cancel()
+		lineChannel := make(chan string)
+		tokenChannel := make(chan Token)
+		go func() {
+			defer close(lineChannel)
+			for _, line := range lines {
+				select {
+				case lineChannel <- line:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+		errc := TokenizeContext(ctx, lineChannel, tokenChannel)
+		tokens := []Token{}
+		for token := range tokenChannel {
+			tokens = append(tokens, token)
+		}
+		if err := <-errc; err != nil {
+			t.Fatalf("the tokenizer did not terminate: %v", err)
+		}
+
+		var reconstructed strings.Builder
+		for _, token := range tokens {
+			reconstructed.WriteString(token.String())
+		}
+		if expected := strings.Join(lines, "\n") + strings.Repeat("\n", min(len(lines), 1)); reconstructed.String() != expected {
+			t.Fatalf("the tokens %q don't add up to the input", reconstructed.String())
+		}
+
+		scanned := tokenize(input)
+		if !sameTokens(tokens, scanned) {
+			t.Fatalf("Tokenize produced %v, but Scanner produced %v", tokens, scanned)
+		}
+	})
+}
+
+func sameTokens(a, b []Token) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].Kind() != b[i].Kind() || a[i].String() != b[i].String() {
+			return false
+		}
+	}
+	return true
+}
+
+// FuzzTokensToEvents checks that the parser terminates without panicking,
+// that its events are well-formed, and that the detailed events survive a
+// round trip through the event text notation. The replayed events are
+// compared in the notation, because the reader always resolves scalars with
+// the core schema.
+func FuzzTokensToEvents(f *testing.F) {
+	addFuzzSeeds(f)
+	f.Fuzz(func(t *testing.T, input string) {
+		for _, opts := range []ParseOptions{
+			{},
+			{MultiDocument: DocumentArray, DuplicateKeys: DuplicateKeyLastWins},
+			{Detailed: true, DuplicateKeys: DuplicateKeyFirstWins},
+		} {
+			events, err := fuzzParse(t, input, opts)
+			if err != nil {
+				continue
+			}
+			if err := checkEventStructure(events); err != "" {
+				t.Fatalf("%+v: %s in %v", opts, err, events)
+			}
+			if !opts.Detailed {
+				continue
+			}
+
+			text := eventText(t, events)
+			replayed, err := ReadEventText(strings.NewReader(text))
+			if err != nil {
+				t.Fatalf("cannot read the events back: %v\n%s", err, text)
+			}
+			if replayedText := eventText(t, replayed); replayedText != text {
+				t.Fatalf("the events\n%s\nchanged to\n%s", text, replayedText)
+			}
+		}
+	})
+}
+
+func eventText(t *testing.T, events []common.Event) string {
+	var text bytes.Buffer
+	writer := NewEventTextWriter(&text)
+	for _, event := range events {
+		if err := writer.Write(event); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return text.String()
+}
+
+// fuzzParse tokenizes and parses the input and fails the test if the parser
+// doesn't terminate.
+func fuzzParse(t *testing.T, input string, opts ParseOptions) ([]common.Event, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), fuzzTimeout)
+	defer cancel()
+
+	tokens := make(chan Token)
+	tokenizeErrs := TokenizeReader(ctx, NewUTF8Reader(strings.NewReader(input)), tokens)
+	eventChannel, parseErrs := TokensToEventsWithOptions(ctx, tokens, opts)
+	events := []common.Event{}
+	for event := range eventChannel {
+		events = append(events, event)
+	}
+	err := <-parseErrs
+	if err != nil {
+		cancel()
+	}
+	for range tokens {
+	}
+	if tokenizeErr := <-tokenizeErrs; err == nil {
+		err = tokenizeErr
+	}
+	if ctx.Err() == context.DeadlineExceeded {
+		t.Fatal("the pipeline did not terminate")
+	}
+	return events, err
+}
+
+// checkEventStructure checks that collections are balanced, that mapping
+// entries consist of a key and a value, and that EMIT_ELEMENT precedes each
+// sequence entry. It returns a description of the first problem.
+func checkEventStructure(events []common.Event) string {
+	type open struct {
+		kind common.EventType
+		// whether the next node is a key, or follows an EMIT_ELEMENT
+		expectKey, afterElement bool
+	}
+	var stack []open
+	roots := 0
+	node := func() string {
+		if len(stack) == 0 {
+			roots++
+			return ""
+		}
+		top := &stack[len(stack)-1]
+		if top.kind == common.START_MAPPING {
+			if top.expectKey {
+				return "a value in place of a key"
+			}
+			top.expectKey = true
+		} else {
+			if !top.afterElement {
+				return "a sequence entry without EMIT_ELEMENT"
+			}
+			top.afterElement = false
+		}
+		return ""
+	}
+
+	for _, event := range events {
+		switch event.GetKind() {
+		case common.START_MAPPING, common.START_ARRAY:
+			if err := node(); err != "" {
+				return err
+			}
+			stack = append(stack, open{kind: event.GetKind(), expectKey: true})
+		case common.END_MAPPING, common.END_ARRAY:
+			start := common.START_MAPPING
+			if event.GetKind() == common.END_ARRAY {
+				start = common.START_ARRAY
+			}
+			if len(stack) == 0 || stack[len(stack)-1].kind != start {
+				return "an unbalanced end of a collection"
+			}
+			if top := stack[len(stack)-1]; !top.expectKey || top.afterElement {
+				return "an incomplete entry"
+			}
+			stack = stack[:len(stack)-1]
+		case common.EMIT_KEY:
+			if len(stack) == 0 || stack[len(stack)-1].kind != common.START_MAPPING || !stack[len(stack)-1].expectKey {
+				return "a key outside of a mapping key position"
+			}
+			stack[len(stack)-1].expectKey = false
+		case common.ALIAS:
+			top := len(stack) - 1
+			if top >= 0 && stack[top].kind == common.START_MAPPING && stack[top].expectKey {
+				stack[top].expectKey = false
+				continue
+			}
+			if err := node(); err != "" {
+				return err
+			}
+		case common.EMIT_VALUE:
+			if err := node(); err != "" {
+				return err
+			}
+		case common.EMIT_ELEMENT:
+			if len(stack) == 0 || stack[len(stack)-1].kind != common.START_ARRAY || stack[len(stack)-1].afterElement {
+				return "a misplaced EMIT_ELEMENT"
+			}
+			stack[len(stack)-1].afterElement = true
+		case common.DOCUMENT_START:
+			roots = 0
+		case common.DOCUMENT_END:
+			if roots != 1 {
+				return "a document without exactly one root node"
+			}
+		}
+	}
+	if len(stack) > 0 {
+		return "an unclosed collection"
+	}
+	return ""
+}
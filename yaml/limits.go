@@ -0,0 +1,68 @@
+package yaml
+
+import (
+	"errors"
+	"fmt"
+	"hbibel/yaml-to-json/common"
+)
+
+// The parser reports these errors, wrapped with the line number, when the
+// input exceeds one of the limits of ParseOptions. This protects services that
+// convert untrusted input from deeply nested documents and alias bombs.
+var (
+	ErrNestingTooDeep         = errors.New("nesting too deep")
+	ErrScalarTooLong          = errors.New("scalar too long")
+	ErrTooManyEvents          = errors.New("too many events")
+	ErrTooManyAliasExpansions = errors.New("too many alias expansions")
+	// ErrBufferLimit is the same error as json.ErrBufferLimit.
+	ErrBufferLimit = common.ErrBufferLimit
+)
+
+func (p *parser) limitError(err error) error {
+	return fmt.Errorf("line %d: %w", p.line, err)
+}
+
+// checkDepth fails if opening another block collection would exceed
+// MaxDepth.
+func (p *parser) checkDepth() error {
+	// the document itself doesn't count
+	if p.opts.MaxDepth > 0 && len(p.breadcrumbs) > p.opts.MaxDepth {
+		return p.limitError(ErrNestingTooDeep)
+	}
+	return nil
+}
+
+// checkScalarLength fails if a scalar of the given length in bytes exceeds
+// MaxScalarLength.
+func (p *parser) checkScalarLength(length int) error {
+	if p.opts.MaxScalarLength > 0 && length > p.opts.MaxScalarLength {
+		return p.limitError(ErrScalarTooLong)
+	}
+	return nil
+}
+
+// checkEventCount fails if more than MaxEvents events have been emitted.
+func (p *parser) checkEventCount() error {
+	if p.opts.MaxEvents > 0 && p.eventCount > p.opts.MaxEvents {
+		return p.limitError(ErrTooManyEvents)
+	}
+	return nil
+}
+
+// checkHeldBytes fails if the events that are held back for
+// DuplicateKeyLastWins exceed MaxBufferBytes.
+func (p *parser) checkHeldBytes() error {
+	if p.opts.MaxBufferBytes > 0 && p.heldBytes > p.opts.MaxBufferBytes {
+		return p.limitError(ErrBufferLimit)
+	}
+	return nil
+}
+
+// eventSize estimates the memory of an event by the size of its JSON: its
+// payload and a byte for the punctuation.
+func eventSize(event common.Event) int {
+	if e, ok := event.(common.HasPayload); ok {
+		return len(e.GetPayload()) + 1
+	}
+	return 1
+}
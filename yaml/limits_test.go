@@ -0,0 +1,79 @@
+package yaml
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestTokensToEventsLimits(t *testing.T) {
+	bomb := "a: &a [x]\nb: &b\n- *a\n- *a\nc: &c\n- *b\n- *b\nd:\n- *c\n- *c\n"
+	bomb = strings.Replace(bomb, "[x]", "\n  - x\n  - x", 1)
+	cases := []struct {
+		input    string
+		opts     ParseOptions
+		expected error
+	}{
+		{"- - - x\n", ParseOptions{MaxDepth: 2}, ErrNestingTooDeep},
+		{"a:\n  b:\n    c: x\n", ParseOptions{MaxDepth: 2}, ErrNestingTooDeep},
+		{"a: 12345\n", ParseOptions{MaxScalarLength: 4}, ErrScalarTooLong},
+		{"12345: a\n", ParseOptions{MaxScalarLength: 4}, ErrScalarTooLong},
+		{"- 12\n  345\n", ParseOptions{MaxScalarLength: 4}, ErrScalarTooLong},
+		{"- '12\n  345'\n", ParseOptions{MaxScalarLength: 4}, ErrScalarTooLong},
+		{"- 1\n- 2\n- 3\n", ParseOptions{MaxEvents: 6}, ErrTooManyEvents},
+		{bomb, ParseOptions{MaxAliasExpansions: 20}, ErrTooManyAliasExpansions},
+		{bomb, ParseOptions{MaxEvents: 40}, ErrTooManyEvents},
+		{"a: 1\nb: 2\nc: 3\n", ParseOptions{DuplicateKeys: DuplicateKeyLastWins, MaxBufferBytes: 6}, ErrBufferLimit},
+		{"- a:\n    b: 12345\n", ParseOptions{DuplicateKeys: DuplicateKeyLastWins, MaxBufferBytes: 8}, ErrBufferLimit},
+	}
+	for _, c := range cases {
+		err := parseWithOptions(c.input, c.opts)
+		if !errors.Is(err, c.expected) {
+			t.Errorf("%q: expected %v, got %v", c.input, c.expected, err)
+		}
+	}
+}
+
+func TestTokensToEventsWithinLimits(t *testing.T) {
+	opts := ParseOptions{MaxDepth: 2, MaxScalarLength: 5, MaxEvents: 16, MaxAliasExpansions: 6}
+	input := "a: &a\n- 12345\n- x\nb: *a\n"
+	if err := parseWithOptions(input, opts); err != nil {
+		t.Error("Unexpected error:", err)
+	}
+	// only the mappings that are held back count
+	input = "a: 1\nb: 2\n"
+	for _, opts := range []ParseOptions{
+		{DuplicateKeys: DuplicateKeyLastWins, MaxBufferBytes: 10},
+		{MaxBufferBytes: 1},
+	} {
+		if err := parseWithOptions(input, opts); err != nil {
+			t.Errorf("%+v: unexpected error: %v", opts, err)
+		}
+	}
+}
+
+// parseWithOptions parses the input and returns the error of the parser.
+func parseWithOptions(input string, opts ParseOptions) error {
+	tokens := make(chan []Token, 1)
+	tokens <- tokenize(input)
+	close(tokens)
+	events, errc := TokenBatchesToEvents(context.Background(), tokens, opts)
+	for range events {
+	}
+	return <-errc
+}
+
+func TestTokensToEventsDefaultAliasLimit(t *testing.T) {
+	// each level doubles the events, to 2^40 in the last one
+	var bomb strings.Builder
+	bomb.WriteString("a0: &a0\n- x\n- x\n")
+	for i := 1; i <= 40; i++ {
+		fmt.Fprintf(&bomb, "a%d: &a%d\n- *a%d\n- *a%d\n", i, i, i-1, i-1)
+	}
+	err := parseWithOptions(bomb.String(), ParseOptions{})
+	if !errors.Is(err, ErrTooManyAliasExpansions) {
+		t.Errorf("expected %v, got %v", ErrTooManyAliasExpansions, err)
+	}
+}
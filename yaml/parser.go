@@ -1,14 +1,17 @@
 package yaml
 
 import (
+	"context"
+	"fmt"
+	"hash/maphash"
 	"hbibel/yaml-to-json/common"
-	"strings"
+	"hbibel/yaml-to-json/internal/pipeline"
 )
 
-// This parser is entirely hacked together and needs to be rewritten from
-// scratch in order to implement the YAML spec properly. In particular, I
-// completely ignored the "node style" stuff and implemented it only to get the
-// most basic use cases working.
+// The parser works line by line. It keeps a stack of the block collections
+// that are currently open, and compares the indentation of each line with the
+// positions of these blocks to find out where the line belongs. It still
+// ignores most of the "node style" stuff of the YAML spec, see block.go.
 
 type nestingType int
 
@@ -19,141 +22,596 @@ const (
 )
 
 type breadcrumb struct {
-	nt       nestingType
-	position uint32
+	nt nestingType
+	// position is the column of the dashes of a sequence or the keys of a
+	// mapping
+	position int
+	// the keys of a mapping
+	keys *keySet
+}
+
+// MultiDocumentMode determines what happens if a YAML stream contains more
+// than one document.
+type MultiDocumentMode int
+
+const (
+	// SingleDocument reports an error when a second document starts.
+	SingleDocument MultiDocumentMode = iota
+	// FirstDocument ignores all documents after the first one.
+	FirstDocument
+	// DocumentArray wraps all documents in an array, even if there is only
+	// one.
+	DocumentArray
+	// DocumentStream passes on the documents one after another as separate
+	// top-level values, for output that writes each of them on its own,
+	// like NDJSON.
+	DocumentStream
+)
+
+func (m MultiDocumentMode) String() string {
+	switch m {
+	case SingleDocument:
+		return "single"
+	case FirstDocument:
+		return "first"
+	case DocumentArray:
+		return "array"
+	case DocumentStream:
+		return "stream"
+	default:
+		return "unknown"
+	}
+}
+
+// ParseOptions configure TokensToEventsWithOptions. The zero value parses a
+// single document with the core schema.
+type ParseOptions struct {
+	Schema        Schema
+	MultiDocument MultiDocumentMode
+	// BatchSize is the maximum number of events that TokenBatchesToEvents
+	// sends at once. If it is zero, DefaultBatchSize is used.
+	BatchSize int
+	// FlushElements makes TokenBatchesToEvents send its events as soon as
+	// an element of a top-level sequence or a document is complete, instead
+	// of waiting for a full batch, so that NDJSON lines aren't delayed.
+	FlushElements bool
+	// DuplicateKeys determines how mappings with duplicate keys are
+	// handled.
+	DuplicateKeys DuplicateKeyPolicy
+	// MaxDepth, MaxScalarLength, MaxEvents and MaxAliasExpansions limit
+	// the resources that a YAML stream may use, which is important for
+	// untrusted input. A limit of zero means unlimited, except that
+	// MaxAliasExpansions defaults to DefaultMaxAliasExpansions, because a few
+	// nested aliases expand to an exponential number of events; a negative
+	// MaxAliasExpansions means unlimited. MaxDepth is the maximum number of
+	// nested block collections. MaxScalarLength is the maximum length of a
+	// scalar in bytes. MaxEvents is the maximum number of events of the
+	// whole stream, and MaxAliasExpansions the maximum number of events that
+	// are produced by expanding aliases. Exceeding a limit fails with
+	// ErrNestingTooDeep, ErrScalarTooLong, ErrTooManyEvents or
+	// ErrTooManyAliasExpansions respectively.
+	MaxDepth           int
+	MaxScalarLength    int
+	MaxEvents          int
+	MaxAliasExpansions int
+	// MaxBufferBytes limits the size of the mapping that
+	// DuplicateKeyLastWins holds back, estimated as the size of its JSON.
+	// Exceeding it fails with ErrBufferLimit. Zero means unlimited.
+	MaxBufferBytes int
+	// Detailed makes the parser describe the YAML source instead of the
+	// JSON data model: there are events for the stream and each document,
+	// scalar and collection events carry their style, tag and anchor, and
+	// aliases are reported as AliasEvents instead of being expanded.
+	// MultiDocument and MaxAliasExpansions are ignored.
+	Detailed bool
+	// Comments makes the parser report the comments and the empty lines of
+	// the source as COMMENT and BLANK_LINE events, for formatters. Without
+	// it, comments are dropped.
+	Comments bool
+	// Warn is called with a *SyntaxError for problems that the parser can
+	// work around, like an unsupported minor version in a %YAML directive.
+	// If it is nil, warnings are dropped.
+	Warn func(error)
+}
+
+func (o ParseOptions) batchSize() int {
+	if o.BatchSize <= 0 {
+		return DefaultBatchSize
+	}
+	return o.BatchSize
+}
+
+// DefaultMaxAliasExpansions is the limit on the events that are produced by
+// expanding aliases if ParseOptions.MaxAliasExpansions is zero.
+const DefaultMaxAliasExpansions = 1_000_000
+
+// maxAliasExpansions returns the limit on alias expansions, which is zero if
+// there is none.
+func (o ParseOptions) maxAliasExpansions() int {
+	switch {
+	case o.MaxAliasExpansions < 0:
+		return 0
+	case o.MaxAliasExpansions == 0:
+		return DefaultMaxAliasExpansions
+	}
+	return o.MaxAliasExpansions
 }
 
 func TokensToEvents(tokens <-chan Token) <-chan common.Event {
+	events, _ := TokensToEventsContext(context.Background(), tokens)
+	return events
+}
+
+// TokensToEventsContext is like TokensToEvents, but stops as soon as ctx is
+// cancelled or the tokens cannot be parsed. The events channel is closed in
+// any case. After an error, the remaining tokens are received and discarded
+// until their channel is closed, so that the stage before doesn't block even
+// if ctx isn't cancelled. The returned error channel yields at most one error
+// and is closed when the parser goroutine has exited.
+func TokensToEventsContext(ctx context.Context, tokens <-chan Token) (<-chan common.Event, <-chan error) {
+	return TokensToEventsWithOptions(ctx, tokens, ParseOptions{})
+}
+
+// TokensToEventsWithOptions is like TokensToEventsContext, but allows to
+// configure the parser.
+func TokensToEventsWithOptions(ctx context.Context, tokens <-chan Token, opts ParseOptions) (<-chan common.Event, <-chan error) {
 	events := make(chan common.Event)
+	errc := make(chan error, 1)
 
 	go func() {
-		// to keep track of the nesting level within the document
-		breadcrumbs := []breadcrumb{{IN_DOCUMENT, 0}}
-		lineTokens := make([]Token, 0, 5)
-		var lineEvents []common.Event
+		defer close(errc)
+		defer pipeline.Drain(ctx, tokens)
+		defer close(events)
+
+		p := newParser(opts)
+		emit := func() bool {
+			n := p.flushable()
+			for _, event := range p.events[:n] {
+				select {
+				case events <- event:
+				case <-ctx.Done():
+					return false
+				}
+			}
+			p.flush(n)
+			return true
+		}
 
-		for token := range tokens {
-			if token.Kind() != NEWLINE {
-				lineTokens = append(lineTokens, token)
-				continue
+		for {
+			var token Token
+			var ok bool
+			select {
+			case token, ok = <-tokens:
+			case <-ctx.Done():
+				errc <- ctx.Err()
+				return
+			}
+			if !ok {
+				break
 			}
 
-			lineEvents, breadcrumbs = toEvents(lineTokens, breadcrumbs)
-			for _, event := range lineEvents {
-				events <- event
+			if err := p.feed(token); err != nil {
+				errc <- err
+				return
 			}
+			if !emit() {
+				errc <- ctx.Err()
+				return
+			}
+		}
 
-			lineTokens = lineTokens[:0]
+		if err := p.finish(); err != nil {
+			errc <- err
+			return
 		}
-		lineEvents, breadcrumbs = toEvents(lineTokens, breadcrumbs)
-		for _, event := range lineEvents {
-			events <- event
+		if !emit() {
+			errc <- ctx.Err()
 		}
+	}()
+
+	return events, errc
+}
+
+// TokenBatchesToEvents is like TokensToEventsWithOptions, but receives and
+// sends slices of tokens and events. This reduces the synchronization overhead
+// of the channels considerably. The receiver owns the slices that are sent to
+// it.
+func TokenBatchesToEvents(ctx context.Context, tokens <-chan []Token, opts ParseOptions) (<-chan []common.Event, <-chan error) {
+	events := make(chan []common.Event)
+	errc := make(chan error, 1)
 
-		// close remaining breadcrumb elements
-		for _, breadcrumb := range breadcrumbs {
-			switch breadcrumb.nt {
-			case IN_ARRAY:
-				events <- common.NewEndArrayEvent()
-			case IN_MAPPING:
-				events <- common.NewEndMappingEvent()
+	go func() {
+		defer close(errc)
+		defer pipeline.Drain(ctx, tokens)
+		defer close(events)
+
+		batchSize := opts.batchSize()
+		p := newParser(opts)
+		p.events = make([]common.Event, 0, batchSize)
+		// send passes on the events in batches of at most batchSize events
+		send := func() bool {
+			ready := p.flushable()
+			if ready == 0 {
+				return true
+			}
+			held := p.events[ready:]
+			p.flushed += ready
+			for ready > 0 {
+				n := min(ready, batchSize)
+				select {
+				case events <- p.events[:n:n]:
+				case <-ctx.Done():
+					return false
+				}
+				p.events = p.events[n:]
+				ready -= n
+			}
+			p.events = append(make([]common.Event, 0, max(batchSize, len(held))), held...)
+			return true
+		}
+
+		for {
+			var batch []Token
+			var ok bool
+			select {
+			case batch, ok = <-tokens:
+			case <-ctx.Done():
+				errc <- ctx.Err()
+				return
+			}
+			if !ok {
+				break
+			}
+
+			for _, token := range batch {
+				if err := p.feed(token); err != nil {
+					errc <- err
+					return
+				}
+				if (len(p.events) >= batchSize || p.elementDone) && !send() {
+					errc <- ctx.Err()
+					return
+				}
+				p.elementDone = false
 			}
 		}
 
-		close(events)
+		if err := p.finish(); err != nil {
+			errc <- err
+			return
+		}
+		if len(p.events) > 0 && !send() {
+			errc <- ctx.Err()
+		}
 	}()
 
-	return events
+	return events, errc
 }
 
-func isNumeric(s string) bool {
-	hasDot := false
-	for _, r := range s {
-		if r == '.' {
-			if hasDot {
-				return false
-			}
-			hasDot = true
-		} else if r > '9' || r < '0' {
-			return false
-		}
-	}
-	return true
-}
-
-func toEvents(tokens []Token, breadcrumbs []breadcrumb) ([]common.Event, []breadcrumb) {
-	events := make([]common.Event, 0, 3)
-	var position uint32 = 0
-
-	for len(tokens) > 0 {
-		if tokens[0].Kind() == INDENT {
-			position = position + tokens[0].(*indentToken).spaceCount
-			tokens = tokens[1:]
-			continue
-		}
-
-		if len(tokens) == 1 {
-			wt := tokens[0].(*wordToken)
-			if wt.content == "true" {
-				events = append(events, common.NewBooleanEvent("true"))
-			} else if wt.content == "false" {
-				events = append(events, common.NewBooleanEvent("false"))
-			} else if wt.content == "null" {
-				events = append(events, common.NewNullEvent())
-			} else if isNumeric(wt.content) {
-				events = append(events, common.NewNumberEvent(wt.content))
-			} else {
-				events = append(events, common.NewStringEvent(wt.content))
-			}
-			break
-		}
-
-		if len(tokens) > 1 && tokens[0].Kind() == DASH && tokens[1].Kind() == SPACE {
-			notInArray := breadcrumbs[len(breadcrumbs)-1].nt != IN_ARRAY
-			lessIndented := breadcrumbs[len(breadcrumbs)-1].position != position
-			if notInArray || lessIndented {
-				events = append(events, common.NewStartArrayEvent())
-				breadcrumbs = append(breadcrumbs, breadcrumb{IN_ARRAY, position})
-			}
-			events = append(events, common.NewEmitElementEvent())
-			position = position + 2
-			tokens = tokens[2:]
-			continue
-		}
-
-		// Try if it's a mapping key
-		wb := strings.Builder{}
-		for i, t := range tokens {
-			if t.Kind() == COLON && (len(tokens) == i+1 || tokens[i+1].Kind() == SPACE) {
-				events = append(events, common.NewStartMappingEvent())
-				events = append(events, common.NewKeyEvent(wb.String()))
-				breadcrumbs = append(breadcrumbs, breadcrumb{IN_MAPPING, position})
-				position++
-				if len(tokens) == i+1 {
-					tokens = tokens[i+1:]
-				} else {
-					tokens = tokens[i+2:]
-				}
-				break
+// parser holds the state of a parse. Tokens are passed to feed, and the
+// resulting events are appended to events.
+type parser struct {
+	opts   ParseOptions
+	events []common.Event
+
+	// to keep track of the nesting level within the document
+	breadcrumbs []breadcrumb
+	lineTokens  []Token
+	// line is the number of the line in lineTokens, starting at 1
+	line int
+	// whether lineTokens is what follows the last line break of the input
+	atEnd bool
+	// whether the previous line ended with a "key:" or "-" whose value may
+	// follow on the next lines
+	pendingValue bool
+	// the column and the line of the key or dash whose value is pending
+	pendingColumn int
+	pendingLine   int
+	// scalar collects a scalar that may continue on the next lines
+	scalar *scalarBuilder
+
+	// the tag and the anchor of the next node, if it has them
+	pendingTag    string
+	pendingAnchor string
+	// the events of the anchored nodes of the current document
+	anchors map[string]*anchorNode
+	// the anchored nodes that are still open, innermost last
+	recording []*recorder
+	// expandAliases expands aliases even if events are detailed, for the
+	// Decoder, which needs the positions but not the aliases
+	expandAliases bool
+
+	// the number of events, and how many of them were produced by aliases
+	eventCount  int
+	aliasEvents int
+
+	// hashes the keys of the mappings
+	seed maphash.Seed
+	// the number of events that have been passed on
+	flushed int
+	// the offset of the first event that is held back, or -1
+	holdFrom int
+	// the estimated size of the events that are held back, see eventSize
+	heldBytes int
+	// whether events have been removed from events
+	removed bool
+	// the number of breadcrumbs while the entry of a duplicate key is
+	// skipped, or 0
+	skipDepth int
+
+	// the directives of the next or current document
+	version       string
+	tagHandles    map[string]string
+	hasDirectives bool
+	// the schema of the current document
+	schema Schema
+
+	streamStarted bool
+	documentCount int
+	inDocument    bool
+	// documents after the first one are swallowed in FirstDocument mode
+	discard bool
+
+	// the nesting of the events that were passed on, and whether they
+	// complete an element, for FlushElements
+	streamDepth int
+	elementDone bool
+}
+
+func newParser(opts ParseOptions) *parser {
+	return &parser{
+		opts:        opts,
+		breadcrumbs: []breadcrumb{{nt: IN_DOCUMENT, position: -1}},
+		lineTokens:  make([]Token, 0, 5),
+		line:        1,
+		seed:        maphash.MakeSeed(),
+		holdFrom:    -1,
+	}
+}
+
+func (p *parser) feed(token Token) error {
+	if token.Kind() != NEWLINE {
+		p.lineTokens = append(p.lineTokens, token)
+		return nil
+	}
+
+	err := p.handleLine()
+	if err == nil {
+		err = p.checkEventCount()
+	}
+	if err == nil {
+		err = p.checkHeldBytes()
+	}
+	p.lineTokens = p.lineTokens[:0]
+	p.line++
+	return err
+}
+
+// finish handles the last line if it wasn't terminated and closes everything
+// that is still open.
+func (p *parser) finish() error {
+	p.atEnd = true
+	if err := p.handleLine(); err != nil {
+		return err
+	}
+
+	if p.inDocument {
+		if err := p.endDocument(false); err != nil {
+			return err
+		}
+	}
+	if p.hasDirectives {
+		return p.syntaxError(0, "the directives are not followed by a document")
+	}
+	if p.opts.Detailed {
+		p.emit(common.NewStreamEndEvent())
+	} else if p.opts.MultiDocument == DocumentArray {
+		if p.documentCount == 0 {
+			p.emit(common.NewStartArrayEvent())
+		}
+		p.discard = false
+		p.emit(common.NewEndArrayEvent())
+	}
+	if err := p.checkEventCount(); err != nil {
+		return err
+	}
+	return p.checkHeldBytes()
+}
+
+func (p *parser) emit(events ...common.Event) {
+	if len(p.recording) > 0 {
+		p.record(events)
+	}
+	p.pass(events)
+}
+
+// pass counts events and appends them to those that are sent on, unless they
+// are dropped. Unlike emit, it doesn't record them for anchors.
+func (p *parser) pass(events []common.Event) {
+	p.eventCount += len(events)
+	if !p.discard && p.skipDepth == 0 {
+		p.events = append(p.events, events...)
+		if p.holdFrom >= 0 {
+			for _, event := range events {
+				p.heldBytes += eventSize(event)
 			}
+		}
+		if p.opts.FlushElements {
+			p.trackElements(events)
+		}
+	}
+}
 
-			position = position + uint32(len(t.String()))
-			wb.WriteString(t.String())
+// trackElements sets elementDone if the events complete an element of a
+// top-level sequence or a document, for FlushElements.
+func (p *parser) trackElements(events []common.Event) {
+	for _, event := range events {
+		switch event.GetKind() {
+		case common.START_MAPPING, common.START_ARRAY:
+			p.streamDepth++
+		case common.END_MAPPING, common.END_ARRAY:
+			p.streamDepth--
+			p.elementDone = p.elementDone || p.streamDepth <= 1
+		case common.EMIT_ELEMENT:
+			// the previous element is complete
+			p.elementDone = p.elementDone || p.streamDepth <= 1
+		case common.EMIT_VALUE:
+			p.elementDone = p.elementDone || p.streamDepth == 0
 		}
+	}
+}
 
-		if len(tokens) == 0 {
-			break
+// startDocument begins a document, which is explicit if it starts with "---".
+func (p *parser) startDocument(explicit bool) error {
+	p.documentCount++
+	p.inDocument = true
+	p.schema = p.documentSchema()
+	// the document consists of a single node, which may start at any column
+	p.pendingValue = true
+	p.pendingColumn = -1
+	if p.opts.Detailed {
+		p.emit(common.NewDocumentStartEvent(explicit))
+		return nil
+	}
+	if p.opts.MultiDocument == DocumentArray {
+		if p.documentCount == 1 {
+			p.emit(common.NewStartArrayEvent())
+		}
+		p.emit(common.NewEmitElementEvent())
+	}
+	if p.documentCount > 1 {
+		switch p.opts.MultiDocument {
+		case SingleDocument:
+			return fmt.Errorf("the input contains more than one document")
+		case FirstDocument:
+			p.discard = true
 		}
-		wb.Reset()
+	}
+	return nil
+}
+
+// endDocument ends a document, which is explicit if it ends with "...".
+func (p *parser) endDocument(explicit bool) error {
+	if err := p.finishScalar(); err != nil {
+		return err
+	}
+	// an empty document, or a "key:" or "-" at its end
+	if err := p.finishPendingValue(); err != nil {
+		return err
+	}
+	p.closeBlocks(-1)
+	if p.opts.Detailed {
+		p.emit(common.NewDocumentEndEvent(explicit))
+	}
+	p.inDocument = false
+	p.resetDirectives()
+	p.anchors = nil
+	return nil
+}
 
-		// it's not an array, map, etc, so it's a word
-		for _, t := range tokens {
-			position = position + uint32(len(t.String()))
-			wb.WriteString(t.String())
+func (p *parser) handleLine() error {
+	if p.opts.Detailed && !p.streamStarted {
+		p.emit(common.NewStreamStartEvent())
+		p.streamStarted = true
+	}
+	tokens, comment := splitComment(p.lineTokens, p.openQuote())
+	// whether the comment follows content on the same line
+	inline := !isBlank(tokens)
+	if p.scalar != nil {
+		if comment != nil && !inline && p.openQuote() == NEWLINE {
+			// a comment line ends a plain scalar
+			if err := p.finishScalar(); err != nil {
+				return err
+			}
+		} else {
+			done, err := p.continueScalar(tokens)
+			if err != nil {
+				return err
+			}
+			if done {
+				return p.endLine(comment, inline)
+			}
+		}
+	}
+
+	if isDirective(tokens) {
+		if p.inDocument {
+			return p.syntaxError(0, "directives must be separated from the previous document by \"...\"")
+		}
+		p.hasDirectives = true
+		if err := p.parseDirective(tokens); err != nil {
+			return err
+		}
+		return p.endLine(comment, false)
+	}
+
+	content := tokens
+	column := 0
+	switch documentMarker(tokens) {
+	case documentStart:
+		if p.inDocument {
+			if err := p.endDocument(false); err != nil {
+				return err
+			}
+		}
+		if err := p.startDocument(true); err != nil {
+			return err
+		}
+		content = content[3:]
+		column = 3
+		if len(content) > 0 {
+			column += tokenWidth(content[0])
+			content = content[1:]
+		}
+	case documentEnd:
+		if p.inDocument {
+			if err := p.endDocument(true); err != nil {
+				return err
+			}
 		}
-		events = append(events, common.NewStringEvent(wb.String()))
-		break
+		content = nil
 	}
 
-	return events, breadcrumbs
+	if isBlank(content) {
+		// after the last line break there is no line
+		if !inline && comment == nil && !p.atEnd {
+			p.emitBlankLines(1)
+		}
+		return p.endLine(comment, inline)
+	}
+	if !p.inDocument {
+		if p.hasDirectives {
+			return p.syntaxError(column, "a document with directives must start with \"---\"")
+		}
+		if err := p.startDocument(false); err != nil {
+			return err
+		}
+	}
+	if err := p.parseLine(content, column); err != nil {
+		return err
+	}
+	return p.endLine(comment, inline)
+}
+
+type marker int
+
+const (
+	noMarker marker = iota
+	documentStart
+	documentEnd
+)
+
+// documentMarker checks if a line starts with "---" or consists of "...".
+func documentMarker(tokens []Token) marker {
+	if len(tokens) >= 3 && tokens[0] == dashToken && tokens[1] == dashToken && tokens[2] == dashToken {
+		if len(tokens) == 3 || tokens[3].Kind() == SPACE {
+			return documentStart
+		}
+	}
+	if len(tokens) >= 1 && tokens[0].Kind() == WORD && tokens[0].String() == "..." {
+		if len(tokens) == 1 || (len(tokens) == 2 && tokens[1].Kind() == SPACE) {
+			return documentEnd
+		}
+	}
+	return noMarker
 }
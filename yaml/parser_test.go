@@ -1,15 +1,18 @@
 package yaml
 
 import (
+	"context"
 	"hbibel/yaml-to-json/common"
+	"hbibel/yaml-to-json/internal/leaktest"
 	"reflect"
+	"strings"
 	"testing"
+	"time"
 )
 
 // TODO error cases
 
 // TODO cases to test
-//   List of lists
 //   "a number 42 within a string"
 //   "42 starts a string"
 //   "a normal string - but with a dash"
@@ -141,25 +144,757 @@ func TestTokensToEventsSimpleMap(t *testing.T) {
 	runTest(t, tokens, expectedEvents)
 }
 
+func TestTokensToEventsValueAfterKeyIsResolved(t *testing.T) {
+	tokens := []Token{
+		&wordToken{"foo"},
+		colonToken,
+		&spaceToken{" "},
+		&wordToken{"42"},
+	}
+	expectedEvents := []common.Event{
+		common.NewStartMappingEvent(),
+		common.NewKeyEvent("foo"),
+		common.NewNumberEvent("42"),
+		common.NewEndMappingEvent(),
+	}
+	runTest(t, tokens, expectedEvents)
+}
+
+func TestTokensToEventsExplicitDocumentStart(t *testing.T) {
+	tokens := []Token{
+		dashToken, dashToken, dashToken,
+		newlineToken,
+		&wordToken{"foo"},
+	}
+	expectedEvents := []common.Event{
+		common.NewStringEvent("foo"),
+	}
+	runTest(t, tokens, expectedEvents)
+}
+
+func TestTokensToEventsDocumentArray(t *testing.T) {
+	tokens := []Token{
+		&wordToken{"foo"},
+		newlineToken,
+		dashToken, dashToken, dashToken,
+		newlineToken,
+		dashToken, dashToken, dashToken, &spaceToken{" "}, &wordToken{"bar"},
+		newlineToken,
+		&wordToken{"..."},
+	}
+	expectedEvents := []common.Event{
+		common.NewStartArrayEvent(),
+		common.NewEmitElementEvent(),
+		common.NewStringEvent("foo"),
+		common.NewEmitElementEvent(),
+		common.NewNullEvent(),
+		common.NewEmitElementEvent(),
+		common.NewStringEvent("bar"),
+		common.NewEndArrayEvent(),
+	}
+	runTestWithOptions(t, tokens, expectedEvents, ParseOptions{MultiDocument: DocumentArray})
+}
+
+func TestTokensToEventsDocumentStream(t *testing.T) {
+	input := "foo\n---\n- bar\n"
+	expectedEvents := []common.Event{
+		common.NewStringEvent("foo"),
+		common.NewStartArrayEvent(),
+		common.NewEmitElementEvent(),
+		common.NewStringEvent("bar"),
+		common.NewEndArrayEvent(),
+	}
+	runTestWithOptions(t, tokenize(input), expectedEvents, ParseOptions{MultiDocument: DocumentStream})
+}
+
+func TestTokensToEventsEmptyDocumentArray(t *testing.T) {
+	tokens := []Token{}
+	expectedEvents := []common.Event{
+		common.NewStartArrayEvent(),
+		common.NewEndArrayEvent(),
+	}
+	runTestWithOptions(t, tokens, expectedEvents, ParseOptions{MultiDocument: DocumentArray})
+}
+
+func TestTokensToEventsFirstDocument(t *testing.T) {
+	tokens := []Token{
+		&wordToken{"foo"},
+		colonToken,
+		&spaceToken{" "},
+		&wordToken{"bar"},
+		newlineToken,
+		dashToken, dashToken, dashToken,
+		newlineToken,
+		&wordToken{"baz"},
+	}
+	expectedEvents := []common.Event{
+		common.NewStartMappingEvent(),
+		common.NewKeyEvent("foo"),
+		common.NewStringEvent("bar"),
+		common.NewEndMappingEvent(),
+	}
+	runTestWithOptions(t, tokens, expectedEvents, ParseOptions{MultiDocument: FirstDocument})
+}
+
+func TestTokensToEventsSingleDocumentError(t *testing.T) {
+	defer leaktest.Check(t)()
+
+	tokens := make(chan Token, 6)
+	for _, token := range []Token{&wordToken{"foo"}, newlineToken, dashToken, dashToken, dashToken} {
+		tokens <- token
+	}
+	close(tokens)
+
+	events, errc := TokensToEventsContext(context.Background(), tokens)
+	for range events {
+	}
+	if err := <-errc; err == nil {
+		t.Error("Expected an error")
+	}
+}
+
+func TestTokensToEventsErrorStopsPipeline(t *testing.T) {
+	defer leaktest.Check(t)()
+
+	// the tokenizer is still sending when the parser fails on the first line
+	input := "\ta: 1\n" + strings.Repeat("b: 2\n", 1000)
+	tokens := make(chan Token)
+	tokenizeErrc := TokenizeReader(context.Background(), strings.NewReader(input), tokens)
+	events, errc := TokensToEventsContext(context.Background(), tokens)
+	for range events {
+	}
+	if err := <-errc; err == nil {
+		t.Error("Expected an error")
+	}
+	select {
+	case err := <-tokenizeErrc:
+		if err != nil {
+			t.Error("Unexpected tokenizer error:", err)
+		}
+	case <-time.After(time.Second):
+		t.Error("The tokenizer is still blocked")
+	}
+}
+
+func TestTokenBatchesToEvents(t *testing.T) {
+	tokens := []Token{
+		dashToken, &spaceToken{" "}, &wordToken{"foo"}, newlineToken,
+		dashToken, &spaceToken{" "}, &wordToken{"bar"}, newlineToken,
+	}
+	expectedEvents := []common.Event{
+		common.NewStartArrayEvent(),
+		common.NewEmitElementEvent(),
+		common.NewStringEvent("foo"),
+		common.NewEmitElementEvent(),
+		common.NewStringEvent("bar"),
+		common.NewEndArrayEvent(),
+	}
+
+	for _, batchSize := range []int{1, 4, 100} {
+		tokenBatches := make(chan []Token, 2)
+		tokenBatches <- tokens[:3]
+		tokenBatches <- tokens[3:]
+		close(tokenBatches)
+
+		eventBatches, errc := TokenBatchesToEvents(context.Background(), tokenBatches, ParseOptions{BatchSize: batchSize})
+		events := []common.Event{}
+		for batch := range eventBatches {
+			if len(batch) > batchSize {
+				t.Errorf("Batch of %d events exceeds batch size %d", len(batch), batchSize)
+			}
+			events = append(events, batch...)
+		}
+		if err := <-errc; err != nil {
+			t.Fatal("Unexpected error:", err)
+		}
+		if !reflect.DeepEqual(events, expectedEvents) {
+			t.Error("Expected", expectedEvents, "got", events)
+		}
+	}
+}
+
+func TestTokensToEventsSiblingKeys(t *testing.T) {
+	input := "foo: 1\nbar:\n  baz: 2\nqux: 3\n"
+	expectedEvents := []common.Event{
+		common.NewStartMappingEvent(),
+		common.NewKeyEvent("foo"),
+		common.NewNumberEvent("1"),
+		common.NewKeyEvent("bar"),
+		common.NewStartMappingEvent(),
+		common.NewKeyEvent("baz"),
+		common.NewNumberEvent("2"),
+		common.NewEndMappingEvent(),
+		common.NewKeyEvent("qux"),
+		common.NewNumberEvent("3"),
+		common.NewEndMappingEvent(),
+	}
+	runTest(t, tokenize(input), expectedEvents)
+}
+
+func TestTokensToEventsSequenceOfMappings(t *testing.T) {
+	input := "data:\n  - name: John\n    age: 30\n  - name: Jane\n"
+	expectedEvents := []common.Event{
+		common.NewStartMappingEvent(),
+		common.NewKeyEvent("data"),
+		common.NewStartArrayEvent(),
+		common.NewEmitElementEvent(),
+		common.NewStartMappingEvent(),
+		common.NewKeyEvent("name"),
+		common.NewStringEvent("John"),
+		common.NewKeyEvent("age"),
+		common.NewNumberEvent("30"),
+		common.NewEndMappingEvent(),
+		common.NewEmitElementEvent(),
+		common.NewStartMappingEvent(),
+		common.NewKeyEvent("name"),
+		common.NewStringEvent("Jane"),
+		common.NewEndMappingEvent(),
+		common.NewEndArrayEvent(),
+		common.NewEndMappingEvent(),
+	}
+	runTest(t, tokenize(input), expectedEvents)
+}
+
+func TestTokensToEventsIndentedRoot(t *testing.T) {
+	input := "  foo: 1\n  bar: 2\n"
+	expectedEvents := []common.Event{
+		common.NewStartMappingEvent(),
+		common.NewKeyEvent("foo"),
+		common.NewNumberEvent("1"),
+		common.NewKeyEvent("bar"),
+		common.NewNumberEvent("2"),
+		common.NewEndMappingEvent(),
+	}
+	runTest(t, tokenize(input), expectedEvents)
+}
+
+func TestTokensToEventsTabIndentation(t *testing.T) {
+	runErrorTest(t, "foo:\n\tbar: 1\n", 2, 1)
+	runErrorTest(t, "foo:\n  \tbar: 1\n", 2, 3)
+}
+
+func TestTokensToEventsTabAfterIndicators(t *testing.T) {
+	input := "-\tfoo:\tbar\n"
+	expectedEvents := []common.Event{
+		common.NewStartArrayEvent(),
+		common.NewEmitElementEvent(),
+		common.NewStartMappingEvent(),
+		common.NewKeyEvent("foo"),
+		common.NewStringEvent("bar"),
+		common.NewEndMappingEvent(),
+		common.NewEndArrayEvent(),
+	}
+	runTest(t, tokenize(input), expectedEvents)
+}
+
+func TestTokensToEventsUnsupportedIndicators(t *testing.T) {
+	// flow collections, block scalars and complex keys must not be read as
+	// strings
+	runErrorTest(t, "a: [1, 2]\n", 1, 4)
+	runErrorTest(t, "a: {b: 1}\n", 1, 4)
+	runErrorTest(t, "- [a]\n", 1, 3)
+	runErrorTest(t, "{a: 1}\n", 1, 1)
+	runErrorTest(t, "[a]: 1\n", 1, 1)
+	runErrorTest(t, "a: |\n  line\n", 1, 4)
+	runErrorTest(t, "a: >-\n  line\n", 1, 4)
+	runErrorTest(t, "? a\n", 1, 1)
+	runErrorTest(t, "a: ,b\n", 1, 4)
+	runErrorTest(t, "a: @b\n", 1, 4)
+	runErrorTest(t, "a: `b\n", 1, 4)
+}
+
+func TestTokensToEventsInconsistentDedent(t *testing.T) {
+	runErrorTest(t, "foo:\n    bar: 1\n  baz: 2\n", 3, 3)
+	runErrorTest(t, "- - foo\n - bar\n", 2, 2)
+}
+
+func TestTokensToEventsUnexpectedIndentation(t *testing.T) {
+	runErrorTest(t, "foo: 1\n  bar: 2\n", 2, 3)
+	runErrorTest(t, "- 'foo'\n  - bar\n", 2, 3)
+}
+
+func TestTokensToEventsMixedBlockTypes(t *testing.T) {
+	runErrorTest(t, "foo: 1\n- bar\n", 2, 1)
+	runErrorTest(t, "- foo\nbar: 1\n", 2, 1)
+	runErrorTest(t, "foo: 1\nbar\n", 2, 1)
+}
+
+func TestTokensToEventsMultiLinePlainScalar(t *testing.T) {
+	input := "description: a long\n  text that\n\n  continues\n\n\n  here\nnext: 1\n"
+	expectedEvents := []common.Event{
+		common.NewStartMappingEvent(),
+		common.NewKeyEvent("description"),
+		common.NewStringEvent("a long text that\ncontinues\n\nhere"),
+		common.NewKeyEvent("next"),
+		common.NewNumberEvent("1"),
+		common.NewEndMappingEvent(),
+	}
+	runTest(t, tokenize(input), expectedEvents)
+}
+
+func TestTokensToEventsMultiLinePlainScalarOnNextLine(t *testing.T) {
+	input := "- \n  first\n  second\n- third\n   fourth\n"
+	expectedEvents := []common.Event{
+		common.NewStartArrayEvent(),
+		common.NewEmitElementEvent(),
+		common.NewStringEvent("first second"),
+		common.NewEmitElementEvent(),
+		common.NewStringEvent("third fourth"),
+		common.NewEndArrayEvent(),
+	}
+	runTest(t, tokenize(input), expectedEvents)
+}
+
+func TestTokensToEventsMultiLineRootScalar(t *testing.T) {
+	input := "foo\nbar\n\n"
+	expectedEvents := []common.Event{
+		common.NewStringEvent("foo bar"),
+	}
+	runTest(t, tokenize(input), expectedEvents)
+}
+
+func TestTokensToEventsMultiLinePlainScalarWithMappingValue(t *testing.T) {
+	runErrorTest(t, "foo: bar\n  baz: 1\n", 2, 3)
+}
+
+func TestTokensToEventsSingleQuotedScalar(t *testing.T) {
+	input := "- 'it''s: \"quoted\" # '\n- ' multi\n\n   line '\n"
+	expectedEvents := []common.Event{
+		common.NewStartArrayEvent(),
+		common.NewEmitElementEvent(),
+		common.NewStringEvent("it's: \"quoted\" # "),
+		common.NewEmitElementEvent(),
+		common.NewStringEvent(" multi\nline "),
+		common.NewEndArrayEvent(),
+	}
+	runTest(t, tokenize(input), expectedEvents)
+}
+
+func TestTokensToEventsDoubleQuotedScalar(t *testing.T) {
+	input := "- \"tab\\t \\\"quote\\\" \\u00e4\\x41\\\\\"\n- \"folded\n  line\\\n  s\"\n- \"42\"\n"
+	expectedEvents := []common.Event{
+		common.NewStartArrayEvent(),
+		common.NewEmitElementEvent(),
+		common.NewStringEvent("tab\t \"quote\" äA\\"),
+		common.NewEmitElementEvent(),
+		common.NewStringEvent("folded lines"),
+		common.NewEmitElementEvent(),
+		common.NewStringEvent("42"),
+		common.NewEndArrayEvent(),
+	}
+	runTest(t, tokenize(input), expectedEvents)
+}
+
+func TestTokensToEventsQuotedKeys(t *testing.T) {
+	input := "'a: b': 1\n\"c\\nd\" : 2\n"
+	expectedEvents := []common.Event{
+		common.NewStartMappingEvent(),
+		common.NewKeyEvent("a: b"),
+		common.NewNumberEvent("1"),
+		common.NewKeyEvent("c\nd"),
+		common.NewNumberEvent("2"),
+		common.NewEndMappingEvent(),
+	}
+	runTest(t, tokenize(input), expectedEvents)
+}
+
+func TestTokensToEventsQuotedScalarErrors(t *testing.T) {
+	runErrorTest(t, "foo: 'bar\nbaz\n", 1, 6)
+	runErrorTest(t, "foo: 'bar' baz\n", 1, 6)
+	runErrorTest(t, "foo: \"\\q\"\n", 1, 6)
+}
+
+func TestTokensToEventsEmptyMappingValues(t *testing.T) {
+	input := "a:\nb: 1\nc:\n  d:\ne: \n"
+	expectedEvents := []common.Event{
+		common.NewStartMappingEvent(),
+		common.NewKeyEvent("a"),
+		common.NewNullEvent(),
+		common.NewKeyEvent("b"),
+		common.NewNumberEvent("1"),
+		common.NewKeyEvent("c"),
+		common.NewStartMappingEvent(),
+		common.NewKeyEvent("d"),
+		common.NewNullEvent(),
+		common.NewEndMappingEvent(),
+		common.NewKeyEvent("e"),
+		common.NewNullEvent(),
+		common.NewEndMappingEvent(),
+	}
+	runTest(t, tokenize(input), expectedEvents)
+}
+
+func TestTokensToEventsEmptyFlowCollections(t *testing.T) {
+	input := "a: []\nb: { }\nc:\n  - []\n"
+	expectedEvents := []common.Event{
+		common.NewStartMappingEvent(),
+		common.NewKeyEvent("a"),
+		common.NewStartArrayEvent(),
+		common.NewEndArrayEvent(),
+		common.NewKeyEvent("b"),
+		common.NewStartMappingEvent(),
+		common.NewEndMappingEvent(),
+		common.NewKeyEvent("c"),
+		common.NewStartArrayEvent(),
+		common.NewEmitElementEvent(),
+		common.NewStartArrayEvent(),
+		common.NewEndArrayEvent(),
+		common.NewEndArrayEvent(),
+		common.NewEndMappingEvent(),
+	}
+	runTest(t, tokenize(input), expectedEvents)
+}
+
+func TestTokensToEventsEmptySequenceEntries(t *testing.T) {
+	input := "- a\n-\n- \n- - \n- key:\n-"
+	expectedEvents := []common.Event{
+		common.NewStartArrayEvent(),
+		common.NewEmitElementEvent(),
+		common.NewStringEvent("a"),
+		common.NewEmitElementEvent(),
+		common.NewNullEvent(),
+		common.NewEmitElementEvent(),
+		common.NewNullEvent(),
+		common.NewEmitElementEvent(),
+		common.NewStartArrayEvent(),
+		common.NewEmitElementEvent(),
+		common.NewNullEvent(),
+		common.NewEndArrayEvent(),
+		common.NewEmitElementEvent(),
+		common.NewStartMappingEvent(),
+		common.NewKeyEvent("key"),
+		common.NewNullEvent(),
+		common.NewEndMappingEvent(),
+		common.NewEmitElementEvent(),
+		common.NewNullEvent(),
+		common.NewEndArrayEvent(),
+	}
+	runTest(t, tokenize(input), expectedEvents)
+}
+
+func TestTokensToEventsExplicitNulls(t *testing.T) {
+	input := "a: ~\nb: null\nc: NULL\nd: ''\n"
+	expectedEvents := []common.Event{
+		common.NewStartMappingEvent(),
+		common.NewKeyEvent("a"),
+		common.NewNullEvent(),
+		common.NewKeyEvent("b"),
+		common.NewNullEvent(),
+		common.NewKeyEvent("c"),
+		common.NewNullEvent(),
+		common.NewKeyEvent("d"),
+		common.NewStringEvent(""),
+		common.NewEndMappingEvent(),
+	}
+	runTest(t, tokenize(input), expectedEvents)
+}
+
+func TestTokensToEventsEmptyDocuments(t *testing.T) {
+	input := "---\n\n---\n...\n--- ~\n"
+	expectedEvents := []common.Event{
+		common.NewStartArrayEvent(),
+		common.NewEmitElementEvent(),
+		common.NewNullEvent(),
+		common.NewEmitElementEvent(),
+		common.NewNullEvent(),
+		common.NewEmitElementEvent(),
+		common.NewNullEvent(),
+		common.NewEndArrayEvent(),
+	}
+	runTestWithOptions(t, tokenize(input), expectedEvents, ParseOptions{MultiDocument: DocumentArray})
+}
+
+func TestTokensToEventsBlankInput(t *testing.T) {
+	runTest(t, tokenize("\n  \n\n"), []common.Event{})
+}
+
+func TestTokensToEventsCompactNestedSequences(t *testing.T) {
+	input := "- - - a\n    - b\n  - c\n- d\n"
+	expectedEvents := []common.Event{
+		common.NewStartArrayEvent(),
+		common.NewEmitElementEvent(),
+		common.NewStartArrayEvent(),
+		common.NewEmitElementEvent(),
+		common.NewStartArrayEvent(),
+		common.NewEmitElementEvent(),
+		common.NewStringEvent("a"),
+		common.NewEmitElementEvent(),
+		common.NewStringEvent("b"),
+		common.NewEndArrayEvent(),
+		common.NewEmitElementEvent(),
+		common.NewStringEvent("c"),
+		common.NewEndArrayEvent(),
+		common.NewEmitElementEvent(),
+		common.NewStringEvent("d"),
+		common.NewEndArrayEvent(),
+	}
+	runTest(t, tokenize(input), expectedEvents)
+}
+
+func TestTokensToEventsCompactMappingsInSequence(t *testing.T) {
+	input := "- name: x\n  age: 3\n-   name: y\n    tags:\n    - a\n- - k: v\n    l: w\n"
+	expectedEvents := []common.Event{
+		common.NewStartArrayEvent(),
+		common.NewEmitElementEvent(),
+		common.NewStartMappingEvent(),
+		common.NewKeyEvent("name"),
+		common.NewStringEvent("x"),
+		common.NewKeyEvent("age"),
+		common.NewNumberEvent("3"),
+		common.NewEndMappingEvent(),
+		common.NewEmitElementEvent(),
+		common.NewStartMappingEvent(),
+		common.NewKeyEvent("name"),
+		common.NewStringEvent("y"),
+		common.NewKeyEvent("tags"),
+		common.NewStartArrayEvent(),
+		common.NewEmitElementEvent(),
+		common.NewStringEvent("a"),
+		common.NewEndArrayEvent(),
+		common.NewEndMappingEvent(),
+		common.NewEmitElementEvent(),
+		common.NewStartArrayEvent(),
+		common.NewEmitElementEvent(),
+		common.NewStartMappingEvent(),
+		common.NewKeyEvent("k"),
+		common.NewStringEvent("v"),
+		common.NewKeyEvent("l"),
+		common.NewStringEvent("w"),
+		common.NewEndMappingEvent(),
+		common.NewEndArrayEvent(),
+		common.NewEndArrayEvent(),
+	}
+	runTest(t, tokenize(input), expectedEvents)
+}
+
+func TestTokensToEventsIndentlessSequence(t *testing.T) {
+	input := "a:\n- x\n- y\nb:\n  c:\n  - z\n  d:\n  -\ne: 1\n"
+	expectedEvents := []common.Event{
+		common.NewStartMappingEvent(),
+		common.NewKeyEvent("a"),
+		common.NewStartArrayEvent(),
+		common.NewEmitElementEvent(),
+		common.NewStringEvent("x"),
+		common.NewEmitElementEvent(),
+		common.NewStringEvent("y"),
+		common.NewEndArrayEvent(),
+		common.NewKeyEvent("b"),
+		common.NewStartMappingEvent(),
+		common.NewKeyEvent("c"),
+		common.NewStartArrayEvent(),
+		common.NewEmitElementEvent(),
+		common.NewStringEvent("z"),
+		common.NewEndArrayEvent(),
+		common.NewKeyEvent("d"),
+		common.NewStartArrayEvent(),
+		common.NewEmitElementEvent(),
+		common.NewNullEvent(),
+		common.NewEndArrayEvent(),
+		common.NewEndMappingEvent(),
+		common.NewKeyEvent("e"),
+		common.NewNumberEvent("1"),
+		common.NewEndMappingEvent(),
+	}
+	runTest(t, tokenize(input), expectedEvents)
+}
+
+func TestTokensToEventsIndentlessSequenceInSequenceEntry(t *testing.T) {
+	input := "- key:\n  - a\n  other: b\n"
+	expectedEvents := []common.Event{
+		common.NewStartArrayEvent(),
+		common.NewEmitElementEvent(),
+		common.NewStartMappingEvent(),
+		common.NewKeyEvent("key"),
+		common.NewStartArrayEvent(),
+		common.NewEmitElementEvent(),
+		common.NewStringEvent("a"),
+		common.NewEndArrayEvent(),
+		common.NewKeyEvent("other"),
+		common.NewStringEvent("b"),
+		common.NewEndMappingEvent(),
+		common.NewEndArrayEvent(),
+	}
+	runTest(t, tokenize(input), expectedEvents)
+}
+
+func TestTokensToEventsSequenceEntryAfterMappingValue(t *testing.T) {
+	// only the value of a key that has no value yet may be an indentless
+	// sequence
+	runErrorTest(t, "a: 1\n- x\n", 2, 1)
+}
+
+func TestTokensToEventsDetailed(t *testing.T) {
+	input := "%TAG !e! tag:example.com,2000:\n--- !e!root\n\"k\": &a 'v'\nl: &s !!seq\n- *a\n&k m: !!int 1\n*k : x\n...\n--- 2\n"
+	expectedEvents := []common.Event{
+		common.NewStreamStartEvent(),
+		common.NewDocumentStartEvent(true),
+		&common.CollectionEvent{Kind: common.START_MAPPING, Tag: "tag:example.com,2000:root", Position: common.Position{Line: 3, Column: 1}},
+		&common.EventWithPayload{Kind: common.EMIT_KEY, PayloadType: common.STRING, Payload: "k", Source: "k", Style: common.DOUBLE_QUOTED, Position: common.Position{Line: 3, Column: 1}},
+		&common.EventWithPayload{Kind: common.EMIT_VALUE, PayloadType: common.STRING, Payload: "v", Source: "v", Style: common.SINGLE_QUOTED, Anchor: "a", Position: common.Position{Line: 3, Column: 9}},
+		&common.EventWithPayload{Kind: common.EMIT_KEY, PayloadType: common.STRING, Payload: "l", Source: "l", Position: common.Position{Line: 4, Column: 1}},
+		&common.CollectionEvent{Kind: common.START_ARRAY, Tag: "tag:yaml.org,2002:seq", Anchor: "s", Position: common.Position{Line: 5, Column: 1}},
+		common.NewEmitElementEvent(),
+		&common.AliasEvent{Anchor: "a", Position: common.Position{Line: 5, Column: 3}},
+		common.NewEndArrayEvent(),
+		&common.EventWithPayload{Kind: common.EMIT_KEY, PayloadType: common.STRING, Payload: "m", Source: "m", Anchor: "k", Position: common.Position{Line: 6, Column: 4}},
+		&common.EventWithPayload{Kind: common.EMIT_VALUE, PayloadType: common.NUMBER, Payload: "1", Source: "1", Tag: "tag:yaml.org,2002:int", Position: common.Position{Line: 6, Column: 10}},
+		&common.AliasEvent{Anchor: "k", Position: common.Position{Line: 7, Column: 1}},
+		&common.EventWithPayload{Kind: common.EMIT_VALUE, PayloadType: common.STRING, Payload: "x", Source: "x", Position: common.Position{Line: 7, Column: 6}},
+		common.NewEndMappingEvent(),
+		common.NewDocumentEndEvent(true),
+		common.NewDocumentStartEvent(true),
+		&common.EventWithPayload{Kind: common.EMIT_VALUE, PayloadType: common.NUMBER, Payload: "2", Source: "2", Position: common.Position{Line: 9, Column: 5}},
+		common.NewDocumentEndEvent(false),
+		common.NewStreamEndEvent(),
+	}
+	runTestWithOptions(t, tokenize(input), expectedEvents, ParseOptions{Detailed: true})
+}
+
+func TestTokensToEventsDetailedEmptyStream(t *testing.T) {
+	expectedEvents := []common.Event{
+		common.NewStreamStartEvent(),
+		common.NewStreamEndEvent(),
+	}
+	runTestWithOptions(t, tokenize(""), expectedEvents, ParseOptions{Detailed: true})
+}
+
+func TestTokensToEventsDetailedImplicitDocument(t *testing.T) {
+	expectedEvents := []common.Event{
+		common.NewStreamStartEvent(),
+		common.NewDocumentStartEvent(false),
+		&common.EventWithPayload{Kind: common.EMIT_VALUE, PayloadType: common.NULL, Payload: "null", Source: "~", Position: common.Position{Line: 1, Column: 1}},
+		common.NewDocumentEndEvent(false),
+		common.NewStreamEndEvent(),
+	}
+	runTestWithOptions(t, tokenize("~\n"), expectedEvents, ParseOptions{Detailed: true})
+}
+
+func TestTokensToEventsDetailedUnknownAlias(t *testing.T) {
+	runErrorTestWithOptions(t, "- *a\n", 1, 3, ParseOptions{Detailed: true})
+}
+
+func TestTokensToEventsContextCancelled(t *testing.T) {
+	defer leaktest.Check(t)()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	tokens := make(chan Token)
+
+	events, errc := TokensToEventsContext(ctx, tokens)
+
+	// nobody reads the events, so the parser blocks on its first send
+	tokens <- &wordToken{"foo"}
+	tokens <- newlineToken
+	cancel()
+
+	if err := <-errc; err != context.Canceled {
+		t.Errorf("Expected %v, got %v", context.Canceled, err)
+	}
+	if _, ok := <-events; ok {
+		t.Error("Expected events channel to be closed")
+	}
+}
+
+func TestTokensToEventsContextError(t *testing.T) {
+	defer leaktest.Check(t)()
+
+	tokens := make(chan Token)
+	events, errc := TokensToEventsContext(context.Background(), tokens)
+
+	go func() {
+		// The parser stops reading after the error, so the remaining tokens
+		// must not block this goroutine forever.
+		for _, token := range []Token{colonToken, newlineToken, &wordToken{"foo"}} {
+			select {
+			case tokens <- token:
+			case <-events:
+			}
+		}
+		close(tokens)
+	}()
+
+	for range events {
+	}
+	if err := <-errc; err == nil {
+		t.Error("Expected an error")
+	}
+}
+
+// runErrorTest checks that parsing the input fails with a SyntaxError at the
+// given position.
+func runErrorTest(t *testing.T, input string, line int, column int) {
+	t.Helper()
+	runErrorTestWithOptions(t, input, line, column, ParseOptions{})
+}
+
+func runErrorTestWithOptions(t *testing.T, input string, line int, column int, opts ParseOptions) {
+	t.Helper()
+	tokens := make(chan Token)
+	go func() {
+		for _, token := range tokenize(input) {
+			tokens <- token
+		}
+		close(tokens)
+	}()
+
+	events, errc := TokensToEventsWithOptions(context.Background(), tokens, opts)
+	for range events {
+	}
+	// unblock the goroutine above
+	for range tokens {
+	}
+
+	err := <-errc
+	syntaxErr, ok := err.(*SyntaxError)
+	if !ok {
+		t.Errorf("%q: expected a SyntaxError, got %v", input, err)
+		return
+	}
+	if syntaxErr.Line != line || syntaxErr.Column != column {
+		t.Errorf("%q: expected an error at %d:%d, got %v", input, line, column, err)
+	}
+}
+
+// tokenize splits the input into tokens with a Scanner.
+func tokenize(input string) []Token {
+	scanner := NewScanner(strings.NewReader(input))
+	tokens := []Token{}
+	for scanner.Scan() {
+		tokens = append(tokens, scanner.Token())
+	}
+	return tokens
+}
+
 func runTest(t *testing.T, tokens []Token, expectedEvents []common.Event) {
+	runTestWithOptions(t, tokens, expectedEvents, ParseOptions{})
+}
+
+func runTestWithOptions(t *testing.T, tokens []Token, expectedEvents []common.Event, opts ParseOptions) {
+	t.Helper()
 	tokenChannel := make(chan Token)
 	done := make(chan bool)
 
-	eventChannel := TokensToEvents(tokenChannel)
-	var events = make([]common.Event, 0)
+	eventChannel, errc := TokensToEventsWithOptions(context.Background(), tokenChannel, opts)
 	go func() {
-		for event := range eventChannel {
-			events = append(events, event)
+		defer close(tokenChannel)
+		for _, token := range tokens {
+			select {
+			case tokenChannel <- token:
+			case <-done:
+				// the parser failed and doesn't read any more tokens
+				return
+			}
 		}
-		done <- true
 	}()
 
-	for _, token := range tokens {
-		tokenChannel <- token
+	var events = make([]common.Event, 0)
+	for event := range eventChannel {
+		events = append(events, event)
 	}
-	close(tokenChannel)
+	close(done)
 
-	<-done
+	if err := <-errc; err != nil {
+		t.Error("Unexpected error:", err)
+	}
 	if !reflect.DeepEqual(events, expectedEvents) {
 		t.Error("Expected", expectedEvents, "got", events)
 	}
@@ -0,0 +1,339 @@
+package yaml
+
+import (
+	"fmt"
+	"hbibel/yaml-to-json/common"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+type scalarStyle int
+
+const (
+	plainStyle scalarStyle = iota
+	singleQuotedStyle
+	doubleQuotedStyle
+)
+
+// scalarBuilder collects the lines of a scalar that may span several lines.
+// The lines are folded as described in
+// https://yaml.org/spec/1.2.2/#65-line-folding: a single line break becomes a
+// space, while each empty line becomes a line break.
+type scalarBuilder struct {
+	style scalarStyle
+	// continuation lines of a plain scalar must be indented more than parent
+	parent int
+	text   strings.Builder
+	// the number of empty lines since the last line with content
+	blankLines int
+	// whether the previous line of a double quoted scalar ended with a "\"
+	escapedBreak bool
+	// whether the closing quote of a quoted scalar has been found
+	closed bool
+	// the expanded tag and the anchor of the scalar, if it has them
+	tag    string
+	anchor string
+	// where the scalar starts, for error messages
+	line   int
+	column int
+}
+
+// startScalar begins a scalar with the tokens that start at the given column.
+// It is complete at the earliest at the end of the line.
+func (p *parser) startScalar(tokens []Token, column int) error {
+	b := &scalarBuilder{
+		parent: p.pendingColumn,
+		tag:    p.pendingTag,
+		line:   p.line,
+		column: column,
+	}
+	p.scalar = b
+	p.pendingValue = false
+	p.pendingTag = ""
+	b.anchor = p.takeAnchor(0)
+
+	switch tokens[0].Kind() {
+	case SINGLE_QUOTE:
+		b.style = singleQuotedStyle
+		return p.addQuotedLine(tokens[1:], true)
+	case DOUBLE_QUOTE:
+		b.style = doubleQuotedStyle
+		return p.addQuotedLine(tokens[1:], true)
+	default:
+		if err := p.checkPlainStart(tokens, column); err != nil {
+			return err
+		}
+		b.text.WriteString(strings.TrimRight(tokensToString(tokens), " \t"))
+		return p.checkScalarLength(b.text.Len())
+	}
+}
+
+// checkPlainStart rejects a plain scalar that starts with an indicator. Such
+// text is a flow collection, a block scalar or a complex key, which the parser
+// doesn't read, or it is reserved. Taking it as a string would change the
+// meaning of the document.
+func (p *parser) checkPlainStart(tokens []Token, column int) error {
+	word := tokens[0].String()
+	if tokens[0].Kind() != WORD || word == "" {
+		return nil
+	}
+	switch word[0] {
+	case '[', '{':
+		return p.syntaxError(column, "flow collections are not supported")
+	case '|', '>':
+		return p.syntaxError(column, "block scalars are not supported")
+	case ']', '}', ',', '@', '`':
+		return p.syntaxError(column, "a plain scalar cannot start with %q", word[:1])
+	}
+	if word == "?" && (len(tokens) == 1 || tokens[1].Kind() == SPACE) {
+		return p.syntaxError(column, "complex mapping keys are not supported")
+	}
+	return nil
+}
+
+// continueScalar offers a line to the unfinished scalar. It returns true if
+// the line was consumed. Otherwise, the scalar is complete and has been
+// emitted.
+func (p *parser) continueScalar(tokens []Token) (bool, error) {
+	b := p.scalar
+	if b.style != plainStyle {
+		return true, p.addQuotedLine(tokens, false)
+	}
+
+	if isBlank(tokens) {
+		// the input ends after a newline, which doesn't start an empty line
+		if !p.atEnd || len(tokens) > 0 {
+			b.blankLines++
+		}
+		return true, nil
+	}
+	content, column := tokens, 0
+	if tokens[0].Kind() == INDENT {
+		content, column = tokens[1:], tokenWidth(tokens[0])
+	}
+	if column <= b.parent || documentMarker(tokens) != noMarker {
+		return false, p.finishScalar()
+	}
+
+	content, column = skipSpaces(content, column)
+	if colon := findMappingColon(content); colon >= 0 {
+		return true, p.syntaxError(column, "mapping values are not allowed in a multi-line plain scalar")
+	}
+	b.fold()
+	b.text.WriteString(strings.TrimRight(tokensToString(content), " \t"))
+	return true, p.checkScalarLength(b.text.Len())
+}
+
+// addQuotedLine adds a line to a single or double quoted scalar. If the line
+// contains the closing quote, the scalar is emitted.
+func (p *parser) addQuotedLine(tokens []Token, first bool) error {
+	b := p.scalar
+	quote := SINGLE_QUOTE
+	if b.style == doubleQuotedStyle {
+		quote = DOUBLE_QUOTE
+	}
+
+	end := findClosingQuote(tokens, quote)
+	segment := tokens
+	if end >= 0 {
+		segment = tokens[:end]
+	}
+	raw := tokensToString(segment)
+	if !first {
+		raw = strings.TrimLeft(raw, " \t")
+	}
+	if end < 0 {
+		raw = strings.TrimRight(raw, " \t")
+		if !first && raw == "" {
+			b.blankLines++
+			return nil
+		}
+	}
+
+	if !first {
+		b.fold()
+	}
+	if end < 0 && b.style == doubleQuotedStyle && trailingBackslashes(raw)%2 == 1 {
+		raw = raw[:len(raw)-1]
+		b.escapedBreak = true
+	}
+
+	text := raw
+	if b.style == singleQuotedStyle {
+		text = strings.ReplaceAll(raw, "''", "'")
+	} else {
+		var err error
+		if text, err = unescapeDoubleQuoted(raw); err != nil {
+			return p.syntaxError(b.column, "%v", err)
+		}
+	}
+	b.text.WriteString(text)
+	if err := p.checkScalarLength(b.text.Len()); err != nil {
+		return err
+	}
+
+	if end < 0 {
+		return nil
+	}
+	if !isBlank(tokens[end+1:]) {
+		return p.syntaxError(b.column, "unexpected content after the end of a quoted scalar")
+	}
+	b.closed = true
+	return p.finishScalar()
+}
+
+// fold adds the separator between two lines of a scalar.
+func (b *scalarBuilder) fold() {
+	if b.escapedBreak {
+		b.escapedBreak = false
+	} else if b.blankLines == 0 {
+		b.text.WriteByte(' ')
+	} else {
+		b.text.WriteString(strings.Repeat("\n", b.blankLines))
+	}
+	b.blankLines = 0
+}
+
+// finishScalar emits the unfinished scalar, if there is one.
+func (p *parser) finishScalar() error {
+	b := p.scalar
+	if b == nil {
+		return nil
+	}
+	p.scalar = nil
+
+	if b.style != plainStyle && !b.closed {
+		return &SyntaxError{Line: b.line, Column: b.column + 1, Msg: "the quoted scalar is never closed"}
+	}
+	var event common.Event
+	switch {
+	case b.tag != "":
+		var err error
+		event, err = resolveTagged(p.schema, b.tag, b.text.String(), b.style == plainStyle)
+		if err != nil {
+			return &SyntaxError{Line: b.line, Column: b.column + 1, Msg: err.Error()}
+		}
+	case b.style == plainStyle:
+		event = resolveScalar(p.schema, b.text.String())
+	default:
+		event = common.NewStringEvent(b.text.String())
+	}
+
+	style := common.PLAIN
+	switch b.style {
+	case singleQuotedStyle:
+		style = common.SINGLE_QUOTED
+	case doubleQuotedStyle:
+		style = common.DOUBLE_QUOTED
+	}
+	position := common.Position{Line: b.line, Column: b.column + 1}
+	p.emit(p.scalarEvent(event, b.text.String(), style, b.tag, b.anchor, position))
+	// empty lines at the end of a plain scalar separate it from what follows
+	p.emitBlankLines(b.blankLines)
+	return nil
+}
+
+// scalarEvent adds the source, the style and the properties of a scalar to its
+// event if events are detailed.
+func (p *parser) scalarEvent(event common.Event, source string, style common.ScalarStyle, tag, anchor string, position common.Position) common.Event {
+	if !p.opts.Detailed {
+		return event
+	}
+	e := event.(*common.EventWithPayload)
+	e.Source = source
+	e.Style = style
+	e.Tag = tag
+	e.Anchor = anchor
+	e.Position = position
+	return e
+}
+
+// findClosingQuote returns the index of the token that ends a quoted scalar,
+// or -1 if the scalar doesn't end within the tokens. The opening quote must
+// not be part of the tokens.
+func findClosingQuote(tokens []Token, quote TokenKind) int {
+	for i := 0; i < len(tokens); i++ {
+		if tokens[i].Kind() != quote {
+			continue
+		}
+		if quote == SINGLE_QUOTE {
+			// '' is an escaped quote
+			if i+1 < len(tokens) && tokens[i+1].Kind() == SINGLE_QUOTE {
+				i++
+				continue
+			}
+			return i
+		}
+		if i > 0 && tokens[i-1].Kind() == WORD && trailingBackslashes(tokens[i-1].String())%2 == 1 {
+			continue
+		}
+		return i
+	}
+	return -1
+}
+
+func trailingBackslashes(s string) int {
+	n := 0
+	for n < len(s) && s[len(s)-1-n] == '\\' {
+		n++
+	}
+	return n
+}
+
+var simpleEscapes = map[byte]string{
+	'0':  "\x00",
+	'a':  "\a",
+	'b':  "\b",
+	't':  "\t",
+	'\t': "\t",
+	'n':  "\n",
+	'v':  "\v",
+	'f':  "\f",
+	'r':  "\r",
+	'e':  "\x1b",
+	' ':  " ",
+	'"':  "\"",
+	'/':  "/",
+	'\\': "\\",
+	'N':  "\u0085",
+	'_':  " ",
+	'L':  " ",
+	'P':  " ",
+}
+
+// unescapeDoubleQuoted replaces the escape sequences of a double quoted
+// scalar, see https://yaml.org/spec/1.2.2/#57-escaped-characters
+func unescapeDoubleQuoted(s string) (string, error) {
+	if !strings.Contains(s, "\\") {
+		return s, nil
+	}
+
+	sb := strings.Builder{}
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' {
+			sb.WriteByte(s[i])
+			continue
+		}
+		if i+1 == len(s) {
+			return "", fmt.Errorf("incomplete escape sequence at the end of a double quoted scalar")
+		}
+		i++
+		if replacement, ok := simpleEscapes[s[i]]; ok {
+			sb.WriteString(replacement)
+			continue
+		}
+
+		digits := map[byte]int{'x': 2, 'u': 4, 'U': 8}[s[i]]
+		if digits == 0 || i+digits >= len(s) {
+			return "", fmt.Errorf("invalid escape sequence '\\%c' in a double quoted scalar", s[i])
+		}
+		code, err := strconv.ParseUint(s[i+1:i+1+digits], 16, 32)
+		if err != nil || !utf8.ValidRune(rune(code)) {
+			return "", fmt.Errorf("invalid escape sequence '\\%s' in a double quoted scalar", s[i:i+1+digits])
+		}
+		sb.WriteRune(rune(code))
+		i += digits
+	}
+	return sb.String(), nil
+}
@@ -0,0 +1,417 @@
+package yaml
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Scanner splits YAML input into tokens. Its interface is modeled after
+// bufio.Scanner: call Scan until it returns false, and inspect the current
+// token with Kind and Bytes in between. Unlike Tokenize, it works directly on
+// the bytes of a buffered reader and does not allocate memory per token.
+//
+// The tokens are the same as the ones produced by Tokenize.
+type Scanner struct {
+	reader *bufio.Reader
+	// line holds the remainder of the current line without the line break.
+	// It points into the buffer of reader or into longLine.
+	line []byte
+	// longLine collects lines that don't fit into the buffer of reader
+	longLine []byte
+	// whether line still needs an INDENT and a NEWLINE token
+	atLineStart bool
+	inLine      bool
+	lineNumber  int
+	// maxLineLength is the maximum number of bytes per line, or zero if
+	// lines are unlimited
+	maxLineLength int
+	// the number of bytes read so far and its limit, which is zero if the
+	// input is unlimited
+	inputBytes    int
+	maxInputBytes int
+
+	kind TokenKind
+	text []byte
+	err  error
+
+	// words caches the tokens of short words for Token, because words like
+	// mapping keys tend to repeat
+	words map[string]Token
+}
+
+// The cache of word tokens is limited to words of up to maxCachedWordLength
+// bytes, and to maxCachedWords of them.
+const (
+	maxCachedWordLength = 32
+	maxCachedWords      = 4096
+)
+
+func NewScanner(r io.Reader) *Scanner {
+	return &Scanner{reader: bufio.NewReaderSize(r, 64*1024)}
+}
+
+// ErrLineTooLong is reported by Scanner if a line exceeds the maximum length.
+var ErrLineTooLong = errors.New("line too long")
+
+// SetMaxLineLength limits the length of a line in bytes, not counting the line
+// break. Longer lines make Scan fail with ErrLineTooLong. By default, or if max
+// is zero, the line length is only limited by the available memory.
+func (s *Scanner) SetMaxLineLength(max int) {
+	s.maxLineLength = max
+}
+
+// ErrInputTooLarge is reported by Scanner if the input exceeds the maximum
+// size.
+var ErrInputTooLarge = errors.New("input too large")
+
+// SetMaxInputBytes limits the size of the input in bytes, including line
+// breaks. Larger input makes Scan fail with ErrInputTooLarge. By default, or if
+// max is zero, the input is unlimited.
+func (s *Scanner) SetMaxInputBytes(max int) {
+	s.maxInputBytes = max
+}
+
+// Scan advances to the next token. It returns false at the end of the input
+// or if reading failed, in which case Err returns the error.
+func (s *Scanner) Scan() bool {
+	if !s.inLine {
+		if s.err != nil || !s.readLine() {
+			return false
+		}
+		s.inLine = true
+		s.atLineStart = true
+	}
+
+	if s.atLineStart {
+		s.atLineStart = false
+		n := 0
+		for n < len(s.line) && s.line[n] == ' ' {
+			n++
+		}
+		if n > 0 {
+			s.setToken(INDENT, n)
+			return true
+		}
+	}
+
+	if len(s.line) == 0 {
+		s.inLine = false
+		s.kind = NEWLINE
+		s.text = newlineBytes
+		return true
+	}
+
+	switch c := s.line[0]; c {
+	case '-':
+		s.setToken(DASH, 1)
+	case ':':
+		s.setToken(COLON, 1)
+	case '"':
+		s.setToken(DOUBLE_QUOTE, 1)
+	case '\'':
+		s.setToken(SINGLE_QUOTE, 1)
+	case ' ', '\t':
+		n := 1
+		for n < len(s.line) && isSpaceByte(s.line[n]) {
+			n++
+		}
+		s.setToken(SPACE, n)
+	default:
+		n := 1
+		for n < len(s.line) && !isSpaceByte(s.line[n]) && !isSpecialByte(s.line[n]) {
+			n++
+		}
+		s.setToken(WORD, n)
+	}
+	return true
+}
+
+// Kind returns the kind of the current token.
+func (s *Scanner) Kind() TokenKind {
+	return s.kind
+}
+
+// Bytes returns the content of the current token. The underlying array may be
+// overwritten by the next call to Scan.
+func (s *Scanner) Bytes() []byte {
+	return s.text
+}
+
+// Token returns the current token as a Token value that stays valid after the
+// next call to Scan. Unlike Scan, this allocates memory for words that are
+// long or seen for the first time, and for spaces other than a single one.
+func (s *Scanner) Token() Token {
+	switch s.kind {
+	case INDENT:
+		return newIndentToken(uint32(len(s.text)))
+	case WORD:
+		return s.wordToken()
+	case SPACE:
+		if len(s.text) == 1 && s.text[0] == ' ' {
+			return singleSpaceToken
+		}
+		return &spaceToken{string(s.text)}
+	case DASH:
+		return dashToken
+	case COLON:
+		return colonToken
+	case DOUBLE_QUOTE:
+		return doubleQuoteToken
+	case SINGLE_QUOTE:
+		return singleQuoteToken
+	default:
+		return newlineToken
+	}
+}
+
+// wordToken returns the token of the current word, from the cache if
+// possible.
+func (s *Scanner) wordToken() Token {
+	if len(s.text) > maxCachedWordLength {
+		return &wordToken{string(s.text)}
+	}
+	// the conversion in the map index doesn't allocate
+	if token, ok := s.words[string(s.text)]; ok {
+		return token
+	}
+	token := &wordToken{string(s.text)}
+	if len(s.words) < maxCachedWords {
+		if s.words == nil {
+			s.words = map[string]Token{}
+		}
+		s.words[token.content] = token
+	}
+	return token
+}
+
+// drained reports whether the current line is complete and no more input is
+// buffered, so that the next call of Scan may block in a Read.
+func (s *Scanner) drained() bool {
+	return !s.inLine && s.reader.Buffered() == 0
+}
+
+// Line returns the line number of the current token, starting at 1.
+func (s *Scanner) Line() int {
+	return s.lineNumber
+}
+
+// Err returns the first error that occurred while reading the input, except
+// for io.EOF.
+func (s *Scanner) Err() error {
+	return s.err
+}
+
+func (s *Scanner) setToken(kind TokenKind, length int) {
+	s.kind = kind
+	s.text = s.line[:length]
+	s.line = s.line[length:]
+}
+
+// readLine reads the next line into s.line. Like bufio.ScanLines, it drops the
+// line break including a trailing carriage return, and it accepts a last line
+// that isn't terminated by a line break.
+func (s *Scanner) readLine() bool {
+	line, err := s.reader.ReadSlice('\n')
+	if err == bufio.ErrBufferFull {
+		s.longLine = append(s.longLine[:0], line...)
+		// leave room for "\r\n" so that the check below reports the error
+		for err == bufio.ErrBufferFull && (s.maxLineLength <= 0 || len(s.longLine) <= s.maxLineLength+2) &&
+			(s.maxInputBytes <= 0 || s.inputBytes+len(s.longLine) <= s.maxInputBytes) {
+			line, err = s.reader.ReadSlice('\n')
+			s.longLine = append(s.longLine, line...)
+		}
+		line = s.longLine
+	}
+	if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+		s.err = err
+		return false
+	}
+	if len(line) == 0 {
+		return false
+	}
+
+	s.lineNumber++
+	s.inputBytes += len(line)
+	if s.maxInputBytes > 0 && s.inputBytes > s.maxInputBytes {
+		s.err = fmt.Errorf("line %d: %w", s.lineNumber, ErrInputTooLarge)
+		return false
+	}
+	line = bytes.TrimSuffix(line, newlineBytes)
+	line = bytes.TrimSuffix(line, carriageReturnBytes)
+	if s.maxLineLength > 0 && len(line) > s.maxLineLength {
+		s.err = fmt.Errorf("line %d: %w", s.lineNumber, ErrLineTooLong)
+		return false
+	}
+	s.line = line
+	return true
+}
+
+func isSpaceByte(c byte) bool {
+	return c == ' ' || c == '\t'
+}
+
+func isSpecialByte(c byte) bool {
+	return (c == '\'' ||
+		c == '"' ||
+		c == ':' ||
+		c == '-')
+}
+
+var newlineBytes = []byte("\n")
+var carriageReturnBytes = []byte("\r")
+
+// TokenizeReader is like TokenizeContext, but reads the input directly from r
+// using a Scanner instead of receiving it line by line.
+func TokenizeReader(ctx context.Context, r io.Reader, tokens chan<- Token) <-chan error {
+	errc := make(chan error, 1)
+	go func() {
+		defer close(errc)
+		defer close(tokens)
+
+		scanner := NewScanner(r)
+		for scanner.Scan() {
+			select {
+			case tokens <- scanner.Token():
+			case <-ctx.Done():
+				errc <- ctx.Err()
+				return
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			errc <- err
+		}
+	}()
+	return errc
+}
+
+// DefaultBatchSize is the number of tokens or events that the batching
+// pipeline stages send at once unless configured otherwise.
+const DefaultBatchSize = 1024
+
+// TokenizeOptions configure TokenizeBatches.
+type TokenizeOptions struct {
+	// BatchSize is the maximum number of tokens that are sent at once. If it
+	// is zero, DefaultBatchSize is used.
+	BatchSize int
+	// MaxLineLength is the maximum number of bytes per line. If it is zero,
+	// lines are unlimited.
+	MaxLineLength int
+	// MaxInputBytes is the maximum size of the input. If it is zero, the
+	// input is unlimited.
+	MaxInputBytes int
+}
+
+// TokenizeBatches is like TokenizeReader, but sends slices of tokens instead of
+// single tokens. The receiver owns the slices that are sent to it. A batch is
+// sent when it is full, or before reading more input would block, so that
+// slowly arriving input isn't held back.
+func TokenizeBatches(ctx context.Context, r io.Reader, opts TokenizeOptions) (<-chan []Token, <-chan error) {
+	batchSize := opts.BatchSize
+	if batchSize <= 0 {
+		batchSize = DefaultBatchSize
+	}
+	tokens := make(chan []Token)
+	errc := make(chan error, 1)
+	go func() {
+		defer close(errc)
+		defer close(tokens)
+
+		var batch batchBuilder
+		send := func() bool {
+			select {
+			case tokens <- batch.finish(batchSize):
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		}
+
+		scanner := NewScanner(r)
+		scanner.SetMaxLineLength(opts.MaxLineLength)
+		scanner.SetMaxInputBytes(opts.MaxInputBytes)
+		for scanner.Scan() {
+			batch.add(scanner)
+			if (batch.len() == batchSize || scanner.drained()) && !send() {
+				errc <- ctx.Err()
+				return
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			errc <- err
+			return
+		}
+		if batch.len() > 0 && !send() {
+			errc <- ctx.Err()
+		}
+	}()
+	return tokens, errc
+}
+
+// batchBuilder collects the tokens of a batch for TokenizeBatches. The words
+// and spaces of a batch share one string for their text and one slice for
+// their token values, so that a batch needs a few allocations instead of two
+// per word. In exchange, a single token keeps the text of its whole batch in
+// memory.
+type batchBuilder struct {
+	tokens []Token
+	// the text of the words and spaces, and where it belongs
+	text  []byte
+	spans []textSpan
+	words int
+}
+
+// textSpan is the part of batchBuilder.text that belongs to a word or a space
+// whose Token is created by finish.
+type textSpan struct {
+	index      int
+	kind       TokenKind
+	start, end int
+}
+
+// add appends the current token of the scanner.
+func (b *batchBuilder) add(s *Scanner) {
+	if s.Kind() != WORD && (s.Kind() != SPACE || string(s.Bytes()) == " ") {
+		b.tokens = append(b.tokens, s.Token())
+		return
+	}
+	if s.Kind() == WORD {
+		b.words++
+	}
+	start := len(b.text)
+	b.text = append(b.text, s.Bytes()...)
+	b.spans = append(b.spans, textSpan{len(b.tokens), s.Kind(), start, len(b.text)})
+	b.tokens = append(b.tokens, nil)
+}
+
+func (b *batchBuilder) len() int {
+	return len(b.tokens)
+}
+
+// finish returns the collected tokens and starts a new batch, which gets
+// room for capacity tokens.
+func (b *batchBuilder) finish(capacity int) []Token {
+	text := string(b.text)
+	words := make([]wordToken, b.words)
+	spaces := make([]spaceToken, len(b.spans)-b.words)
+	for _, span := range b.spans {
+		if span.kind == WORD {
+			words[0].content = text[span.start:span.end]
+			b.tokens[span.index] = &words[0]
+			words = words[1:]
+		} else {
+			spaces[0].content = text[span.start:span.end]
+			b.tokens[span.index] = &spaces[0]
+			spaces = spaces[1:]
+		}
+	}
+	tokens := b.tokens
+	b.tokens = make([]Token, 0, capacity)
+	b.text = b.text[:0]
+	b.spans = b.spans[:0]
+	b.words = 0
+	return tokens
+}
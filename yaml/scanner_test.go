@@ -0,0 +1,303 @@
+package yaml
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestScannerMatchesTokenize(t *testing.T) {
+	inputs := []string{
+		"",
+		"\n",
+		"key: value\n",
+		"key: value",
+		"key2: \n  - 'x'\n  - y\n  - \"z\"\n",
+		"--:\t \n\n  word-with-dash: 'a: b'\n",
+		"windows: line\r\nendings\r\n",
+		"ünïcödé: wörds\n",
+	}
+	for _, input := range inputs {
+		expected := tokenizeLines(input)
+		actual := scanAll(t, input)
+		if !equalTokens(expected, actual) {
+			t.Errorf("%q:\nActual: %v\nExpected: %v", input, actual, expected)
+		}
+	}
+}
+
+func TestScannerLongLine(t *testing.T) {
+	long := strings.Repeat("x", 200*1024)
+	actual := scanAll(t, "key: "+long+"\nnext\n")
+	expected := []kindAndContent{
+		{WORD, "key"},
+		{COLON, ":"},
+		{SPACE, " "},
+		{WORD, long},
+		{NEWLINE, "\n"},
+		{WORD, "next"},
+		{NEWLINE, "\n"},
+	}
+	if !equalTokens(expected, actual) {
+		t.Errorf("Unexpected tokens for a line longer than the read buffer")
+	}
+}
+
+func TestScannerMaxLineLength(t *testing.T) {
+	for _, input := range []string{"12345\n123456\n", "12345\r\n123456", "12345\n" + strings.Repeat("x", 100*1024)} {
+		scanner := NewScanner(strings.NewReader(input))
+		scanner.SetMaxLineLength(5)
+		for scanner.Scan() {
+		}
+		if !errors.Is(scanner.Err(), ErrLineTooLong) {
+			t.Errorf("%.20q: expected %v, got %v", input, ErrLineTooLong, scanner.Err())
+		}
+	}
+
+	scanner := NewScanner(strings.NewReader("12345\r\n12345"))
+	scanner.SetMaxLineLength(5)
+	for scanner.Scan() {
+	}
+	if scanner.Err() != nil {
+		t.Error("Unexpected error:", scanner.Err())
+	}
+}
+
+func TestScannerMaxInputBytes(t *testing.T) {
+	for _, input := range []string{"12345\n12345", "12345\r\n1234", strings.Repeat("x", 100*1024)} {
+		scanner := NewScanner(strings.NewReader(input))
+		scanner.SetMaxInputBytes(10)
+		for scanner.Scan() {
+		}
+		if !errors.Is(scanner.Err(), ErrInputTooLarge) {
+			t.Errorf("%.20q: expected %v, got %v", input, ErrInputTooLarge, scanner.Err())
+		}
+	}
+
+	scanner := NewScanner(strings.NewReader("12345\n123\n"))
+	scanner.SetMaxInputBytes(10)
+	for scanner.Scan() {
+	}
+	if scanner.Err() != nil {
+		t.Error("Unexpected error:", scanner.Err())
+	}
+}
+
+func TestScannerNoAllocations(t *testing.T) {
+	line := "  - name: John Doe  # comment\n    age: 30\n"
+	scanner := NewScanner(&repeatReader{line: []byte(line)})
+	allocs := testing.AllocsPerRun(10000, func() {
+		if !scanner.Scan() {
+			t.Fatal("Unexpected end of input")
+		}
+	})
+	if allocs != 0 {
+		t.Errorf("Expected no allocations per token, got %v", allocs)
+	}
+}
+
+func TestTokenizeReader(t *testing.T) {
+	input := "key: value\n  - 'x'"
+	tokens := make(chan Token)
+	errc := TokenizeReader(context.Background(), strings.NewReader(input), tokens)
+
+	actual := []kindAndContent{}
+	for token := range tokens {
+		actual = append(actual, kindAndContent{token.Kind(), token.String()})
+	}
+	if err := <-errc; err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	if expected := tokenizeLines(input); !equalTokens(expected, actual) {
+		t.Errorf("\nActual: %v\nExpected: %v", actual, expected)
+	}
+}
+
+func TestTokenizeBatches(t *testing.T) {
+	input := "key: value\n  - 'x'\n"
+	expected := tokenizeLines(input)
+
+	for _, batchSize := range []int{1, 3, 1000} {
+		batches, errc := TokenizeBatches(context.Background(), strings.NewReader(input), TokenizeOptions{BatchSize: batchSize})
+		actual := []kindAndContent{}
+		for batch := range batches {
+			if len(batch) > batchSize {
+				t.Errorf("Batch of %d tokens exceeds batch size %d", len(batch), batchSize)
+			}
+			for _, token := range batch {
+				actual = append(actual, kindAndContent{token.Kind(), token.String()})
+			}
+		}
+		if err := <-errc; err != nil {
+			t.Fatal("Unexpected error:", err)
+		}
+		if !equalTokens(expected, actual) {
+			t.Errorf("\nActual: %v\nExpected: %v", actual, expected)
+		}
+	}
+}
+
+func TestTokenizeBatchesAllocations(t *testing.T) {
+	record := "- name: John Doe\n  age: 30\n  city: 'Springfield'\n"
+	input := []byte(strings.Repeat(record, 1000))
+	tokenCount := 0
+	allocs := testing.AllocsPerRun(10, func() {
+		tokenCount = 0
+		batches, _ := TokenizeBatches(context.Background(), bytes.NewReader(input), TokenizeOptions{})
+		for batch := range batches {
+			tokenCount += len(batch)
+		}
+	})
+	// a batch shares the allocations for the text and the values of its
+	// words and spaces
+	if perToken := allocs / float64(tokenCount); perToken > 0.01 {
+		t.Errorf("Expected few allocations per batch, got %v per token", perToken)
+	}
+}
+
+var benchmarkSize = flag.Int("yaml.benchsize", 100<<20, "size in bytes of the generated input for tokenizer benchmarks")
+
+var benchmarkInput = sync.OnceValue(func() []byte {
+	record := "- name: John Doe\n  age: 30\n  address:\n    street: \"Main Street 1\"\n    city: 'Springfield'\n  tags:\n    - a\n    - b-c\n"
+	var buf bytes.Buffer
+	for buf.Len() < *benchmarkSize {
+		buf.WriteString(record)
+	}
+	return buf.Bytes()
+})
+
+// BenchmarkTokenize measures the line based tokenizer including the
+// bufio.Scanner that feeds it, the way main.go used to drive it.
+func BenchmarkTokenize(b *testing.B) {
+	input := benchmarkInput()
+	b.SetBytes(int64(len(input)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		lines := make(chan string)
+		tokens := make(chan Token)
+		Tokenize(lines, tokens)
+		go func() {
+			scanner := bufio.NewScanner(bytes.NewReader(input))
+			for scanner.Scan() {
+				lines <- scanner.Text()
+			}
+			close(lines)
+		}()
+		for range tokens {
+		}
+	}
+}
+
+func BenchmarkScanner(b *testing.B) {
+	input := benchmarkInput()
+	b.SetBytes(int64(len(input)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		scanner := NewScanner(bytes.NewReader(input))
+		for scanner.Scan() {
+		}
+		if scanner.Err() != nil {
+			b.Fatal(scanner.Err())
+		}
+	}
+}
+
+func BenchmarkTokenizeBatches(b *testing.B) {
+	input := benchmarkInput()
+	b.SetBytes(int64(len(input)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		batches, _ := TokenizeBatches(context.Background(), bytes.NewReader(input), TokenizeOptions{})
+		for range batches {
+		}
+	}
+}
+
+func BenchmarkTokenizeReader(b *testing.B) {
+	input := benchmarkInput()
+	b.SetBytes(int64(len(input)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		tokens := make(chan Token)
+		TokenizeReader(context.Background(), bytes.NewReader(input), tokens)
+		for range tokens {
+		}
+	}
+}
+
+// tokenizeLines tokenizes the input like main.go used to: split it into lines
+// with a bufio.Scanner and feed them to Tokenize.
+func tokenizeLines(input string) []kindAndContent {
+	lines := make(chan string)
+	tokens := make(chan Token)
+	Tokenize(lines, tokens)
+	go func() {
+		scanner := bufio.NewScanner(strings.NewReader(input))
+		for scanner.Scan() {
+			lines <- scanner.Text()
+		}
+		close(lines)
+	}()
+
+	actual := []kindAndContent{}
+	for token := range tokens {
+		actual = append(actual, kindAndContent{token.Kind(), token.String()})
+	}
+	return actual
+}
+
+func scanAll(t *testing.T, input string) []kindAndContent {
+	scanner := NewScanner(strings.NewReader(input))
+	actual := []kindAndContent{}
+	for scanner.Scan() {
+		actual = append(actual, kindAndContent{scanner.Kind(), string(scanner.Bytes())})
+		token := scanner.Token()
+		if token.Kind() != scanner.Kind() || token.String() != string(scanner.Bytes()) {
+			t.Errorf("Token() returned '%v' for '%s'", token, scanner.Bytes())
+		}
+	}
+	if scanner.Err() != nil {
+		t.Fatal("Unexpected error:", scanner.Err())
+	}
+	return actual
+}
+
+func equalTokens(expected, actual []kindAndContent) bool {
+	if len(expected) != len(actual) {
+		return false
+	}
+	for i := range expected {
+		if expected[i] != actual[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// repeatReader endlessly repeats line.
+type repeatReader struct {
+	line []byte
+	pos  int
+}
+
+func (r *repeatReader) Read(p []byte) (int, error) {
+	n := 0
+	for n < len(p) {
+		copied := copy(p[n:], r.line[r.pos:])
+		n += copied
+		r.pos = (r.pos + copied) % len(r.line)
+	}
+	return n, nil
+}
+
+var _ io.Reader = &repeatReader{}
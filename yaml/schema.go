@@ -0,0 +1,225 @@
+package yaml
+
+import (
+	"fmt"
+	"hbibel/yaml-to-json/common"
+	"math/big"
+	"regexp"
+	"strings"
+)
+
+// yamlTagPrefix is the prefix of the tags of the YAML spec, which the "!!"
+// handle stands for.
+const yamlTagPrefix = "tag:yaml.org,2002:"
+
+// Schema determines how plain (unquoted) scalars are resolved to JSON types.
+// See https://yaml.org/spec/1.2.2/#chapter-10-recommended-schemas
+type Schema int
+
+const (
+	// CoreSchema is the default schema of YAML 1.2. It accepts the JSON
+	// values as well as human friendly variants like "True", "~" or "0x1F".
+	CoreSchema Schema = iota
+	// JSONSchema only accepts the literals that are valid in JSON.
+	JSONSchema
+	// FailsafeSchema resolves every scalar to a string.
+	FailsafeSchema
+	// YAML11Schema resolves scalars like YAML 1.1 does, where e.g. "yes" and
+	// "off" are booleans and "0755" is an octal number. It is used for
+	// documents with a "%YAML 1.1" directive.
+	YAML11Schema
+)
+
+func (s Schema) String() string {
+	switch s {
+	case CoreSchema:
+		return "core"
+	case JSONSchema:
+		return "json"
+	case FailsafeSchema:
+		return "failsafe"
+	case YAML11Schema:
+		return "yaml1.1"
+	default:
+		return "unknown"
+	}
+}
+
+var (
+	coreNull     = regexp.MustCompile(`^(null|Null|NULL|~)?$`)
+	coreBool     = regexp.MustCompile(`^(true|True|TRUE|false|False|FALSE)$`)
+	coreInt      = regexp.MustCompile(`^[-+]?[0-9]+$`)
+	coreOctal    = regexp.MustCompile(`^0o[0-7]+$`)
+	coreHex      = regexp.MustCompile(`^0x[0-9a-fA-F]+$`)
+	coreFloat    = regexp.MustCompile(`^[-+]?(\.[0-9]+|[0-9]+(\.[0-9]*)?)([eE][-+]?[0-9]+)?$`)
+	coreInfNaN   = regexp.MustCompile(`^([-+]?\.(inf|Inf|INF)|\.(nan|NaN|NAN))$`)
+	yaml11Bool   = regexp.MustCompile(`^(y|Y|yes|Yes|YES|true|True|TRUE|on|On|ON|n|N|no|No|NO|false|False|FALSE|off|Off|OFF)$`)
+	yaml11Binary = regexp.MustCompile(`^[-+]?0b[01_]+$`)
+	yaml11Octal  = regexp.MustCompile(`^[-+]?0[0-7_]+$`)
+	yaml11Hex    = regexp.MustCompile(`^[-+]?0x[0-9a-fA-F_]+$`)
+	yaml11Int    = regexp.MustCompile(`^[-+]?(0|[1-9][0-9_]*)$`)
+	yaml11Sexa   = regexp.MustCompile(`^[-+]?[1-9][0-9_]*(:[0-5]?[0-9])+$`)
+	yaml11Float  = regexp.MustCompile(`^[-+]?([0-9][0-9_]*)?\.[0-9_]*([eE][-+][0-9]+)?$`)
+	jsonInt      = regexp.MustCompile(`^-?(0|[1-9][0-9]*)$`)
+	jsonFloat    = regexp.MustCompile(`^-?(0|[1-9][0-9]*)(\.[0-9]*)?([eE][-+]?[0-9]+)?$`)
+	jsonFraction = regexp.MustCompile(`\.([eE]|$)`)
+)
+
+// ResolvePlain returns the value event that the parser produces for the plain
+// scalar s with the given schema. Emitters use it to find out whether a string
+// can be written without quotes.
+func ResolvePlain(schema Schema, s string) common.Event {
+	return resolveScalar(schema, s)
+}
+
+// resolveScalar turns a plain scalar into a value event according to the given
+// schema. Numbers are normalized to valid JSON numbers. Infinity and NaN have
+// no JSON representation, so they are kept as strings.
+func resolveScalar(schema Schema, s string) common.Event {
+	switch schema {
+	case FailsafeSchema:
+		return common.NewStringEvent(s)
+	case JSONSchema:
+		switch {
+		case s == "null":
+			return common.NewNullEvent()
+		case s == "true" || s == "false":
+			return common.NewBooleanEvent(s)
+		case jsonInt.MatchString(s) || jsonFloat.MatchString(s):
+			return common.NewNumberEvent(normalizeDecimal(s))
+		}
+		return common.NewStringEvent(s)
+	case YAML11Schema:
+		return resolveYAML11Scalar(s)
+	default:
+		switch {
+		case coreNull.MatchString(s):
+			return common.NewNullEvent()
+		case coreBool.MatchString(s):
+			return common.NewBooleanEvent(strings.ToLower(s))
+		case coreOctal.MatchString(s):
+			return common.NewNumberEvent(radixToDecimal(s[2:], 8))
+		case coreHex.MatchString(s):
+			return common.NewNumberEvent(radixToDecimal(s[2:], 16))
+		case coreInt.MatchString(s) || coreFloat.MatchString(s):
+			return common.NewNumberEvent(normalizeDecimal(s))
+		}
+		return common.NewStringEvent(s)
+	}
+}
+
+// resolveYAML11Scalar resolves a plain scalar with the types of
+// https://yaml.org/type/, which YAML 1.1 uses by default.
+func resolveYAML11Scalar(s string) common.Event {
+	switch {
+	case coreNull.MatchString(s):
+		return common.NewNullEvent()
+	case yaml11Bool.MatchString(s):
+		switch strings.ToLower(s) {
+		case "y", "yes", "true", "on":
+			return common.NewBooleanEvent("true")
+		}
+		return common.NewBooleanEvent("false")
+	}
+
+	sign, digits := "", strings.ReplaceAll(s, "_", "")
+	if digits != "" && (digits[0] == '-' || digits[0] == '+') {
+		if digits[0] == '-' {
+			sign = "-"
+		}
+		digits = digits[1:]
+	}
+	switch {
+	case yaml11Binary.MatchString(s):
+		return common.NewNumberEvent(sign + radixToDecimal(digits[2:], 2))
+	case yaml11Hex.MatchString(s):
+		return common.NewNumberEvent(sign + radixToDecimal(digits[2:], 16))
+	case yaml11Octal.MatchString(s):
+		return common.NewNumberEvent(sign + radixToDecimal(digits[1:], 8))
+	case yaml11Int.MatchString(s):
+		return common.NewNumberEvent(sign + digits)
+	case yaml11Sexa.MatchString(s):
+		return common.NewNumberEvent(sign + sexagesimalToDecimal(digits))
+	case yaml11Float.MatchString(s) && strings.ContainsAny(digits, "0123456789"):
+		return common.NewNumberEvent(normalizeDecimal(sign + digits))
+	}
+	return common.NewStringEvent(s)
+}
+
+// resolveTagged resolves a scalar with an explicit tag. The core tags !!str,
+// !!null, !!bool, !!int and !!float determine the type of the scalar, while
+// other tags don't have a JSON representation and are ignored.
+func resolveTagged(schema Schema, tag string, s string, plain bool) (common.Event, error) {
+	if schema == FailsafeSchema {
+		// the failsafe schema has no other types than strings, but an
+		// explicit tag is more specific than that
+		schema = CoreSchema
+	}
+
+	var want common.PayLoadType
+	switch tag {
+	case "!", yamlTagPrefix + "str":
+		return common.NewStringEvent(s), nil
+	case yamlTagPrefix + "null":
+		want = common.NULL
+	case yamlTagPrefix + "bool":
+		want = common.BOOLEAN
+	case yamlTagPrefix + "int", yamlTagPrefix + "float":
+		if tag == yamlTagPrefix+"float" && coreInfNaN.MatchString(s) {
+			return common.NewStringEvent(s), nil
+		}
+		want = common.NUMBER
+	default:
+		if plain {
+			return resolveScalar(schema, s), nil
+		}
+		return common.NewStringEvent(s), nil
+	}
+
+	event := resolveScalar(schema, s)
+	if event.(common.HasPayload).GetPayLoadType() != want {
+		return nil, fmt.Errorf("%q is not a valid %s", s, "!!"+strings.TrimPrefix(tag, yamlTagPrefix))
+	}
+	return event, nil
+}
+
+// normalizeDecimal rewrites a decimal YAML number such that it is a valid JSON
+// number, e.g. "+.5" becomes "0.5" and "007" becomes "7".
+func normalizeDecimal(s string) string {
+	sign := ""
+	if s[0] == '-' {
+		sign = "-"
+		s = s[1:]
+	} else if s[0] == '+' {
+		s = s[1:]
+	}
+
+	// a dot without digits after it is not allowed in JSON
+	s = jsonFraction.ReplaceAllString(s, ".0$1")
+	if s[0] == '.' {
+		s = "0" + s
+	}
+	for len(s) > 1 && s[0] == '0' && s[1] >= '0' && s[1] <= '9' {
+		s = s[1:]
+	}
+	return sign + s
+}
+
+// sexagesimalToDecimal converts a base 60 number like "1:30:00" to decimal.
+func sexagesimalToDecimal(s string) string {
+	n := new(big.Int)
+	for _, part := range strings.Split(s, ":") {
+		digit, _ := new(big.Int).SetString(part, 10)
+		n.Mul(n, big.NewInt(60)).Add(n, digit)
+	}
+	return n.String()
+}
+
+func radixToDecimal(digits string, base int) string {
+	if digits == "" {
+		// YAML 1.1 allows numbers like "0_" or "0x_" without digits
+		return "0"
+	}
+	n, _ := new(big.Int).SetString(digits, base)
+	return n.String()
+}
@@ -0,0 +1,90 @@
+package yaml
+
+import (
+	"hbibel/yaml-to-json/common"
+	"reflect"
+	"testing"
+)
+
+func TestResolveScalarCoreSchema(t *testing.T) {
+	cases := map[string]common.Event{
+		"":      common.NewNullEvent(),
+		"~":     common.NewNullEvent(),
+		"Null":  common.NewNullEvent(),
+		"TRUE":  common.NewBooleanEvent("true"),
+		"False": common.NewBooleanEvent("false"),
+		"42":    common.NewNumberEvent("42"),
+		"+42":   common.NewNumberEvent("42"),
+		"-007":  common.NewNumberEvent("-7"),
+		"0o17":  common.NewNumberEvent("15"),
+		"0x1F":  common.NewNumberEvent("31"),
+		"1.":    common.NewNumberEvent("1.0"),
+		"-.5e3": common.NewNumberEvent("-0.5e3"),
+		".inf":  common.NewStringEvent(".inf"),
+		"yes":   common.NewStringEvent("yes"),
+		"0x":    common.NewStringEvent("0x"),
+	}
+	for input, expected := range cases {
+		actual := resolveScalar(CoreSchema, input)
+		if !reflect.DeepEqual(actual, expected) {
+			t.Errorf("%q: expected %v, got %v", input, expected, actual)
+		}
+	}
+}
+
+func TestResolveScalarJSONSchema(t *testing.T) {
+	cases := map[string]common.Event{
+		"null":  common.NewNullEvent(),
+		"~":     common.NewStringEvent("~"),
+		"true":  common.NewBooleanEvent("true"),
+		"True":  common.NewStringEvent("True"),
+		"-1.5":  common.NewNumberEvent("-1.5"),
+		"1e10":  common.NewNumberEvent("1e10"),
+		"+1":    common.NewStringEvent("+1"),
+		"0x1F":  common.NewStringEvent("0x1F"),
+		"hello": common.NewStringEvent("hello"),
+	}
+	for input, expected := range cases {
+		actual := resolveScalar(JSONSchema, input)
+		if !reflect.DeepEqual(actual, expected) {
+			t.Errorf("%q: expected %v, got %v", input, expected, actual)
+		}
+	}
+}
+
+func TestResolveScalarFailsafeSchema(t *testing.T) {
+	for _, input := range []string{"null", "true", "42"} {
+		actual := resolveScalar(FailsafeSchema, input)
+		expected := common.NewStringEvent(input)
+		if !reflect.DeepEqual(actual, expected) {
+			t.Errorf("%q: expected %v, got %v", input, expected, actual)
+		}
+	}
+}
+
+func TestResolveScalarYAML11Schema(t *testing.T) {
+	cases := map[string]common.Event{
+		"~":         common.NewNullEvent(),
+		"y":         common.NewBooleanEvent("true"),
+		"Off":       common.NewBooleanEvent("false"),
+		"0755":      common.NewNumberEvent("493"),
+		"0":         common.NewNumberEvent("0"),
+		"-0b1010":   common.NewNumberEvent("-10"),
+		"0x_1F":     common.NewNumberEvent("31"),
+		"0_":        common.NewNumberEvent("0"),
+		"-0b_":      common.NewNumberEvent("-0"),
+		"1_000":     common.NewNumberEvent("1000"),
+		"190:20:30": common.NewNumberEvent("685230"),
+		"1.5":       common.NewNumberEvent("1.5"),
+		"-.5e+3":    common.NewNumberEvent("-0.5e+3"),
+		"1e3":       common.NewStringEvent("1e3"),
+		".":         common.NewStringEvent("."),
+		"0o17":      common.NewStringEvent("0o17"),
+	}
+	for input, expected := range cases {
+		actual := resolveScalar(YAML11Schema, input)
+		if !reflect.DeepEqual(actual, expected) {
+			t.Errorf("%q: expected %v, got %v", input, expected, actual)
+		}
+	}
+}
@@ -17,6 +17,29 @@ const (
 	SINGLE_QUOTE
 )
 
+func (k TokenKind) String() string {
+	switch k {
+	case INDENT:
+		return "INDENT"
+	case WORD:
+		return "WORD"
+	case SPACE:
+		return "SPACE"
+	case DASH:
+		return "DASH"
+	case NEWLINE:
+		return "NEWLINE"
+	case COLON:
+		return "COLON"
+	case DOUBLE_QUOTE:
+		return "DOUBLE_QUOTE"
+	case SINGLE_QUOTE:
+		return "SINGLE_QUOTE"
+	default:
+		return "UNKNOWN"
+	}
+}
+
 type Token interface {
 	Kind() TokenKind
 	String() string
@@ -78,3 +101,21 @@ var dashToken Token = &symbolicToken{DASH, "-"}
 var colonToken = &symbolicToken{COLON, ":"}
 var doubleQuoteToken = &symbolicToken{DOUBLE_QUOTE, "\""}
 var singleQuoteToken = &symbolicToken{SINGLE_QUOTE, "'"}
+var singleSpaceToken = &spaceToken{" "}
+
+// indentTokens caches the INDENT tokens for common indentation widths, so that
+// they need not be allocated for every line.
+var indentTokens = func() []*indentToken {
+	tokens := make([]*indentToken, 64)
+	for i := range tokens {
+		tokens[i] = &indentToken{uint32(i)}
+	}
+	return tokens
+}()
+
+func newIndentToken(spaceCount uint32) Token {
+	if spaceCount < uint32(len(indentTokens)) {
+		return indentTokens[spaceCount]
+	}
+	return &indentToken{spaceCount}
+}
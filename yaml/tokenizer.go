@@ -1,133 +1,102 @@
 package yaml
 
-import (
-	"strings"
-)
+import "context"
 
 func Tokenize(lines <-chan string, tokens chan<- Token) {
+	TokenizeContext(context.Background(), lines, tokens)
+}
+
+// TokenizeContext is like Tokenize, but stops reading lines as soon as ctx is
+// cancelled. The tokens channel is closed in any case, so downstream stages
+// terminate as well. The returned channel yields at most one error and is
+// closed when the tokenizer goroutine has exited.
+func TokenizeContext(ctx context.Context, lines <-chan string, tokens chan<- Token) <-chan error {
+	errc := make(chan error, 1)
 	go func() {
-		for line := range lines {
+		defer close(errc)
+		defer close(tokens)
+
+		emit := func(t Token) bool {
+			select {
+			case tokens <- t:
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		}
 
+		for {
+			var line string
 			var ok bool
-			var remaining []rune = []rune(line)
-
-			var numSpaces uint32
-			remaining, numSpaces = countLeadingSpaces(remaining)
-			if numSpaces > 0 {
-				tokens <- &indentToken{numSpaces}
+			select {
+			case line, ok = <-lines:
+			case <-ctx.Done():
+				errc <- ctx.Err()
+				return
 			}
-
-			for len(remaining) > 0 {
-
-				var space string
-				remaining, space = getLeadingSpaces(remaining)
-
-				if len(space) > 0 {
-					tokens <- &spaceToken{space}
-					// it's strictly not necessary to continue here, but the code is more
-					// consistent this way
-					continue
-				}
-
-				remaining, ok = tryParseSymbol([]rune{'-'}, remaining)
-				if ok {
-					tokens <- dashToken
-					continue
-				}
-
-				remaining, ok = tryParseSymbol([]rune{':'}, remaining)
-				if ok {
-					tokens <- colonToken
-					continue
-				}
-
-				remaining, ok = tryParseSymbol([]rune{'"'}, remaining)
-				if ok {
-					tokens <- doubleQuoteToken
-					continue
-				}
-
-				remaining, ok = tryParseSymbol([]rune{'\''}, remaining)
-				if ok {
-					tokens <- singleQuoteToken
-					continue
-				}
-
-				var word string
-				remaining, word = getNextWord(remaining)
-				if len(word) > 0 {
-					tokens <- &wordToken{word}
-				}
+			if !ok {
+				return
 			}
 
-			tokens <- newlineToken
+			if !tokenizeLine(line, emit) {
+				errc <- ctx.Err()
+				return
+			}
 		}
-		close(tokens)
 	}()
-
-}
-
-func countLeadingSpaces(runes []rune) ([]rune, uint32) {
-	var numSpaces uint32 = 0
-	for _, char := range runes {
-		if char == ' ' {
-			numSpaces++
-		} else {
-			break
-		}
-	}
-
-	return runes[numSpaces:], numSpaces
+	return errc
 }
 
-func getLeadingSpaces(runes []rune) ([]rune, string) {
-	literalBuilder := strings.Builder{}
-	for _, c := range runes {
-		if !isSpace(c) {
-			break
-		}
-		literalBuilder.WriteRune(c)
+// tokenizeLine passes the tokens of a single line to emit. It returns false if
+// emit refused a token. Words and spaces are substrings of line, so only their
+// token values are allocated.
+func tokenizeLine(line string, emit func(Token) bool) bool {
+	n := 0
+	for n < len(line) && line[n] == ' ' {
+		n++
 	}
-
-	literal := literalBuilder.String()
-	return runes[len(literal):], literal
-}
-
-func tryParseSymbol(symbol []rune, runes []rune) ([]rune, bool) {
-	symbolLength := len(symbol)
-	if len(runes) < symbolLength {
-		return runes, false
+	if n > 0 && !emit(newIndentToken(uint32(n))) {
+		return false
 	}
 
-	for i, symbolRune := range symbol {
-		if symbolRune != runes[i] {
-			return runes, false
+	for n < len(line) {
+		var token Token
+		switch c := line[n]; {
+		case isSpaceByte(c):
+			end := n + 1
+			for end < len(line) && isSpaceByte(line[end]) {
+				end++
+			}
+			if line[n:end] == " " {
+				token = singleSpaceToken
+			} else {
+				token = &spaceToken{line[n:end]}
+			}
+			n = end
+		case c == '-':
+			token = dashToken
+			n++
+		case c == ':':
+			token = colonToken
+			n++
+		case c == '"':
+			token = doubleQuoteToken
+			n++
+		case c == '\'':
+			token = singleQuoteToken
+			n++
+		default:
+			end := n + 1
+			for end < len(line) && !isSpaceByte(line[end]) && !isSpecialByte(line[end]) {
+				end++
+			}
+			token = &wordToken{line[n:end]}
+			n = end
 		}
-	}
-
-	return runes[symbolLength:], true
-}
-
-func getNextWord(runes []rune) ([]rune, string) {
-	literalBuilder := strings.Builder{}
-	var c rune
-	for _, c = range runes {
-		if isSpace(c) || isSpecial(c) {
-			break
+		if !emit(token) {
+			return false
 		}
-		literalBuilder.WriteRune(c)
 	}
-	word := literalBuilder.String()
-	return runes[len(word):], word
-}
-
-func isSpecial(c rune) bool {
-	return (c == '\'' ||
-		c == '"' ||
-		c == ':' ||
-		c == '-')
-}
 
-func isSpace(c rune) bool {
-	return c == ' ' || c == '\t'
+	return emit(newlineToken)
 }
@@ -1,6 +1,8 @@
 package yaml
 
 import (
+	"context"
+	"hbibel/yaml-to-json/internal/leaktest"
 	"testing"
 )
 
@@ -221,6 +223,59 @@ func TestSmallYamlFile(t *testing.T) {
 	close(lines)
 }
 
+func TestTokenizeContextCancelledWhileBlocked(t *testing.T) {
+	defer leaktest.Check(t)()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	lines := make(chan string)
+	tokens := make(chan Token)
+
+	errc := TokenizeContext(ctx, lines, tokens)
+
+	// nobody reads the tokens, so the tokenizer blocks on its first send
+	lines <- "key: value"
+	cancel()
+
+	if err := <-errc; err != context.Canceled {
+		t.Errorf("Expected %v, got %v", context.Canceled, err)
+	}
+	if _, ok := <-tokens; ok {
+		t.Error("Expected tokens channel to be closed")
+	}
+}
+
+func TestTokenizeContextCancelledWhileWaitingForLines(t *testing.T) {
+	defer leaktest.Check(t)()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	lines := make(chan string)
+	tokens := make(chan Token)
+
+	errc := TokenizeContext(ctx, lines, tokens)
+	cancel()
+
+	if err := <-errc; err != context.Canceled {
+		t.Errorf("Expected %v, got %v", context.Canceled, err)
+	}
+}
+
+func TestTokenizeContextNoError(t *testing.T) {
+	defer leaktest.Check(t)()
+
+	lines := make(chan string)
+	tokens := make(chan Token)
+
+	errc := TokenizeContext(context.Background(), lines, tokens)
+	close(lines)
+
+	if _, ok := <-tokens; ok {
+		t.Error("Expected tokens channel to be closed")
+	}
+	if err := <-errc; err != nil {
+		t.Errorf("Expected no error, got %v", err)
+	}
+}
+
 func failIfUnexpected(t *testing.T, expected []kindAndContent, tokens <-chan Token, done chan<- bool) {
 	go func() {
 		actual := []kindAndContent{}
@@ -0,0 +1,333 @@
+// Package yamltojson converts YAML documents to JSON. It wires the tokenizer,
+// the parser and the JSON renderer into a single streaming pipeline. The
+// pipeline can also read JSON and write YAML, to convert JSON to YAML or to
+// reformat either of them.
+package yamltojson
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"hbibel/yaml-to-json/common"
+	"hbibel/yaml-to-json/json"
+	"hbibel/yaml-to-json/yaml"
+	"hbibel/yaml-to-json/yamlwriter"
+	"io"
+)
+
+// InputFormat is the format that Convert reads.
+type InputFormat int
+
+const (
+	YAMLInput InputFormat = iota
+	JSONInput
+)
+
+func (f InputFormat) String() string {
+	switch f {
+	case YAMLInput:
+		return "yaml"
+	case JSONInput:
+		return "json"
+	}
+	return fmt.Sprintf("InputFormat(%d)", int(f))
+}
+
+// OutputFormat is the format that Convert writes.
+type OutputFormat int
+
+const (
+	JSONOutput OutputFormat = iota
+	YAMLOutput
+	// JSONCOutput is JSON with the comments of the YAML input, and
+	// JSON5Output additionally has unquoted keys and trailing commas.
+	JSONCOutput
+	JSON5Output
+)
+
+func (f OutputFormat) String() string {
+	switch f {
+	case JSONOutput:
+		return "json"
+	case YAMLOutput:
+		return "yaml"
+	case JSONCOutput:
+		return "jsonc"
+	case JSON5Output:
+		return "json5"
+	}
+	return fmt.Sprintf("OutputFormat(%d)", int(f))
+}
+
+// Options hold all settings of a conversion. The zero value converts a single
+// document with the core schema to compact JSON.
+type Options struct {
+	// Input and Output are the formats of the conversion. By default, YAML
+	// is converted to JSON.
+	Input  InputFormat
+	Output OutputFormat
+	// Schema determines how plain scalars are resolved to JSON types.
+	Schema yaml.Schema
+	// Indent is repeated once per nesting level to pretty-print the output.
+	// If it is empty, compact JSON is written. YAML output is always
+	// indented, by the length of Indent or by two spaces if it is empty.
+	Indent string
+	// NDJSON writes JSON output as newline-delimited JSON, see
+	// json.RenderOptions. Each line is written to w as soon as it is
+	// complete, and w is flushed after each line if it has a Flush method,
+	// like a bufio.Writer. Unless MultiDocument is set, the documents of a
+	// stream are written one after another, and the elements of those that
+	// are sequences on lines of their own.
+	NDJSON bool
+	// Canonical writes JSON in the canonical form of RFC 8785 for signing
+	// and hashing, see json.RenderOptions. Indent is ignored.
+	// MaxBufferBytes limits the memory for the mappings that are held back
+	// to sort their keys, or for yaml.DuplicateKeyLastWins, zero means
+	// unlimited. Exceeding it fails with common.ErrBufferLimit in both
+	// cases.
+	Canonical      bool
+	MaxBufferBytes int
+	// MultiDocument determines how streams with several documents, or JSON
+	// input with several values, are converted.
+	MultiDocument yaml.MultiDocumentMode
+	// DuplicateKeys determines how mappings with duplicate keys, or objects
+	// in JSON input, are converted. By default, they are an error.
+	DuplicateKeys yaml.DuplicateKeyPolicy
+	// BatchSize is the number of tokens and events that are passed between
+	// the pipeline stages at once. If it is zero, yaml.DefaultBatchSize is
+	// used.
+	BatchSize int
+	// MaxLineLength is the maximum number of bytes per input line. If it is
+	// zero, lines are only limited by the available memory.
+	MaxLineLength int
+	// MaxInputBytes is the maximum size of the input. The other limits are
+	// described at yaml.ParseOptions. Zero means unlimited, except for
+	// MaxAliasExpansions, which defaults to yaml.DefaultMaxAliasExpansions.
+	MaxInputBytes      int
+	MaxDepth           int
+	MaxScalarLength    int
+	MaxEvents          int
+	MaxAliasExpansions int
+	// Warn is called for problems that don't stop the conversion, like an
+	// unknown directive. If it is nil, warnings are dropped.
+	Warn func(error)
+}
+
+func (o Options) tokenizeOptions() yaml.TokenizeOptions {
+	return yaml.TokenizeOptions{
+		BatchSize:     o.BatchSize,
+		MaxLineLength: o.MaxLineLength,
+		MaxInputBytes: o.MaxInputBytes,
+	}
+}
+
+func (o Options) parseOptions() yaml.ParseOptions {
+	return yaml.ParseOptions{
+		Schema:             o.Schema,
+		MultiDocument:      o.multiDocument(),
+		DuplicateKeys:      o.DuplicateKeys,
+		BatchSize:          o.BatchSize,
+		FlushElements:      o.NDJSON,
+		MaxDepth:           o.MaxDepth,
+		MaxScalarLength:    o.MaxScalarLength,
+		MaxEvents:          o.MaxEvents,
+		MaxAliasExpansions: o.MaxAliasExpansions,
+		MaxBufferBytes:     o.MaxBufferBytes,
+		Warn:               o.Warn,
+		Comments:           o.Output == JSONCOutput || o.Output == JSON5Output,
+	}
+}
+
+// multiDocument returns the multi-document mode of the input stage. NDJSON
+// writes each document as a line of its own, unless they are wrapped in an
+// array or only the first one is wanted.
+func (o Options) multiDocument() yaml.MultiDocumentMode {
+	if o.NDJSON && o.MultiDocument == yaml.SingleDocument {
+		return yaml.DocumentStream
+	}
+	return o.MultiDocument
+}
+
+func (o Options) readOptions() json.ReadOptions {
+	return json.ReadOptions{
+		MultiDocument:   o.multiDocument(),
+		BatchSize:       o.BatchSize,
+		MaxInputBytes:   o.MaxInputBytes,
+		MaxDepth:        o.MaxDepth,
+		MaxScalarLength: o.MaxScalarLength,
+		DuplicateKeys:   o.DuplicateKeys,
+		MaxBufferBytes:  o.MaxBufferBytes,
+		Warn:            o.Warn,
+	}
+}
+
+func (o Options) renderOptions() json.RenderOptions {
+	return json.RenderOptions{
+		Indent:         o.Indent,
+		NDJSON:         o.NDJSON,
+		Canonical:      o.Canonical,
+		MaxBufferBytes: o.MaxBufferBytes,
+		Comments:       o.Output == JSONCOutput || o.Output == JSON5Output,
+		JSON5:          o.Output == JSON5Output,
+	}
+}
+
+func (o Options) yamlRenderOptions() yamlwriter.RenderOptions {
+	return yamlwriter.RenderOptions{
+		Indent: len(o.Indent),
+		// the output must be read back by the parser, which doesn't read
+		// block scalars
+		QuoteMultiLine: true,
+	}
+}
+
+func (o Options) checkFormats() error {
+	if o.Input != YAMLInput && o.Input != JSONInput {
+		return fmt.Errorf("unknown input format %v", o.Input)
+	}
+	if o.Output < JSONOutput || o.Output > JSON5Output {
+		return fmt.Errorf("unknown output format %v", o.Output)
+	}
+	if o.NDJSON && o.Output != JSONOutput {
+		return fmt.Errorf("NDJSON requires JSON output, not %v", o.Output)
+	}
+	if o.MultiDocument == yaml.DocumentStream && !o.NDJSON {
+		return fmt.Errorf("the %v multi-document mode requires NDJSON", o.MultiDocument)
+	}
+	if o.Canonical && o.Output != JSONOutput {
+		return fmt.Errorf("canonical output requires JSON output, not %v", o.Output)
+	}
+	return nil
+}
+
+// events starts the stages of the pipeline that turn the input into events.
+func (o Options) events(ctx context.Context, r io.Reader) (<-chan []common.Event, []<-chan error) {
+	if o.Input == JSONInput {
+		events, readErrs := json.ReadEventBatches(ctx, r, o.readOptions())
+		return events, []<-chan error{readErrs}
+	}
+	tokens, tokenizeErrs := yaml.TokenizeBatches(ctx, r, o.tokenizeOptions())
+	events, parseErrs := yaml.TokenBatchesToEvents(ctx, tokens, o.parseOptions())
+	return events, []<-chan error{tokenizeErrs, parseErrs}
+}
+
+// render starts the stage of the pipeline that writes the output.
+func (o Options) render(ctx context.Context, events <-chan []common.Event) (<-chan []byte, <-chan error) {
+	if o.Output == YAMLOutput {
+		return yamlwriter.RenderEventBatches(ctx, events, o.yamlRenderOptions())
+	}
+	return json.RenderEventBatches(ctx, events, o.renderOptions())
+}
+
+// Convert reads YAML from r and writes the equivalent JSON to w, or converts
+// between the formats that opts select. The input may be encoded in UTF-8,
+// UTF-16 or UTF-32 and use any kind of line breaks, the output is always
+// UTF-8. It returns the first error of any pipeline stage, or ctx.Err() if
+// ctx is cancelled before the conversion is complete. In case of an error, w
+// may contain incomplete output.
+//
+// Once ctx is done, Convert returns without waiting for a call of r.Read that
+// blocks, like on a stalled network connection. The goroutine that reads r
+// exits when that call returns, so callers should close r, or otherwise make
+// Read return, to release it.
+func Convert(ctx context.Context, r io.Reader, w io.Writer, opts Options) error {
+	if err := opts.checkFormats(); err != nil {
+		return err
+	}
+	if f, ok := w.(flusher); ok && opts.NDJSON {
+		w = flushingWriter{f}
+	}
+	return run(ctx, w, func(ctx context.Context) (<-chan []byte, []<-chan error) {
+		events, stageErrs := opts.events(ctx, yaml.NewUTF8Reader(r))
+		chunks, renderErrs := opts.render(ctx, events)
+		return chunks, append(stageErrs, renderErrs)
+	})
+}
+
+// run starts the stages of a pipeline with start and writes the output of its
+// last stage to w. It returns the first error of any stage, or the error of
+// ctx as soon as it is done, without waiting for a stage that is blocked
+// outside of the pipeline, like in a Read of the input.
+func run(ctx context.Context, w io.Writer, start func(ctx context.Context) (<-chan []byte, []<-chan error)) error {
+	parent := ctx
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	chunks, stageErrs := start(ctx)
+
+	// The first error of any stage cancels the whole pipeline, which makes
+	// the other stages report context.Canceled.
+	errs := make(chan error, len(stageErrs))
+	for _, errc := range stageErrs {
+		go func(errc <-chan error) {
+			err := <-errc
+			if err != nil {
+				cancel()
+			}
+			errs <- err
+		}(errc)
+	}
+
+	writeErr := writeChunks(w, chunks)
+	if writeErr != nil {
+		cancel()
+		// drain the renderer so that it notices the cancellation
+		for range chunks {
+		}
+	}
+
+	var firstErr error = writeErr
+	for range stageErrs {
+		var err error
+		select {
+		case err = <-errs:
+		case <-parent.Done():
+			return parent.Err()
+		}
+		if firstErr == nil && err != nil && err != context.Canceled {
+			firstErr = err
+		}
+	}
+	if parent.Err() != nil {
+		return parent.Err()
+	}
+	return firstErr
+}
+
+// ConvertBytes is like Convert, but operates on byte slices.
+func ConvertBytes(ctx context.Context, data []byte, opts Options) ([]byte, error) {
+	var out bytes.Buffer
+	err := Convert(ctx, bytes.NewReader(data), &out, opts)
+	if err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+type flusher interface {
+	io.Writer
+	Flush() error
+}
+
+// flushingWriter flushes after every write, so that each line of NDJSON
+// reaches the reader without waiting for a buffer to fill up.
+type flushingWriter struct {
+	w flusher
+}
+
+func (f flushingWriter) Write(p []byte) (int, error) {
+	n, err := f.w.Write(p)
+	if err == nil {
+		err = f.w.Flush()
+	}
+	return n, err
+}
+
+func writeChunks(w io.Writer, chunks <-chan []byte) error {
+	for chunk := range chunks {
+		if _, err := w.Write(chunk); err != nil {
+			return err
+		}
+	}
+	return nil
+}
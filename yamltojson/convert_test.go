@@ -0,0 +1,544 @@
+package yamltojson
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"hbibel/yaml-to-json/common"
+	"hbibel/yaml-to-json/internal/leaktest"
+	"hbibel/yaml-to-json/json"
+	"hbibel/yaml-to-json/yaml"
+	"io"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf16"
+)
+
+func TestConvertBytesMapping(t *testing.T) {
+	runTest(t, "key: value\n", Options{}, `{"key":"value"}`)
+}
+
+func TestConvertBytesIndent(t *testing.T) {
+	input := "data:\n  - 1\n"
+	expected := "{\n  \"data\": [\n    1\n  ]\n}"
+	runTest(t, input, Options{Indent: "  "}, expected)
+}
+
+func TestConvertBytesSchema(t *testing.T) {
+	runTest(t, "0x1F\n", Options{Schema: yaml.CoreSchema}, `31`)
+	runTest(t, "0x1F\n", Options{Schema: yaml.JSONSchema}, `"0x1F"`)
+	runTest(t, "42\n", Options{Schema: yaml.FailsafeSchema}, `"42"`)
+}
+
+func TestConvertBytesDirectives(t *testing.T) {
+	input := "%YAML 1.1\n%TAG !e! tag:yaml.org,2002:\n---\nport: !e!str 8080\nenabled: yes\n"
+	runTest(t, input, Options{}, `{"port":"8080","enabled":true}`)
+
+	var warnings []error
+	opts := Options{Warn: func(err error) { warnings = append(warnings, err) }}
+	runTest(t, "%YAML 1.4\n--- yes\n", opts, `"yes"`)
+	if len(warnings) != 1 {
+		t.Error("Expected one warning, got", warnings)
+	}
+}
+
+func TestConvertBytesDuplicateKeys(t *testing.T) {
+	input := "a: 1\nb: 2\na: 3\n"
+	runTest(t, input, Options{DuplicateKeys: yaml.DuplicateKeyLastWins}, `{"b":2,"a":3}`)
+	runTest(t, input, Options{DuplicateKeys: yaml.DuplicateKeyFirstWins}, `{"a":1,"b":2}`)
+	runTest(t, input, Options{DuplicateKeys: yaml.DuplicateKeyWarn}, `{"a":1,"b":2}`)
+
+	_, err := ConvertBytes(context.Background(), []byte(input), Options{})
+	var syntaxErr *yaml.SyntaxError
+	if !errors.As(err, &syntaxErr) || syntaxErr.Line != 3 {
+		t.Error("Expected a SyntaxError in line 3, got", err)
+	}
+}
+
+func TestConvertBytesDuplicateKeysInAliases(t *testing.T) {
+	// an alias repeats the anchored node as it is passed on, without the
+	// entries that the policy drops
+	input := "a: &x\n  k: 1\n  k: 2\nb: *x\nc:\n- &y\n  m: 1\n  n: *x\n  m: 3\n- *y\n"
+	runTest(t, input, Options{DuplicateKeys: yaml.DuplicateKeyLastWins},
+		`{"a":{"k":2},"b":{"k":2},"c":[{"n":{"k":2},"m":3},{"n":{"k":2},"m":3}]}`)
+	runTest(t, input, Options{DuplicateKeys: yaml.DuplicateKeyFirstWins},
+		`{"a":{"k":1},"b":{"k":1},"c":[{"m":1,"n":{"k":1}},{"m":1,"n":{"k":1}}]}`)
+	// an anchor within a skipped entry still refers to its whole node
+	runTest(t, "a: 1\na:\n  b: &z\n  - 2\nc: *z\n", Options{DuplicateKeys: yaml.DuplicateKeyFirstWins},
+		`{"a":1,"c":[2]}`)
+}
+
+func TestConvertBytesAliases(t *testing.T) {
+	input := "defaults: &defaults\n  retries: 3\nservice:\n  config: *defaults\n"
+	runTest(t, input, Options{}, `{"defaults":{"retries":3},"service":{"config":{"retries":3}}}`)
+}
+
+func TestConvertBytesLimits(t *testing.T) {
+	cases := []struct {
+		opts     Options
+		expected error
+	}{
+		{Options{MaxInputBytes: 10}, yaml.ErrInputTooLarge},
+		{Options{MaxDepth: 1}, yaml.ErrNestingTooDeep},
+		{Options{MaxScalarLength: 3}, yaml.ErrScalarTooLong},
+		{Options{MaxEvents: 10}, yaml.ErrTooManyEvents},
+		{Options{MaxAliasExpansions: 2}, yaml.ErrTooManyAliasExpansions},
+		{Options{DuplicateKeys: yaml.DuplicateKeyLastWins, MaxBufferBytes: 10}, common.ErrBufferLimit},
+	}
+	input := "a: &a\n  bbbb: 1\nc: *a\n"
+	for _, c := range cases {
+		_, err := ConvertBytes(context.Background(), []byte(input), c.opts)
+		if !errors.Is(err, c.expected) {
+			t.Errorf("%+v: expected %v, got %v", c.opts, c.expected, err)
+		}
+	}
+}
+
+func TestConvertBytesDefaultAliasLimit(t *testing.T) {
+	var bomb strings.Builder
+	bomb.WriteString("a0: &a0\n- x\n- x\n")
+	for i := 1; i <= 40; i++ {
+		fmt.Fprintf(&bomb, "a%d: &a%d\n- *a%d\n- *a%d\n", i, i, i-1, i-1)
+	}
+	_, err := ConvertBytes(context.Background(), []byte(bomb.String()), Options{})
+	if !errors.Is(err, yaml.ErrTooManyAliasExpansions) {
+		t.Errorf("expected %v, got %v", yaml.ErrTooManyAliasExpansions, err)
+	}
+	// a negative limit is unlimited
+	runTest(t, "a: &a\n- x\nb: *a\n", Options{MaxAliasExpansions: -1}, `{"a":["x"],"b":["x"]}`)
+}
+
+func TestConvertBytesDocumentArray(t *testing.T) {
+	input := "--- 1\n--- 2\n"
+	runTest(t, input, Options{MultiDocument: yaml.DocumentArray}, `[1,2]`)
+}
+
+func TestConvertBytesFirstDocument(t *testing.T) {
+	input := "--- 1\n--- 2\n"
+	runTest(t, input, Options{MultiDocument: yaml.FirstDocument}, `1`)
+}
+
+func TestConvertBytesMultipleDocumentsError(t *testing.T) {
+	defer leaktest.Check(t)()
+
+	_, err := ConvertBytes(context.Background(), []byte("--- 1\n--- 2\n"), Options{})
+	if err == nil {
+		t.Error("Expected an error")
+	}
+}
+
+func TestConvertBytesParseError(t *testing.T) {
+	defer leaktest.Check(t)()
+
+	_, err := ConvertBytes(context.Background(), []byte(":\nkey: value\n"), Options{})
+	if err == nil {
+		t.Error("Expected an error")
+	}
+}
+
+func TestConvertBytesNoTrailingNewline(t *testing.T) {
+	runTest(t, "key: value", Options{}, `{"key":"value"}`)
+}
+
+func TestConvertBytesLongLine(t *testing.T) {
+	long := strings.Repeat("x", 1<<20)
+	runTest(t, "key: "+long+"\n", Options{}, `{"key":"`+long+`"}`)
+}
+
+func TestConvertBytesLineTooLong(t *testing.T) {
+	defer leaktest.Check(t)()
+
+	input := "key: value\nkey: " + strings.Repeat("x", 100) + "\n"
+	_, err := ConvertBytes(context.Background(), []byte(input), Options{MaxLineLength: 100})
+	if !errors.Is(err, yaml.ErrLineTooLong) {
+		t.Errorf("Expected %v, got %v", yaml.ErrLineTooLong, err)
+	}
+	if err == nil || !strings.Contains(err.Error(), "line 2") {
+		t.Errorf("Expected the error to mention line 2, got %v", err)
+	}
+}
+
+type failingReader struct{}
+
+var errRead = errors.New("read failed")
+
+func (failingReader) Read(p []byte) (int, error) {
+	return 0, errRead
+}
+
+func TestConvertReadError(t *testing.T) {
+	defer leaktest.Check(t)()
+
+	reader := io.MultiReader(strings.NewReader("key: value\n"), failingReader{})
+	err := Convert(context.Background(), reader, io.Discard, Options{})
+	if err != errRead {
+		t.Errorf("Expected %v, got %v", errRead, err)
+	}
+}
+
+func TestConvertBytesPlatformIndependent(t *testing.T) {
+	for _, c := range []struct {
+		lf       string
+		expected string
+	}{
+		{"list:\n  - välue\n  - b\n", `{"list":["välue","b"]}`},
+		{"key: välue\nlist:\n  - a\n  - b\n", `{"key":"välue","list":["a","b"]}`},
+	} {
+		crlf := strings.ReplaceAll(c.lf, "\n", "\r\n")
+		cr := strings.ReplaceAll(c.lf, "\n", "\r")
+
+		utf16le := []byte{0xFF, 0xFE}
+		for _, unit := range utf16.Encode([]rune(crlf)) {
+			utf16le = append(utf16le, byte(unit), byte(unit>>8))
+		}
+
+		for _, input := range [][]byte{
+			[]byte(c.lf),
+			[]byte(crlf),
+			[]byte(cr),
+			[]byte("\xEF\xBB\xBF" + crlf),
+			utf16le,
+		} {
+			output, err := ConvertBytes(context.Background(), input, Options{})
+			if err != nil {
+				t.Fatalf("%q: unexpected error: %v", input, err)
+			}
+			if string(output) != c.expected {
+				t.Errorf("%q: expected %s, got %s", input, c.expected, output)
+			}
+		}
+	}
+}
+
+func TestConvertBytesMultiLineScalars(t *testing.T) {
+	input := "description: A long description\n  of the endpoint.\n\n  Second paragraph.\nsummary: \"quoted \\\"text\\\"\n  continued\"\n"
+	expected := `{"description":"A long description of the endpoint.\nSecond paragraph.","summary":"quoted \"text\" continued"}`
+	runTest(t, input, Options{}, expected)
+}
+
+func TestConvertBytesImplicitNulls(t *testing.T) {
+	input := "a:\nb:\n  - \n  -\nc: ~\n"
+	runTest(t, input, Options{}, `{"a":null,"b":[null,null],"c":null}`)
+}
+
+func TestConvertBytesEmptyInput(t *testing.T) {
+	// a stream without documents has no JSON representation
+	runTest(t, "", Options{}, ``)
+	runTest(t, "\n\n", Options{}, ``)
+	runTest(t, "", Options{MultiDocument: yaml.DocumentArray}, `[]`)
+	// an explicit but empty document is null
+	runTest(t, "---\n", Options{}, `null`)
+}
+
+func TestConvertCancelled(t *testing.T) {
+	defer leaktest.Check(t)()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	input := strings.Repeat("- item\n", 1000)
+	err := Convert(ctx, strings.NewReader(input), &strings.Builder{}, Options{})
+	if err != context.Canceled {
+		t.Errorf("Expected %v, got %v", context.Canceled, err)
+	}
+}
+
+// stalledReader returns its input and then blocks until it is closed, like a
+// network connection whose peer stopped sending.
+type stalledReader struct {
+	input  io.Reader
+	closed chan struct{}
+}
+
+func (s *stalledReader) Read(p []byte) (int, error) {
+	if n, err := s.input.Read(p); err != io.EOF {
+		return n, err
+	}
+	<-s.closed
+	return 0, io.ErrClosedPipe
+}
+
+func TestConvertCancelledWhileReading(t *testing.T) {
+	defer leaktest.Check(t)()
+
+	r := &stalledReader{input: strings.NewReader("- a: 1\n"), closed: make(chan struct{})}
+	defer close(r.closed)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- Convert(ctx, r, io.Discard, Options{})
+	}()
+	select {
+	case err := <-done:
+		if err != context.DeadlineExceeded {
+			t.Errorf("Expected %v, got %v", context.DeadlineExceeded, err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Convert didn't return after the deadline while Read blocked")
+	}
+}
+
+type failingWriter struct{}
+
+var errWrite = errors.New("write failed")
+
+func (failingWriter) Write(p []byte) (int, error) {
+	return 0, errWrite
+}
+
+func TestConvertWriteError(t *testing.T) {
+	defer leaktest.Check(t)()
+
+	// large enough to produce several chunks
+	input := strings.Repeat("- item\n", 10000)
+	err := Convert(context.Background(), strings.NewReader(input), failingWriter{}, Options{})
+	if err != errWrite {
+		t.Errorf("Expected %v, got %v", errWrite, err)
+	}
+}
+
+func TestConvertBytesBatchSizes(t *testing.T) {
+	for _, c := range []struct {
+		input    string
+		expected string
+	}{
+		{"a:\n  - 1\n  - b\n  - c\n", `{"a":[1,"b","c"]}`},
+		{"- a: 1\n- b: 2\n- c\n", `[{"a":1},{"b":2},"c"]`},
+	} {
+		for _, batchSize := range []int{1, 2, 3, 1000} {
+			runTest(t, c.input, Options{BatchSize: batchSize}, c.expected)
+		}
+	}
+}
+
+func TestConvertBytesNDJSON(t *testing.T) {
+	input := "- a: 1\n  b: x\n- 2\n- c:\n    - d\n"
+	expected := "{\"a\":1,\"b\":\"x\"}\n2\n{\"c\":[\"d\"]}\n"
+	runTest(t, input, Options{NDJSON: true, Indent: "  "}, expected)
+	runTest(t, "---\na: 1\n---\n- 2\n- 3\n", Options{NDJSON: true, MultiDocument: yaml.DocumentArray}, "{\"a\":1}\n[2,3]\n")
+	// without a multi-document mode, each document is written on its own
+	runTest(t, "---\na: 1\n---\n- 2\n- 3\n---\nx\n", Options{NDJSON: true}, "{\"a\":1}\n2\n3\n\"x\"\n")
+	runTest(t, "{\"a\":1}\n{\"a\":2}\n", Options{Input: JSONInput, NDJSON: true}, "{\"a\":1}\n{\"a\":2}\n")
+	runTest(t, "1\n\"x\"\n", Options{Input: JSONInput, NDJSON: true, MultiDocument: yaml.DocumentArray}, "1\n\"x\"\n")
+
+	_, err := ConvertBytes(context.Background(), []byte("a: 1\n"), Options{NDJSON: true, Output: YAMLOutput})
+	if err == nil {
+		t.Error("Expected an error for NDJSON with YAML output")
+	}
+	_, err = ConvertBytes(context.Background(), []byte("a: 1\n"), Options{MultiDocument: yaml.DocumentStream})
+	if err == nil {
+		t.Error("Expected an error for a document stream without NDJSON")
+	}
+}
+
+func TestConvertBytesCanonical(t *testing.T) {
+	input := "b: 2.50\na:\n  z: 1e21\n  y: \"\\u20ac\"\n"
+	runTest(t, input, Options{Canonical: true, Indent: "  "}, `{"a":{"y":"€","z":1e+21},"b":2.5}`)
+	runTest(t, `{"b":[{"d":1,"c":2}],"a":0.10}`, Options{Input: JSONInput, Canonical: true}, `{"a":0.1,"b":[{"c":2,"d":1}]}`)
+
+	_, err := ConvertBytes(context.Background(), []byte("a:\n  b: 1\n"), Options{Canonical: true, MaxBufferBytes: 3})
+	if !errors.Is(err, common.ErrBufferLimit) {
+		t.Errorf("Expected %v, got %v", common.ErrBufferLimit, err)
+	}
+}
+
+func TestConvertBytesJSONC(t *testing.T) {
+	input := "# settings\nname: app # the name\n\n# the ports\nports:\n  - 80\n"
+	expected := "// settings\n{\n  \"name\": \"app\", // the name\n\n  // the ports\n  \"ports\": [\n    80\n  ]\n}"
+	runTest(t, input, Options{Output: JSONCOutput, Indent: "  "}, expected)
+	runTest(t, input, Options{Output: JSONCOutput}, `/* settings */{"name":"app"/* the name */,/* the ports */"ports":[80]}`)
+
+	expected = "// settings\n{\n  name: \"app\", // the name\n\n  // the ports\n  ports: [\n    80,\n  ],\n}"
+	runTest(t, input, Options{Output: JSON5Output, Indent: "  "}, expected)
+	// plain JSON drops the comments
+	runTest(t, input, Options{}, `{"name":"app","ports":[80]}`)
+}
+
+type countingFlusher struct {
+	strings.Builder
+	flushes int
+}
+
+func (f *countingFlusher) Flush() error {
+	f.flushes++
+	return nil
+}
+
+func TestConvertNDJSONFlushesLines(t *testing.T) {
+	var w countingFlusher
+	input := strings.Repeat("- a: 1\n", 3)
+	if err := Convert(context.Background(), strings.NewReader(input), &w, Options{NDJSON: true, BatchSize: 1000}); err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	if w.String() != strings.Repeat("{\"a\":1}\n", 3) || w.flushes != 3 {
+		t.Errorf("Expected 3 lines with a flush each, got %q with %d flushes", w.String(), w.flushes)
+	}
+}
+
+// lineWriter sends each write on a channel.
+type lineWriter chan string
+
+func (w lineWriter) Write(p []byte) (int, error) {
+	w <- string(p)
+	return len(p), nil
+}
+
+func TestConvertNDJSONSlowInput(t *testing.T) {
+	defer leaktest.Check(t)()
+
+	for _, c := range []struct {
+		opts  Options
+		lines []string
+	}{
+		// a YAML sequence element is complete when the next one starts
+		{Options{NDJSON: true}, []string{"- a: 1\n", "- a: 2\n"}},
+		{Options{Input: JSONInput, NDJSON: true, MultiDocument: yaml.DocumentArray}, []string{"{\"a\": 1}\n", "{\"a\": 2}\n"}},
+	} {
+		r, pw := io.Pipe()
+		w := make(lineWriter, 10)
+		done := make(chan error, 1)
+		go func() {
+			done <- Convert(context.Background(), r, w, c.opts)
+		}()
+
+		// the first line must be written while the input is still open
+		for _, line := range c.lines {
+			pw.Write([]byte(line))
+		}
+		select {
+		case line := <-w:
+			if line != "{\"a\":1}\n" {
+				t.Errorf("%+v: unexpected first line %q", c.opts, line)
+			}
+		case <-time.After(time.Second):
+			t.Errorf("%+v: the first line wasn't written before the end of the input", c.opts)
+		}
+
+		pw.Close()
+		if err := <-done; err != nil {
+			t.Error("Unexpected error:", err)
+		}
+	}
+}
+
+func TestConvertBytesJSONToYAML(t *testing.T) {
+	input := `{"data": [{"name": "John", "tags": ["a", "yes"]}], "empty": {}, "text": "a\nb"}`
+	expected := "data:\n  - name: John\n    tags:\n      - a\n      - \"yes\"\nempty: {}\ntext: \"a\\nb\"\n"
+	runTest(t, input, Options{Input: JSONInput, Output: YAMLOutput}, expected)
+}
+
+func TestConvertBytesJSONDuplicateKeys(t *testing.T) {
+	input := `{"a":1,"b":{"c":[2],"c":3},"a":{"d":4}}`
+	runTest(t, input, Options{Input: JSONInput, DuplicateKeys: yaml.DuplicateKeyLastWins}, `{"b":{"c":3},"a":{"d":4}}`)
+	runTest(t, input, Options{Input: JSONInput, DuplicateKeys: yaml.DuplicateKeyFirstWins}, `{"a":1,"b":{"c":[2]}}`)
+	runTest(t, input, Options{Input: JSONInput, Output: YAMLOutput, DuplicateKeys: yaml.DuplicateKeyFirstWins}, "a: 1\nb:\n  c:\n    - 2\n")
+
+	var warnings []error
+	opts := Options{Input: JSONInput, DuplicateKeys: yaml.DuplicateKeyWarn, Warn: func(err error) { warnings = append(warnings, err) }}
+	runTest(t, input, opts, `{"a":1,"b":{"c":[2]}}`)
+	if len(warnings) != 2 {
+		t.Error("Expected two warnings, got", warnings)
+	}
+
+	// by default, duplicates are an error, like in YAML input
+	_, err := ConvertBytes(context.Background(), []byte(`{"a":1,"a":2}`), Options{Input: JSONInput, Output: YAMLOutput})
+	var syntaxErr *json.SyntaxError
+	if !errors.As(err, &syntaxErr) || syntaxErr.Column != 8 {
+		t.Error("Expected a SyntaxError in column 8, got", err)
+	}
+	_, err = ConvertBytes(context.Background(), []byte(input), Options{Input: JSONInput, DuplicateKeys: yaml.DuplicateKeyLastWins, MaxBufferBytes: 8})
+	if !errors.Is(err, common.ErrBufferLimit) {
+		t.Errorf("Expected %v, got %v", common.ErrBufferLimit, err)
+	}
+}
+
+func TestConvertBytesJSONRoundTrip(t *testing.T) {
+	inputs := []string{
+		`{"a":[],"b":{},"c":[[],{}]}`,
+		`{"text":"a\nb","trailing":"a\n","kept":"a\n\n","indented":" a\n b"}`,
+		`["[1, 2]","{}","| x","> y","- z"]`,
+		`[]`,
+		`{}`,
+	}
+	for _, input := range inputs {
+		output, err := ConvertBytes(context.Background(), []byte(input), Options{Input: JSONInput, Output: YAMLOutput})
+		if err != nil {
+			t.Fatal("Unexpected error:", err)
+		}
+		runTest(t, string(output), Options{}, input)
+	}
+}
+
+func TestConvertBytesReformatJSON(t *testing.T) {
+	input := "{\"a\": [1,\n 2.50], \"b\": \"\\u00e4\"}\n"
+	runTest(t, input, Options{Input: JSONInput}, `{"a":[1,2.50],"b":"ä"}`)
+	runTest(t, input, Options{Input: JSONInput, Indent: " "}, "{\n \"a\": [\n  1,\n  2.50\n ],\n \"b\": \"ä\"\n}")
+	runTest(t, "1\n2\n", Options{Input: JSONInput, MultiDocument: yaml.DocumentArray}, `[1,2]`)
+
+	_, err := ConvertBytes(context.Background(), []byte(`{"a" 1}`), Options{Input: JSONInput})
+	var syntaxErr *json.SyntaxError
+	if !errors.As(err, &syntaxErr) || syntaxErr.Column != 6 {
+		t.Error("Expected a SyntaxError in column 6, got", err)
+	}
+}
+
+func TestConvertBytesReformatYAML(t *testing.T) {
+	input := "a:   1\nb:\n- 'x'\n- \"yes\"\n"
+	expected := "a: 1\nb:\n    - x\n    - \"yes\"\n"
+	runTest(t, input, Options{Output: YAMLOutput, Indent: "    "}, expected)
+}
+
+func TestConvertUnknownFormat(t *testing.T) {
+	_, err := ConvertBytes(context.Background(), []byte("a"), Options{Output: OutputFormat(-1)})
+	if err == nil {
+		t.Error("Expected an error")
+	}
+}
+
+var benchmarkInput = func() []byte {
+	record := "- John Doe\n- 30\n- true\n- 'quoted'\n"
+	return []byte(strings.Repeat(record, 100000))
+}()
+
+func BenchmarkConvert(b *testing.B) {
+	b.SetBytes(int64(len(benchmarkInput)))
+	for i := 0; i < b.N; i++ {
+		err := Convert(context.Background(), bytes.NewReader(benchmarkInput), io.Discard, Options{})
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkConvertUnbatched runs the same conversion with one channel send per
+// token, event and JSON fragment.
+func BenchmarkConvertUnbatched(b *testing.B) {
+	b.SetBytes(int64(len(benchmarkInput)))
+	for i := 0; i < b.N; i++ {
+		ctx := context.Background()
+		tokens := make(chan yaml.Token)
+		yaml.TokenizeReader(ctx, bytes.NewReader(benchmarkInput), tokens)
+		events, _ := yaml.TokensToEventsContext(ctx, tokens)
+		chunks, _ := json.RenderEventsContext(ctx, events)
+		for chunk := range chunks {
+			io.WriteString(io.Discard, chunk)
+		}
+	}
+}
+
+func runTest(t *testing.T, input string, opts Options, expected string) {
+	t.Helper()
+	defer leaktest.Check(t)()
+
+	output, err := ConvertBytes(context.Background(), []byte(input), opts)
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	if string(output) != expected {
+		t.Errorf("Expected %s, got %s", expected, output)
+	}
+}
@@ -0,0 +1,55 @@
+package yamltojson
+
+import (
+	"bytes"
+	"context"
+	"hbibel/yaml-to-json/yaml"
+	"hbibel/yaml-to-json/yamlwriter"
+	"io"
+)
+
+// FormatOptions configure Format. The zero value indents by two spaces and
+// keeps the order of the keys.
+type FormatOptions struct {
+	// Indent is the number of spaces per nesting level, see
+	// yamlwriter.RenderOptions.
+	Indent int
+	// IndentlessSequences puts the dashes of a sequence that is a mapping
+	// value in the column of its key.
+	IndentlessSequences bool
+	// SortKeys sorts the entries of every mapping by key.
+	SortKeys bool
+}
+
+// Format reads YAML from r and writes it to w with a consistent layout:
+// uniform indentation, strings quoted only where needed and double quotes
+// otherwise. Comments and the empty lines between nodes are kept, as are the
+// tags, anchors and aliases. Directives are dropped, and the output is
+// written for the core schema: numbers, booleans and nulls keep their
+// spelling if the core schema reads it as the same value, like 0x1F or ~.
+// Otherwise they are rewritten, which happens with a %YAML 1.1 directive:
+// yes becomes true, 0755 becomes 493 and 1_000 becomes 1000.
+func Format(ctx context.Context, r io.Reader, w io.Writer, opts FormatOptions) error {
+	return run(ctx, w, func(ctx context.Context) (<-chan []byte, []<-chan error) {
+		tokens, tokenizeErrs := yaml.TokenizeBatches(ctx, yaml.NewUTF8Reader(r), yaml.TokenizeOptions{})
+		events, parseErrs := yaml.TokenBatchesToEvents(ctx, tokens, yaml.ParseOptions{Detailed: true, Comments: true})
+		chunks, renderErrs := yamlwriter.RenderEventBatches(ctx, events, yamlwriter.RenderOptions{
+			Indent:              opts.Indent,
+			IndentlessSequences: opts.IndentlessSequences,
+			// the parser can't read block scalars back
+			QuoteMultiLine: true,
+			SortKeys:       opts.SortKeys,
+		})
+		return chunks, []<-chan error{tokenizeErrs, parseErrs, renderErrs}
+	})
+}
+
+// FormatBytes is like Format, but operates on byte slices.
+func FormatBytes(ctx context.Context, data []byte, opts FormatOptions) ([]byte, error) {
+	var out bytes.Buffer
+	err := Format(ctx, bytes.NewReader(data), &out, opts)
+	if err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
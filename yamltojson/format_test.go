@@ -0,0 +1,114 @@
+package yamltojson
+
+import (
+	"context"
+	"errors"
+	"hbibel/yaml-to-json/yaml"
+	"strings"
+	"testing"
+)
+
+func TestFormat(t *testing.T) {
+	input := strings.Join([]string{
+		"# settings",
+		"",
+		"name:   'app'   # the name",
+		"ports:",
+		"    -  80",
+		"    -  0x1BB",
+		"",
+		"",
+		"# the labels",
+		"labels:",
+		"  app:    web",
+		"note: \"line\n\n  two\"",
+		"empty:",
+		"",
+	}, "\n")
+	expected := strings.Join([]string{
+		"# settings",
+		"",
+		"name: app # the name",
+		"ports:",
+		"  - 80",
+		"  - 0x1BB",
+		"",
+		"# the labels",
+		"labels:",
+		"  app: web",
+		"note: \"line\\ntwo\"",
+		"empty:",
+		"",
+	}, "\n")
+	runFormatTest(t, input, FormatOptions{}, expected)
+	// formatting is idempotent
+	runFormatTest(t, expected, FormatOptions{}, expected)
+}
+
+func TestFormatSequenceIndent(t *testing.T) {
+	input := "a:\n  - b:\n      - 1\n"
+	runFormatTest(t, input, FormatOptions{IndentlessSequences: true}, "a:\n- b:\n  - 1\n")
+	runFormatTest(t, input, FormatOptions{Indent: 4}, "a:\n    -   b:\n            - 1\n")
+}
+
+func TestFormatSortKeys(t *testing.T) {
+	// the comments before an entry move with it, the header of the file
+	// stays in place
+	input := "# header\nc: 3 # three\n\n# b\nb:\n  z: 1\n  x: 2\na: 1\n"
+	expected := "# header\na: 1\n\n# b\nb:\n  x: 2\n  z: 1\nc: 3 # three\n"
+	runFormatTest(t, input, FormatOptions{SortKeys: true}, expected)
+
+	// a comment after a collection value belongs to the next key
+	input = "z:\n  - 1\n\n# before a\na: 2\nm:\n  x: 1\n# before b\nb: 3\n"
+	expected = "# before a\na: 2\n# before b\nb: 3\nm:\n  x: 1\nz:\n  - 1\n"
+	runFormatTest(t, input, FormatOptions{SortKeys: true}, expected)
+}
+
+func TestFormatError(t *testing.T) {
+	_, err := FormatBytes(context.Background(), []byte("a: 1\na: 2\n"), FormatOptions{})
+	if err == nil {
+		t.Error("Expected an error for a duplicate key")
+	}
+}
+
+func TestFormatYAML11(t *testing.T) {
+	// the directive is dropped, so values are rewritten for the core schema
+	input := "%YAML 1.1\n---\na: yes\nb: 0755\nc: 1_000\nd: 0x1F\n"
+	runFormatTest(t, input, FormatOptions{}, "---\na: true\nb: 493\nc: 1000\nd: 0x1F\n")
+	// without it, the core schema reads the same text as strings
+	input = "a: yes\nb: 0755\nc: 1_000\nd: 0x1F\n"
+	runFormatTest(t, input, FormatOptions{}, "a: \"yes\"\nb: 0755\nc: \"1_000\"\nd: 0x1F\n")
+}
+
+func TestFormatEmptyFlowCollections(t *testing.T) {
+	input := "a: {}\nb: []\nc:\n  - []\n"
+	runFormatTest(t, input, FormatOptions{}, input)
+}
+
+func TestFormatUnsupportedSyntax(t *testing.T) {
+	// formatting these as strings would change the meaning of the document
+	inputs := []string{
+		"b: [1, 2]\n",
+		"a: {x: 1}\n",
+		"c: |\n  line1\n  line2\n",
+		"d: >-\n  folded text\n",
+	}
+	for _, input := range inputs {
+		_, err := FormatBytes(context.Background(), []byte(input), FormatOptions{})
+		var syntaxErr *yaml.SyntaxError
+		if !errors.As(err, &syntaxErr) {
+			t.Errorf("%q: expected a SyntaxError, got %v", input, err)
+		}
+	}
+}
+
+func runFormatTest(t *testing.T, input string, opts FormatOptions, expected string) {
+	t.Helper()
+	output, err := FormatBytes(context.Background(), []byte(input), opts)
+	if err != nil {
+		t.Fatalf("%q: unexpected error: %v", input, err)
+	}
+	if string(output) != expected {
+		t.Errorf("%q: expected %q, got %q", input, expected, string(output))
+	}
+}
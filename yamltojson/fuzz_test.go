@@ -0,0 +1,59 @@
+package yamltojson
+
+import (
+	"context"
+	"encoding/json"
+	"hbibel/yaml-to-json/yaml"
+	"testing"
+	"time"
+)
+
+// Run the fuzz target with
+//
+//	go test ./yamltojson -run '^$' -fuzz FuzzConvert
+//
+// Inputs that fail are written to testdata/fuzz, where they become part of
+// the seed corpus that every go test run checks.
+
+// FuzzConvert checks that the whole pipeline terminates without panicking,
+// and that it produces valid JSON whenever it succeeds. A stream without
+// documents is converted to no output at all.
+func FuzzConvert(f *testing.F) {
+	for _, seed := range []string{
+		"",
+		"key: value\n",
+		"- a\n- b: [c]\n",
+		"&a a: &b b\n*b : *a\n",
+		"--- 1\n--- {}\n",
+		"\"esc\\u00e9\\x41\\t\" : 'it''s'\n",
+		"%YAML 1.1\n---\nyes: 0o17\n",
+		"\xff\xfea\x00:\x00 \x001\x00",
+	} {
+		f.Add([]byte(seed), uint8(0))
+	}
+	f.Fuzz(func(t *testing.T, input []byte, variant uint8) {
+		opts := Options{
+			Schema:        yaml.Schema(variant % 4),
+			MultiDocument: yaml.MultiDocumentMode(variant / 4 % 3),
+			DuplicateKeys: yaml.DuplicateKeyPolicy(variant / 12 % 4),
+			BatchSize:     int(variant%5) + 1,
+			MaxEvents:     100000,
+		}
+		if variant%2 == 1 {
+			opts.Indent = "  "
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		output, err := ConvertBytes(ctx, input, opts)
+		if ctx.Err() != nil {
+			t.Fatalf("%+v: the conversion did not terminate", opts)
+		}
+		if err != nil {
+			return
+		}
+		if len(output) > 0 && !json.Valid(output) {
+			t.Fatalf("%+v: invalid JSON %q", opts, output)
+		}
+	})
+}
@@ -0,0 +1,196 @@
+package yamlwriter
+
+import (
+	"fmt"
+	"hbibel/yaml-to-json/common"
+	"sort"
+)
+
+// sorter holds back the events of each mapping until it ends, and then passes
+// them on with the entries sorted by key. The comments and empty lines before
+// an entry and the inline comments within it move with the entry.
+type sorter struct {
+	// the open mappings, innermost last
+	frames []*sortFrame
+	// the anchors that have been passed on, to find aliases that would come
+	// before their anchors after sorting
+	anchors map[string]bool
+}
+
+type sortFrame struct {
+	start   common.Event
+	entries []*sortEntry
+	// the comments and empty lines before the next entry
+	leading []common.Event
+	// the number of open sequences within the current entry
+	sequences int
+	// whether a key is next, otherwise the value of the current entry
+	expectKey bool
+}
+
+type sortEntry struct {
+	key string
+	// the column of the key, 0 if it is unknown
+	column int
+	events []common.Event
+}
+
+func (s *sorter) buffering() bool {
+	return len(s.frames) > 0
+}
+
+// add takes the next event and passes the events that are complete to emit.
+func (s *sorter) add(op common.Event, emit func(common.Event) error) error {
+	if op.GetKind() == common.START_MAPPING {
+		s.frames = append(s.frames, &sortFrame{start: op, expectKey: true})
+		return nil
+	}
+	if len(s.frames) == 0 {
+		if err := s.check(op); err != nil {
+			return err
+		}
+		return emit(op)
+	}
+
+	f := s.frames[len(s.frames)-1]
+	atKey := f.sequences == 0 && f.expectKey
+	switch op.GetKind() {
+	case common.END_MAPPING:
+		s.frames = s.frames[:len(s.frames)-1]
+		events := f.sorted(op)
+		if len(s.frames) > 0 {
+			parent := s.frames[len(s.frames)-1]
+			return parent.addValue(events...)
+		}
+		for _, event := range events {
+			if err := s.check(event); err != nil {
+				return err
+			}
+			if err := emit(event); err != nil {
+				return err
+			}
+		}
+		return nil
+	case common.EMIT_KEY, common.ALIAS:
+		if !atKey {
+			return f.addValue(op)
+		}
+		var key string
+		if alias, ok := op.(*common.AliasEvent); ok {
+			key = "*" + alias.Anchor
+		} else {
+			key = op.(common.HasPayload).GetPayload()
+		}
+		column := 0
+		if e, ok := op.(common.HasPosition); ok {
+			column = e.GetPosition().Column
+		}
+		f.entries = append(f.entries, &sortEntry{key: key, column: column, events: append(f.leading, op)})
+		f.leading = nil
+		f.expectKey = false
+		return nil
+	case common.COMMENT, common.BLANK_LINE:
+		inline := op.GetKind() == common.COMMENT && op.(*common.CommentEvent).Inline
+		if atKey && !inline || len(f.entries) == 0 {
+			f.leading = append(f.leading, op)
+			return nil
+		}
+		return f.add(op)
+	case common.START_ARRAY:
+		f.sequences++
+		return f.add(op)
+	case common.END_ARRAY:
+		if f.sequences == 0 {
+			return fmt.Errorf("unexpected event %v", op)
+		}
+		f.sequences--
+		return f.addValue(op)
+	case common.EMIT_VALUE:
+		return f.addValue(op)
+	}
+	return f.add(op)
+}
+
+// add appends an event to the current entry.
+func (f *sortFrame) add(op common.Event) error {
+	if len(f.entries) == 0 {
+		return fmt.Errorf("unexpected event %v", op)
+	}
+	current := f.entries[len(f.entries)-1]
+	current.events = append(current.events, op)
+	return nil
+}
+
+// addValue appends the events of a node to the current entry, which is
+// complete unless the node is within a sequence.
+func (f *sortFrame) addValue(events ...common.Event) error {
+	for _, event := range events {
+		if err := f.add(event); err != nil {
+			return err
+		}
+	}
+	if f.sequences == 0 {
+		f.expectKey = true
+		f.leading = f.entries[len(f.entries)-1].takeTrailingNotes()
+	}
+	return nil
+}
+
+// takeTrailingNotes removes the comments and empty lines at the end of a
+// collection value that belong to the next key, and returns them. The parser
+// reports them before the end of the collection, but a comment that isn't
+// indented more than the key is at the level of the mapping.
+func (e *sortEntry) takeTrailingNotes() []common.Event {
+	start := len(e.events)
+	for i := len(e.events) - 1; i > 0; i-- {
+		op := e.events[i]
+		kind := op.GetKind()
+		if kind == common.END_ARRAY || kind == common.END_MAPPING {
+			continue
+		}
+		if kind == common.COMMENT {
+			comment := op.(*common.CommentEvent)
+			if comment.Inline || comment.Position.Column > e.column {
+				break
+			}
+		} else if kind != common.BLANK_LINE {
+			break
+		}
+		start = i
+	}
+	var notes, rest []common.Event
+	for _, op := range e.events[start:] {
+		if kind := op.GetKind(); kind == common.COMMENT || kind == common.BLANK_LINE {
+			notes = append(notes, op)
+		} else {
+			rest = append(rest, op)
+		}
+	}
+	e.events = append(e.events[:start], rest...)
+	return notes
+}
+
+// sorted returns the events of the mapping with its entries in order.
+func (f *sortFrame) sorted(end common.Event) []common.Event {
+	sort.SliceStable(f.entries, func(i, j int) bool {
+		return f.entries[i].key < f.entries[j].key
+	})
+	events := []common.Event{f.start}
+	for _, entry := range f.entries {
+		events = append(events, entry.events...)
+	}
+	// comments after the last entry stay at the end
+	events = append(events, f.leading...)
+	return append(events, end)
+}
+
+// check makes sure that an alias still comes after its anchor.
+func (s *sorter) check(op common.Event) error {
+	if alias, ok := op.(*common.AliasEvent); ok && !s.anchors[alias.Anchor] {
+		return fmt.Errorf("sorting the keys would put the alias *%s before its anchor", alias.Anchor)
+	}
+	if e, ok := op.(common.HasNodeProperties); ok && e.GetAnchor() != "" {
+		s.anchors[e.GetAnchor()] = true
+	}
+	return nil
+}
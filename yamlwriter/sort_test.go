@@ -0,0 +1,88 @@
+package yamlwriter
+
+import (
+	"context"
+	"hbibel/yaml-to-json/common"
+	"strings"
+	"testing"
+)
+
+func TestSortKeys(t *testing.T) {
+	events := parse(t, "b:\n  - y: 1\n    x: 2\n  - 3\na: {}\nc: 4\n")
+	runTest(t, events, "a: {}\nb:\n  - x: 2\n    \"y\": 1\n  - 3\nc: 4\n", RenderOptions{SortKeys: true})
+}
+
+func TestSortKeysMovesComments(t *testing.T) {
+	events := []common.Event{
+		common.NewStartMappingEvent(),
+		common.NewCommentEvent(" b", false),
+		common.NewKeyEvent("b"),
+		common.NewNumberEvent("1"),
+		common.NewCommentEvent(" one", true),
+		common.NewBlankLineEvent(),
+		common.NewKeyEvent("a"),
+		common.NewNumberEvent("2"),
+		common.NewCommentEvent(" the end", false),
+		common.NewEndMappingEvent(),
+	}
+	runTest(t, events, "a: 2\n# b\nb: 1 # one\n# the end\n", RenderOptions{SortKeys: true})
+}
+
+func TestSortKeysCommentAfterCollection(t *testing.T) {
+	key := func(key string, line int) common.Event {
+		return &common.EventWithPayload{Kind: common.EMIT_KEY, PayloadType: common.STRING, Payload: key, Position: common.Position{Line: line, Column: 1}}
+	}
+	comment := func(text string, line, column int) common.Event {
+		return &common.CommentEvent{Text: text, Position: common.Position{Line: line, Column: column}}
+	}
+	// the parser reports the comments before "a" before the end of the
+	// collection that precedes them
+	events := []common.Event{
+		common.NewStartMappingEvent(),
+		key("k", 1),
+		common.NewStartArrayEvent(),
+		common.NewEmitElementEvent(),
+		common.NewNumberEvent("1"),
+		common.NewBlankLineEvent(),
+		comment(" before a", 4, 1),
+		common.NewEndArrayEvent(),
+		key("a", 5),
+		common.NewNumberEvent("2"),
+		key("m", 6),
+		common.NewStartMappingEvent(),
+		common.NewKeyEvent("y"),
+		common.NewNumberEvent("3"),
+		comment(" end of m", 8, 3),
+		comment(" before b", 9, 1),
+		common.NewEndMappingEvent(),
+		key("b", 10),
+		common.NewNumberEvent("4"),
+		common.NewEndMappingEvent(),
+	}
+	expected := "# before a\na: 2\n# before b\nb: 4\nk:\n  - 1\nm:\n  \"y\": 3\n# end of m\n"
+	runTest(t, events, expected, RenderOptions{SortKeys: true})
+}
+
+func TestSortKeysAliasBeforeAnchor(t *testing.T) {
+	events := []common.Event{
+		common.NewStreamStartEvent(),
+		common.NewDocumentStartEvent(false),
+		common.NewStartMappingEvent(),
+		common.NewKeyEvent("b"),
+		&common.EventWithPayload{Kind: common.EMIT_VALUE, PayloadType: common.NUMBER, Payload: "1", Anchor: "x"},
+		common.NewKeyEvent("a"),
+		common.NewAliasEvent("x"),
+		common.NewEndMappingEvent(),
+	}
+	input := make(chan common.Event, len(events))
+	for _, event := range events {
+		input <- event
+	}
+	close(input)
+	output, errc := RenderEventsWithOptions(context.Background(), input, RenderOptions{SortKeys: true})
+	for range output {
+	}
+	if err := <-errc; err == nil || !strings.Contains(err.Error(), "*x") {
+		t.Error("Expected an error about the alias *x, got", err)
+	}
+}
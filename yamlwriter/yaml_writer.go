@@ -0,0 +1,759 @@
+// Package yamlwriter renders events as block style YAML. It is the
+// counterpart of the JSON renderer and has the same signatures, so that the
+// events of any reader can be written as YAML.
+package yamlwriter
+
+import (
+	"context"
+	"fmt"
+	"hbibel/yaml-to-json/common"
+	"hbibel/yaml-to-json/internal/pipeline"
+	"hbibel/yaml-to-json/yaml"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+func RenderEvents(events <-chan common.Event) <-chan string {
+	output, _ := RenderEventsContext(context.Background(), events)
+	return output
+}
+
+// RenderEventsContext is like RenderEvents, but stops as soon as ctx is
+// cancelled or an event cannot be rendered. The output channel is closed in
+// any case. After an error, the remaining events are received and discarded
+// until their channel is closed, so that the stage before doesn't block even
+// if ctx isn't cancelled. The returned error channel yields at most one error
+// and is closed when the renderer goroutine has exited.
+func RenderEventsContext(ctx context.Context, events <-chan common.Event) (<-chan string, <-chan error) {
+	return RenderEventsWithOptions(ctx, events, RenderOptions{})
+}
+
+// RenderOptions configure RenderEventsWithOptions. The zero value indents
+// nested collections by two spaces.
+type RenderOptions struct {
+	// Indent is the number of spaces per nesting level, between 2 and 9. If
+	// it is zero, 2 is used.
+	Indent int
+	// IndentlessSequences puts the dashes of a sequence that is the value of
+	// a mapping entry in the column of the key, as in Kubernetes manifests,
+	// instead of indenting them.
+	IndentlessSequences bool
+	// QuoteMultiLine writes multi-line strings as double quoted scalars
+	// instead of literal block scalars, for readers that don't support
+	// block scalars, like the parser of this module.
+	QuoteMultiLine bool
+	// SortKeys writes the entries of each mapping sorted by key, together
+	// with their comments. Each mapping is held back until it ends.
+	SortKeys bool
+}
+
+func (o RenderOptions) indent() int {
+	if o.Indent == 0 {
+		return 2
+	}
+	return min(max(o.Indent, 2), 9)
+}
+
+// RenderEventsWithOptions is like RenderEventsContext, but allows to configure
+// the output format.
+func RenderEventsWithOptions(ctx context.Context, events <-chan common.Event, opts RenderOptions) (<-chan string, <-chan error) {
+	output := make(chan string)
+	errc := make(chan error, 1)
+	go func() {
+		defer close(errc)
+		defer pipeline.Drain(ctx, events)
+		defer close(output)
+
+		var chunks []string
+		r := newRenderer(opts, func(chunk string) {
+			chunks = append(chunks, chunk)
+		})
+
+		for {
+			var op common.Event
+			var ok bool
+			select {
+			case op, ok = <-events:
+			case <-ctx.Done():
+				errc <- ctx.Err()
+				return
+			}
+			chunks = chunks[:0]
+			var err error
+			if ok {
+				err = r.render(op)
+			} else {
+				err = r.finish()
+			}
+			if err != nil {
+				errc <- err
+				return
+			}
+			for _, chunk := range chunks {
+				select {
+				case output <- chunk:
+				case <-ctx.Done():
+					errc <- ctx.Err()
+					return
+				}
+			}
+			if !ok {
+				return
+			}
+		}
+	}()
+	return output, errc
+}
+
+// RenderEventBatches is like RenderEventsWithOptions, but receives slices of
+// events and sends the YAML for each slice as a single chunk. The receiver
+// owns the chunks that are sent to it.
+func RenderEventBatches(ctx context.Context, events <-chan []common.Event, opts RenderOptions) (<-chan []byte, <-chan error) {
+	output := make(chan []byte)
+	errc := make(chan error, 1)
+	go func() {
+		defer close(errc)
+		defer pipeline.Drain(ctx, events)
+		defer close(output)
+
+		var chunk []byte
+		r := newRenderer(opts, func(s string) {
+			chunk = append(chunk, s...)
+		})
+
+		for {
+			var batch []common.Event
+			var ok bool
+			select {
+			case batch, ok = <-events:
+			case <-ctx.Done():
+				errc <- ctx.Err()
+				return
+			}
+
+			// the previous chunk belongs to the receiver now
+			chunk = make([]byte, 0, 2*len(chunk))
+			for _, op := range batch {
+				if err := r.render(op); err != nil {
+					errc <- err
+					return
+				}
+			}
+			if !ok {
+				if err := r.finish(); err != nil {
+					errc <- err
+					return
+				}
+			}
+			if len(chunk) > 0 {
+				select {
+				case output <- chunk:
+				case <-ctx.Done():
+					errc <- ctx.Err()
+					return
+				}
+			}
+			if !ok {
+				return
+			}
+		}
+	}()
+	return output, errc
+}
+
+// renderer holds the state needed to render a stream of events. It passes the
+// YAML for each event to write. A line is only ended when the next one
+// starts, so that an inline comment can still be added to it.
+type renderer struct {
+	opts   RenderOptions
+	indent int
+	write  func(string)
+	// sorter reorders the entries of mappings if keys are sorted
+	sorter *sorter
+
+	// the open collections, innermost last
+	stack []*collection
+	// a collection whose start has been seen, but not whether it is empty
+	pending *collection
+	// whether the line ends with the dash of a sequence entry, so that the
+	// first entry of a collection goes on the same line
+	inline bool
+	// whether a sequence entry has begun whose dash hasn't been written, and
+	// whether it has been written early for an inline comment
+	entry, dash bool
+
+	// whether there is a line that hasn't been ended yet
+	lineOpen bool
+	// whether the open line is the last line of a block scalar, which can't
+	// take a comment
+	block bool
+	// the comment at the end of the open line
+	lineComment string
+	// the comments and empty lines ("") before the next line
+	notes []string
+	// whether anything has been written
+	started bool
+
+	// whether there are stream and document events
+	detailed  bool
+	documents int
+}
+
+type collection struct {
+	kind common.EventType
+	// the tag and the anchor as they are written
+	properties string
+	// the column of the entries
+	column int
+	// whether a mapping key is next, otherwise a value
+	expectKey bool
+}
+
+func newRenderer(opts RenderOptions, write func(string)) *renderer {
+	r := &renderer{
+		opts:   opts,
+		indent: opts.indent(),
+		write:  write,
+	}
+	if opts.SortKeys {
+		r.sorter = &sorter{anchors: map[string]bool{}}
+	}
+	return r
+}
+
+func (r *renderer) top() *collection {
+	if len(r.stack) == 0 {
+		return nil
+	}
+	return r.stack[len(r.stack)-1]
+}
+
+func (r *renderer) render(op common.Event) error {
+	if r.sorter != nil {
+		return r.sorter.add(op, r.renderEvent)
+	}
+	return r.renderEvent(op)
+}
+
+func (r *renderer) renderEvent(op common.Event) error {
+	if r.pending != nil {
+		err := r.resolvePending(op)
+		if err != nil || isEnd(op) {
+			// the end of an empty collection has been written
+			return err
+		}
+	}
+
+	switch op.GetKind() {
+	case common.STREAM_START:
+		r.detailed = true
+	case common.STREAM_END:
+	case common.DOCUMENT_START:
+		explicit := false
+		if e, ok := op.(*common.DocumentEvent); ok {
+			explicit = e.Explicit
+		}
+		if explicit || r.documents > 0 {
+			r.startLine(0)
+			r.write("---")
+		}
+		r.documents++
+	case common.DOCUMENT_END:
+		if e, ok := op.(*common.DocumentEvent); ok && e.Explicit {
+			r.startLine(0)
+			r.write("...")
+		}
+	case common.START_MAPPING, common.START_ARRAY:
+		c := &collection{kind: op.GetKind(), expectKey: true}
+		if e, ok := op.(common.HasNodeProperties); ok {
+			c.properties = properties(e.GetAnchor(), e.GetTag())
+		}
+		r.pending = c
+	case common.END_MAPPING, common.END_ARRAY:
+		if len(r.stack) == 0 {
+			return fmt.Errorf("unexpected event %v", op)
+		}
+		r.stack = r.stack[:len(r.stack)-1]
+		r.nodeDone()
+	case common.EMIT_ELEMENT:
+		r.entry = true
+	case common.EMIT_KEY:
+		top := r.top()
+		if top == nil || top.kind != common.START_MAPPING || !top.expectKey {
+			return fmt.Errorf("unexpected event %v", op)
+		}
+		r.startLine(top.column)
+		r.write(r.keyText(op) + ":")
+		top.expectKey = false
+	case common.EMIT_VALUE:
+		return r.scalar(op)
+	case common.ALIAS:
+		alias := "*" + op.(*common.AliasEvent).Anchor
+		if top := r.top(); top != nil && top.kind == common.START_MAPPING && top.expectKey {
+			r.startLine(top.column)
+			// the colon would be part of the alias otherwise
+			r.write(alias + " :")
+			top.expectKey = false
+			return nil
+		}
+		r.startNode()
+		if r.top() == nil {
+			r.startLine(0)
+		}
+		r.write(r.separator() + alias)
+		r.nodeDone()
+	case common.COMMENT:
+		r.comment(op.(*common.CommentEvent))
+	case common.BLANK_LINE:
+		// several empty lines are collapsed into one
+		if (r.started || len(r.notes) > 0) && (len(r.notes) == 0 || r.notes[len(r.notes)-1] != "") {
+			r.notes = append(r.notes, "")
+		}
+	default:
+		return fmt.Errorf("unexpected event %v", op)
+	}
+	return nil
+}
+
+// finish ends the last line and writes the comments after the last node.
+func (r *renderer) finish() error {
+	if r.sorter != nil && r.sorter.buffering() {
+		return fmt.Errorf("unexpected end of events within a mapping")
+	}
+	r.endLine()
+	// empty lines at the end are dropped
+	for len(r.notes) > 0 && r.notes[len(r.notes)-1] == "" {
+		r.notes = r.notes[:len(r.notes)-1]
+	}
+	for _, note := range r.notes {
+		r.write(note + "\n")
+	}
+	r.notes = nil
+	return nil
+}
+
+func isEnd(op common.Event) bool {
+	return op.GetKind() == common.END_MAPPING || op.GetKind() == common.END_ARRAY
+}
+
+// comment keeps a comment until the next line starts. An inline comment is
+// added to the open line, everything else goes on a line of its own before the
+// next node.
+func (r *renderer) comment(e *common.CommentEvent) {
+	text := "#" + e.Text
+	if !e.Inline {
+		r.notes = append(r.notes, text)
+		return
+	}
+	if top := r.top(); top != nil && top.kind == common.START_ARRAY && r.entry && !r.dash {
+		// the comment follows the dash of an entry that continues on the
+		// next line
+		r.startLine(top.column)
+		r.write("-")
+		r.dash = true
+	}
+	if r.lineOpen && !r.block && r.lineComment == "" {
+		r.lineComment = text
+		return
+	}
+	r.notes = append(r.notes, text)
+}
+
+// resolvePending writes the start of the pending collection now that the
+// event after it is known. An empty collection is written in flow style.
+func (r *renderer) resolvePending(op common.Event) error {
+	c := r.pending
+	r.pending = nil
+	r.startNode()
+	if r.top() == nil && (isEnd(op) || c.properties != "") {
+		r.startLine(0)
+	}
+	separator := r.separator()
+	if isEnd(op) {
+		empty := "{}"
+		if c.kind == common.START_ARRAY {
+			empty = "[]"
+		}
+		if (op.GetKind() == common.END_ARRAY) != (c.kind == common.START_ARRAY) {
+			return fmt.Errorf("unexpected event %v", op)
+		}
+		r.write(separator + prefixed(c.properties, empty))
+		r.nodeDone()
+		return nil
+	}
+
+	parent := r.top()
+	switch {
+	case parent == nil:
+		c.column = 0
+		if c.properties != "" {
+			r.write(c.properties)
+		}
+	case parent.kind == common.START_ARRAY && c.properties == "" && r.lineComment == "":
+		// the first entry goes on the line of the dash
+		c.column = parent.column + r.indent
+		r.write(strings.Repeat(" ", r.indent-1))
+		r.inline = true
+	default:
+		c.column = parent.column + r.indent
+		if c.kind == common.START_ARRAY && parent.kind == common.START_MAPPING && r.opts.IndentlessSequences {
+			c.column = parent.column
+		}
+		if c.properties != "" {
+			r.write(" " + c.properties)
+		}
+	}
+	r.stack = append(r.stack, c)
+	return nil
+}
+
+// startNode writes what precedes a node: the indentation and the dash of a
+// sequence entry. A mapping value follows its key on the same line, and a
+// root node starts at the beginning of a line.
+func (r *renderer) startNode() {
+	top := r.top()
+	if top == nil {
+		if !r.detailed {
+			// without document events, each root node is a document
+			if r.documents > 0 {
+				r.startLine(0)
+				r.write("---")
+			}
+			r.documents++
+		}
+		return
+	}
+	if top.kind == common.START_ARRAY {
+		if !r.dash {
+			r.startLine(top.column)
+			r.write("-")
+		}
+		r.entry, r.dash = false, false
+	}
+}
+
+// separator returns the space between what startNode wrote and the node.
+func (r *renderer) separator() string {
+	if r.top() == nil {
+		return ""
+	}
+	return " "
+}
+
+// startLine ends the open line and indents a new one for an entry of a
+// collection, unless it continues the line of a dash. The comments and the
+// empty line that precede the new line are written first.
+func (r *renderer) startLine(column int) {
+	if r.inline {
+		r.inline = false
+		return
+	}
+	r.endLine()
+	indentation := strings.Repeat(" ", column)
+	for _, note := range r.notes {
+		if note == "" {
+			r.write("\n")
+		} else {
+			r.write(indentation + note + "\n")
+		}
+	}
+	r.notes = r.notes[:0]
+	r.write(indentation)
+	r.lineOpen = true
+	r.started = true
+}
+
+// endLine ends the open line, if there is one, with its comment.
+func (r *renderer) endLine() {
+	if !r.lineOpen {
+		return
+	}
+	if r.lineComment != "" {
+		r.write(" " + r.lineComment)
+		r.lineComment = ""
+	}
+	r.write("\n")
+	r.lineOpen = false
+	r.block = false
+}
+
+// nodeDone marks that the value of a mapping entry is complete.
+func (r *renderer) nodeDone() {
+	if top := r.top(); top != nil && top.kind == common.START_MAPPING {
+		top.expectKey = true
+	}
+}
+
+func (r *renderer) scalar(op common.Event) error {
+	top := r.top()
+	if top != nil && top.kind == common.START_MAPPING && top.expectKey {
+		return fmt.Errorf("unexpected event %v in place of a key", op)
+	}
+	payload, ok := op.(common.HasPayload)
+	if !ok {
+		return fmt.Errorf("unexpected event %v", op)
+	}
+	var props, tag string
+	if e, ok := op.(common.HasNodeProperties); ok {
+		props = properties(e.GetAnchor(), e.GetTag())
+		tag = e.GetTag()
+	}
+
+	// block scalars are indented relative to their parent
+	column := r.indent
+	if top != nil {
+		column = top.column + r.indent
+	}
+	text, ok := r.source(op)
+	if !ok {
+		var err error
+		text, err = formatScalar(payload.GetPayLoadType(), payload.GetPayload(), tag != "", column, r.indent, r.opts.QuoteMultiLine)
+		if err != nil {
+			return err
+		}
+	}
+	text = prefixed(props, text)
+	if text == "" {
+		// an empty value, like "key:" or "-"
+		if top != nil {
+			r.startNode()
+		}
+		r.nodeDone()
+		return nil
+	}
+	r.startNode()
+	if top == nil {
+		r.startLine(0)
+	}
+	if header, body, isBlock := strings.Cut(text, "\n"); isBlock {
+		// a comment can only follow the header of a block scalar
+		if r.lineComment != "" {
+			header += " " + r.lineComment
+			r.lineComment = ""
+		}
+		text = header + "\n" + body
+		r.block = true
+	}
+	r.write(r.separator() + text)
+	r.nodeDone()
+	return nil
+}
+
+// source returns how a plain scalar of a detailed event was written in the
+// YAML source if that is read back as the same value, like "0x1F" for 31 or
+// nothing for an empty value. Strings are always written in the normalised
+// way.
+func (r *renderer) source(op common.Event) (string, bool) {
+	e, ok := op.(*common.EventWithPayload)
+	if !ok || !r.detailed || e.Style != common.PLAIN || e.PayloadType == common.STRING {
+		return "", false
+	}
+	if e.Source == "" {
+		return "", e.PayloadType == common.NULL && e.Tag == ""
+	}
+	resolved := yaml.ResolvePlain(yaml.CoreSchema, e.Source).(common.HasPayload)
+	if e.Tag == "" && resolved.GetPayLoadType() == e.PayloadType && resolved.GetPayload() == e.Payload {
+		return e.Source, true
+	}
+	return "", false
+}
+
+func (r *renderer) keyText(op common.Event) string {
+	key := op.(common.HasPayload).GetPayload()
+	if e, ok := op.(common.HasNodeProperties); ok {
+		return prefixed(properties(e.GetAnchor(), e.GetTag()), plainOrQuoted(key, e.GetTag() != ""))
+	}
+	return plainOrQuoted(key, false)
+}
+
+// prefixed puts the properties of a node in front of its content.
+func prefixed(properties, content string) string {
+	if properties == "" {
+		return content
+	}
+	return properties + " " + content
+}
+
+const yamlTagPrefix = "tag:yaml.org,2002:"
+
+// properties writes an anchor and a tag, using the "!!" handle for the tags
+// of the YAML spec and the verbatim form for other global tags.
+func properties(anchor, tag string) string {
+	var parts []string
+	if anchor != "" {
+		parts = append(parts, "&"+anchor)
+	}
+	switch {
+	case tag == "":
+	case strings.HasPrefix(tag, yamlTagPrefix):
+		parts = append(parts, "!!"+strings.TrimPrefix(tag, yamlTagPrefix))
+	case strings.HasPrefix(tag, "!"):
+		parts = append(parts, tag)
+	default:
+		parts = append(parts, "!<"+tag+">")
+	}
+	return strings.Join(parts, " ")
+}
+
+// formatScalar writes a value such that it is read back with the same type.
+// Multi-line strings become literal block scalars, whose lines are indented by
+// column, which is indent more than their parent, unless quoteMultiLine is set. The type of a tagged value
+// comes from its tag.
+func formatScalar(payloadType common.PayLoadType, payload string, tagged bool, column, indent int, quoteMultiLine bool) (string, error) {
+	switch payloadType {
+	case common.STRING:
+		if !quoteMultiLine && strings.Contains(payload, "\n") && canBeLiteral(payload) {
+			return literal(payload, column, indent), nil
+		}
+		return plainOrQuoted(payload, tagged), nil
+	case common.NUMBER, common.BOOLEAN:
+		return payload, nil
+	case common.NULL:
+		return "null", nil
+	}
+	return "", fmt.Errorf("unknown payload type %d", payloadType)
+}
+
+func plainOrQuoted(s string, tagged bool) string {
+	if isPlainSafe(s, tagged) {
+		return s
+	}
+	return doubleQuoted(s)
+}
+
+var infNaN = regexp.MustCompile(`^([-+]?\.(inf|Inf|INF)|\.(nan|NaN|NAN))$`)
+
+// isPlainSafe reports whether a string can be written as a plain scalar. It
+// must not contain anything that has a meaning in YAML at its position, and
+// unless it is tagged, it must not be read as another type, neither with the
+// core schema nor with YAML 1.1, where e.g. "yes" is a boolean.
+func isPlainSafe(s string, tagged bool) bool {
+	if s == "" || !utf8.ValidString(s) {
+		return false
+	}
+	if !tagged {
+		for _, schema := range []yaml.Schema{yaml.CoreSchema, yaml.YAML11Schema} {
+			if yaml.ResolvePlain(schema, s).(common.HasPayload).GetPayLoadType() != common.STRING {
+				return false
+			}
+		}
+		if infNaN.MatchString(s) {
+			return false
+		}
+	}
+	if strings.ContainsRune("[]{},#&*!|>'\"%@`", rune(s[0])) {
+		return false
+	}
+	// "-", "?" and ":" are indicators if they are followed by a space
+	if strings.ContainsRune("-?:", rune(s[0])) && (len(s) == 1 || s[1] == ' ') {
+		return false
+	}
+	if s[0] == ' ' || s[len(s)-1] == ' ' || strings.HasSuffix(s, ":") {
+		return false
+	}
+	if strings.Contains(s, ": ") || strings.Contains(s, " #") {
+		return false
+	}
+	if strings.HasPrefix(s, "---") || strings.HasPrefix(s, "...") {
+		return false
+	}
+	for _, c := range s {
+		if !isPrintable(c) {
+			return false
+		}
+	}
+	return true
+}
+
+// isPrintable reports whether a character can be written as it is in a
+// quoted or plain scalar. Tabs and line breaks cannot, since they would be
+// folded or confused with indentation.
+func isPrintable(c rune) bool {
+	return c >= ' ' && c != 0x7f && c != '\ufeff' && (c < 0x80 || unicode.IsPrint(c))
+}
+
+// canBeLiteral reports whether a multi-line string can be written as a
+// literal block scalar, which keeps all of its characters as they are.
+func canBeLiteral(s string) bool {
+	if !utf8.ValidString(s) {
+		return false
+	}
+	for _, c := range s {
+		if c != '\n' && c != '\t' && !isPrintable(c) {
+			return false
+		}
+	}
+	// a block of empty lines is read as an empty string, and a leading tab
+	// could be mistaken for indentation
+	return strings.Trim(s, "\n") != "" && !strings.HasPrefix(strings.TrimLeft(s, "\n"), "\t")
+}
+
+// literal writes a string as a literal block scalar.
+func literal(s string, column, indent int) string {
+	header := "|"
+	// the indentation is detected from the first line that isn't empty, so
+	// it must be given if that line starts with a space
+	if strings.HasPrefix(strings.TrimLeft(s, "\n"), " ") {
+		header += strconv.Itoa(indent)
+	}
+	body := s
+	switch {
+	case !strings.HasSuffix(s, "\n"):
+		header += "-"
+	case strings.HasSuffix(s, "\n\n"):
+		header += "+"
+		body = s[:len(s)-1]
+	default:
+		body = s[:len(s)-1]
+	}
+
+	var b strings.Builder
+	b.WriteString(header)
+	indentation := strings.Repeat(" ", column)
+	for _, line := range strings.Split(body, "\n") {
+		b.WriteString("\n")
+		if line != "" {
+			b.WriteString(indentation + line)
+		}
+	}
+	return b.String()
+}
+
+// doubleQuoted writes a string as a double quoted scalar with escape
+// sequences for all characters that cannot be written as they are.
+func doubleQuoted(s string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for _, c := range s {
+		switch c {
+		case '"':
+			b.WriteString(`\"`)
+		case '\\':
+			b.WriteString(`\\`)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\t':
+			b.WriteString(`\t`)
+		case '\r':
+			b.WriteString(`\r`)
+		case 0:
+			b.WriteString(`\0`)
+		default:
+			switch {
+			case isPrintable(c):
+				b.WriteRune(c)
+			case c <= 0xff:
+				fmt.Fprintf(&b, `\x%02x`, c)
+			case c <= 0xffff:
+				fmt.Fprintf(&b, `\u%04x`, c)
+			default:
+				fmt.Fprintf(&b, `\U%08x`, c)
+			}
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
@@ -0,0 +1,421 @@
+package yamlwriter
+
+import (
+	"context"
+	"hbibel/yaml-to-json/common"
+	"hbibel/yaml-to-json/internal/leaktest"
+	"hbibel/yaml-to-json/yaml"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestScalars(t *testing.T) {
+	events := []common.Event{
+		common.NewStartArrayEvent(),
+		common.NewEmitElementEvent(),
+		common.NewStringEvent("foo bar"),
+		common.NewEmitElementEvent(),
+		common.NewNumberEvent("42"),
+		common.NewEmitElementEvent(),
+		common.NewBooleanEvent("false"),
+		common.NewEmitElementEvent(),
+		common.NewNullEvent(),
+		common.NewEndArrayEvent(),
+	}
+	expected := "- foo bar\n- 42\n- false\n- null\n"
+	runTest(t, events, expected, RenderOptions{})
+}
+
+func TestQuoting(t *testing.T) {
+	tests := map[string]string{
+		"":             `""`,
+		"yes":          `"yes"`,
+		"Off":          `"Off"`,
+		"1.0":          `"1.0"`,
+		"0755":         `"0755"`,
+		"null":         `"null"`,
+		"~":            `"~"`,
+		".inf":         `".inf"`,
+		"- a":          `"- a"`,
+		"-a":           "-a",
+		"a: b":         `"a: b"`,
+		"a:b":          "a:b",
+		"a #b":         `"a #b"`,
+		"a#b":          "a#b",
+		"key:":         `"key:"`,
+		" padded":      `" padded"`,
+		"*alias":       `"*alias"`,
+		"[a]":          `"[a]"`,
+		"---":          `"---"`,
+		"tab\there":    `"tab\there"`,
+		"\"quoted\"":   `"\"quoted\""`,
+		"in\"side\\":   `in"side\`,
+		"bell\x07":     `"bell\x07"`,
+		"ä":            "ä",
+		"invalid\xff":  "\"invalid\uFFFD\"",
+		"windows\r\n":  `"windows\r\n"`,
+		"http://x.org": "http://x.org",
+	}
+	for value, expected := range tests {
+		events := []common.Event{common.NewStringEvent(value)}
+		runTest(t, events, expected+"\n", RenderOptions{})
+	}
+}
+
+func TestMapping(t *testing.T) {
+	events := []common.Event{
+		common.NewStartMappingEvent(),
+		common.NewKeyEvent("foo"),
+		common.NewStringEvent("bar"),
+		common.NewKeyEvent("true"),
+		common.NewNumberEvent("1"),
+		common.NewEndMappingEvent(),
+	}
+	expected := "foo: bar\n\"true\": 1\n"
+	runTest(t, events, expected, RenderOptions{})
+}
+
+func TestNestedCollections(t *testing.T) {
+	events := []common.Event{
+		common.NewStartMappingEvent(),
+		common.NewKeyEvent("data"),
+		common.NewStartArrayEvent(),
+		common.NewEmitElementEvent(),
+		common.NewStartMappingEvent(),
+		common.NewKeyEvent("name"),
+		common.NewStringEvent("John"),
+		common.NewKeyEvent("tags"),
+		common.NewStartArrayEvent(),
+		common.NewEmitElementEvent(),
+		common.NewStartArrayEvent(),
+		common.NewEmitElementEvent(),
+		common.NewStringEvent("a"),
+		common.NewEmitElementEvent(),
+		common.NewStringEvent("b"),
+		common.NewEndArrayEvent(),
+		common.NewEndArrayEvent(),
+		common.NewEndMappingEvent(),
+		common.NewEndArrayEvent(),
+		common.NewKeyEvent("meta"),
+		common.NewStartMappingEvent(),
+		common.NewKeyEvent("empty"),
+		common.NewStartMappingEvent(),
+		common.NewEndMappingEvent(),
+		common.NewKeyEvent("none"),
+		common.NewStartArrayEvent(),
+		common.NewEndArrayEvent(),
+		common.NewEndMappingEvent(),
+		common.NewEndMappingEvent(),
+	}
+	expected := strings.Join([]string{
+		"data:",
+		"  - name: John",
+		"    tags:",
+		"      - - a",
+		"        - b",
+		"meta:",
+		"  empty: {}",
+		"  none: []",
+		"",
+	}, "\n")
+	runTest(t, events, expected, RenderOptions{})
+
+	expected = strings.Join([]string{
+		"data:",
+		"    -   name: John",
+		"        tags:",
+		"            -   - a",
+		"                - b",
+		"meta:",
+		"    empty: {}",
+		"    none: []",
+		"",
+	}, "\n")
+	runTest(t, events, expected, RenderOptions{Indent: 4})
+}
+
+func TestLiteralBlockScalars(t *testing.T) {
+	tests := map[string]string{
+		"a\nb":       "|-\n    a\n    b\n",
+		"a\n\nb\n":   "|\n    a\n\n    b\n",
+		"a\n\n":      "|+\n    a\n\n",
+		" a\nb":      "|2-\n     a\n    b\n",
+		"\n\n a\n":   "|2\n\n\n     a\n",
+		"\n":         "\"\\n\"\n",
+		"a\r\nb\r\n": "\"a\\r\\nb\\r\\n\"\n",
+	}
+	for value, expected := range tests {
+		events := []common.Event{
+			common.NewStartMappingEvent(),
+			common.NewKeyEvent("k"),
+			common.NewStartMappingEvent(),
+			common.NewKeyEvent("text"),
+			common.NewStringEvent(value),
+			common.NewEndMappingEvent(),
+			common.NewEndMappingEvent(),
+		}
+		runTest(t, events, "k:\n  text: "+expected, RenderOptions{})
+	}
+}
+
+func TestMultipleDocuments(t *testing.T) {
+	events := []common.Event{
+		common.NewStringEvent("a"),
+		common.NewStartMappingEvent(),
+		common.NewKeyEvent("b"),
+		common.NewNumberEvent("1"),
+		common.NewEndMappingEvent(),
+	}
+	runTest(t, events, "a\n---\nb: 1\n", RenderOptions{})
+}
+
+func TestDetailedEvents(t *testing.T) {
+	events := []common.Event{
+		common.NewStreamStartEvent(),
+		common.NewDocumentStartEvent(false),
+		&common.CollectionEvent{Kind: common.START_MAPPING, Anchor: "m"},
+		&common.EventWithPayload{Kind: common.EMIT_KEY, PayloadType: common.STRING, Payload: "base", Anchor: "k"},
+		&common.CollectionEvent{Kind: common.START_ARRAY, Tag: "!list"},
+		common.NewEmitElementEvent(),
+		&common.EventWithPayload{Kind: common.EMIT_VALUE, PayloadType: common.STRING, Payload: "1", Tag: "tag:yaml.org,2002:str"},
+		common.NewEmitElementEvent(),
+		&common.CollectionEvent{Kind: common.START_MAPPING, Anchor: "inner"},
+		common.NewKeyEvent("x"),
+		&common.EventWithPayload{Kind: common.EMIT_VALUE, PayloadType: common.STRING, Payload: "y", Tag: "tag:example.com:thing"},
+		common.NewEndMappingEvent(),
+		common.NewEndArrayEvent(),
+		common.NewAliasEvent("k"),
+		common.NewAliasEvent("m"),
+		common.NewEndMappingEvent(),
+		common.NewDocumentEndEvent(true),
+		common.NewDocumentStartEvent(true),
+		common.NewStringEvent("second"),
+		common.NewDocumentEndEvent(false),
+		common.NewStreamEndEvent(),
+	}
+	expected := strings.Join([]string{
+		"&m",
+		"&k base: !list",
+		"  - !!str 1",
+		"  - &inner",
+		"    x: !<tag:example.com:thing> y",
+		"*k : *m",
+		"...",
+		"---",
+		"second",
+		"",
+	}, "\n")
+	runTest(t, events, expected, RenderOptions{})
+}
+
+func TestRoundTrip(t *testing.T) {
+	inputs := []string{
+		"data:\n  - name: John\n    age: 30\n  - name: Jane\n    age: 25\n",
+		"a: \"yes\"\nb: \"1.0\"\nc: \"null\"\nd: ~\ne: \"- x\"\nf: \"a: b\"\n",
+		"- - 1\n  - 2\n- []\n- {}\n- \"\"\n",
+	}
+	for _, input := range inputs {
+		for _, indent := range []int{2, 3, 4} {
+			events := parse(t, input)
+			output := render(t, events, RenderOptions{Indent: indent})
+			if actual := parse(t, output); !reflect.DeepEqual(actual, events) {
+				t.Errorf("%q was written as %q, which is read as %v, expected %v", input, output, actual, events)
+			}
+		}
+	}
+}
+
+func TestRenderEventBatches(t *testing.T) {
+	batches := make(chan []common.Event, 2)
+	batches <- []common.Event{
+		common.NewStartArrayEvent(),
+		common.NewEmitElementEvent(),
+		common.NewStringEvent("foo"),
+	}
+	batches <- []common.Event{
+		common.NewEmitElementEvent(),
+		common.NewNumberEvent("42"),
+		common.NewEndArrayEvent(),
+	}
+	close(batches)
+
+	chunks, errc := RenderEventBatches(context.Background(), batches, RenderOptions{})
+	actual := []string{}
+	for chunk := range chunks {
+		actual = append(actual, string(chunk))
+	}
+	if err := <-errc; err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	// a line ends when the next one starts, in case a comment follows
+	expected := []string{"- foo", "\n- 42", "\n"}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Error("Expected", expected, "got", actual)
+	}
+}
+
+func TestRenderEventsContextCancelled(t *testing.T) {
+	defer leaktest.Check(t)()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	events := make(chan common.Event)
+
+	output, errc := RenderEventsContext(ctx, events)
+
+	// nobody reads the output, so the renderer blocks on its first send
+	events <- common.NewStringEvent("a")
+	cancel()
+
+	if err := <-errc; err != context.Canceled {
+		t.Errorf("Expected %v, got %v", context.Canceled, err)
+	}
+	if _, ok := <-output; ok {
+		t.Error("Expected output channel to be closed")
+	}
+}
+
+func TestUnexpectedEvents(t *testing.T) {
+	tests := [][]common.Event{
+		{common.NewKeyEvent("a")},
+		{common.NewEndArrayEvent()},
+		{common.NewStartMappingEvent(), common.NewEndArrayEvent()},
+		{common.NewStartMappingEvent(), common.NewStringEvent("a")},
+		{&common.EventWithPayload{Kind: common.EMIT_VALUE, PayloadType: -1}},
+	}
+	for _, events := range tests {
+		func() {
+			defer leaktest.Check(t)()
+
+			input := make(chan common.Event, len(events))
+			for _, event := range events {
+				input <- event
+			}
+			close(input)
+			output, errc := RenderEventsContext(context.Background(), input)
+			for range output {
+			}
+			if err := <-errc; err == nil {
+				t.Errorf("Expected an error for %v", events)
+			}
+		}()
+	}
+}
+
+func runTest(t *testing.T, events []common.Event, expected string, opts RenderOptions) {
+	t.Helper()
+	if actual := render(t, events, opts); actual != expected {
+		t.Errorf("Expected %q, got %q", expected, actual)
+	}
+}
+
+func render(t *testing.T, events []common.Event, opts RenderOptions) string {
+	t.Helper()
+	input := make(chan common.Event, len(events))
+	for _, event := range events {
+		input <- event
+	}
+	close(input)
+
+	output, errc := RenderEventsWithOptions(context.Background(), input, opts)
+	var b strings.Builder
+	for chunk := range output {
+		b.WriteString(chunk)
+	}
+	if err := <-errc; err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	return b.String()
+}
+
+func parse(t *testing.T, input string) []common.Event {
+	t.Helper()
+	ctx := context.Background()
+	tokens := make(chan yaml.Token)
+	tokenErrc := yaml.TokenizeReader(ctx, strings.NewReader(input), tokens)
+	events, errc := yaml.TokensToEventsContext(ctx, tokens)
+	var result []common.Event
+	for event := range events {
+		result = append(result, event)
+	}
+	if err := <-errc; err != nil {
+		t.Fatalf("Cannot parse %q: %v", input, err)
+	}
+	if err := <-tokenErrc; err != nil {
+		t.Fatalf("Cannot tokenize %q: %v", input, err)
+	}
+	return result
+}
+
+func TestComments(t *testing.T) {
+	events := []common.Event{
+		common.NewCommentEvent(" header", false),
+		common.NewBlankLineEvent(),
+		common.NewStartMappingEvent(),
+		common.NewKeyEvent("a"),
+		common.NewCommentEvent(" after the key", true),
+		common.NewStringEvent("x\ny"),
+		common.NewBlankLineEvent(),
+		common.NewBlankLineEvent(),
+		common.NewCommentEvent(" before b", false),
+		common.NewKeyEvent("b"),
+		common.NewStartArrayEvent(),
+		common.NewEmitElementEvent(),
+		common.NewCommentEvent(" entry", true),
+		common.NewStartMappingEvent(),
+		common.NewKeyEvent("k"),
+		common.NewNumberEvent("1"),
+		common.NewCommentEvent(" one", true),
+		common.NewEndMappingEvent(),
+		common.NewEndArrayEvent(),
+		common.NewEndMappingEvent(),
+		common.NewBlankLineEvent(),
+		common.NewCommentEvent(" footer", false),
+	}
+	expected := strings.Join([]string{
+		"# header",
+		"",
+		"a: |- # after the key",
+		"  x",
+		"  y",
+		"",
+		"# before b",
+		"b:",
+		"  - # entry",
+		"    k: 1 # one",
+		"",
+		"# footer",
+		"",
+	}, "\n")
+	runTest(t, events, expected, RenderOptions{})
+}
+
+func TestIndentlessSequences(t *testing.T) {
+	events := parse(t, "a:\n  - b:\n      - 1\n    c: 2\n")
+	runTest(t, events, "a:\n- b:\n  - 1\n  c: 2\n", RenderOptions{IndentlessSequences: true})
+}
+
+func TestQuoteMultiLine(t *testing.T) {
+	events := []common.Event{common.NewStringEvent("a\nb\n")}
+	runTest(t, events, "\"a\\nb\\n\"\n", RenderOptions{QuoteMultiLine: true})
+}
+
+func TestDetailedScalarSource(t *testing.T) {
+	events := []common.Event{
+		common.NewStreamStartEvent(),
+		common.NewDocumentStartEvent(false),
+		common.NewStartArrayEvent(),
+		&common.EventWithPayload{Kind: common.EMIT_VALUE, PayloadType: common.NUMBER, Payload: "31", Source: "0x1F"},
+		&common.EventWithPayload{Kind: common.EMIT_VALUE, PayloadType: common.BOOLEAN, Payload: "true", Source: "True"},
+		// YAML 1.1 only, so it must be normalised
+		&common.EventWithPayload{Kind: common.EMIT_VALUE, PayloadType: common.BOOLEAN, Payload: "true", Source: "yes"},
+		&common.EventWithPayload{Kind: common.EMIT_VALUE, PayloadType: common.NULL, Payload: "null", Source: "~"},
+		&common.EventWithPayload{Kind: common.EMIT_VALUE, PayloadType: common.NULL, Payload: "null"},
+		// strings are always normalised
+		&common.EventWithPayload{Kind: common.EMIT_VALUE, PayloadType: common.STRING, Payload: "a", Source: "a", Style: common.SINGLE_QUOTED},
+		common.NewEndArrayEvent(),
+		common.NewDocumentEndEvent(false),
+		common.NewStreamEndEvent(),
+	}
+	runTest(t, events, "- 0x1F\n- True\n- true\n- ~\n-\n- a\n", RenderOptions{})
+}